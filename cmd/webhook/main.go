@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"syscall"
 
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/nextdns"
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/requestid"
 	"github.com/cullenmcdermott/external-dns-nextdns-webhook/pkg/webhook"
 )
 
@@ -16,16 +24,36 @@ const (
 	banner = `
 external-dns-nextdns-webhook
 Version: %s
+Commit: %s
+Go: %s
 `
 )
 
 var (
 	// Version is set during build
 	Version = "dev"
+	// Commit is set during build
+	Commit = "unknown"
 )
 
 func main() {
-	fmt.Printf(banner, Version)
+	validate := flag.Bool("validate", false, "validate the configuration and NextDNS access, print a report, and exit")
+	version := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+
+	if *version {
+		printVersion(os.Stdout)
+		return
+	}
+
+	// Read directly rather than from Config: a broken configuration is
+	// exactly what validation has to report
+	if validateOnly, _ := strconv.ParseBool(os.Getenv("VALIDATE_ONLY")); validateOnly || *validate {
+		if !validateConfig(context.Background(), os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	config, err := nextdns.LoadConfig()
 	if err != nil {
@@ -33,6 +61,8 @@ func main() {
 		os.Exit(1)
 	}
 
+	printBanner(os.Stdout, config)
+
 	// Set log level
 	var level slog.Level
 	if config.LogLevel != "" {
@@ -41,7 +71,15 @@ func main() {
 			level = slog.LevelInfo
 		}
 	}
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	slog.SetDefault(slog.New(requestid.NewHandler(newLogHandler(os.Stderr, config.LogFormat, level))))
+
+	metrics.SetBuildInfo(Version, Commit)
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	slog.Info("Starting NextDNS webhook provider")
 	slog.Info("Configuration", "api_port", config.ServerPort, "health_port", config.HealthPort, "dry_run", config.DryRun)
@@ -74,10 +112,109 @@ func main() {
 	}()
 
 	// Start the server
-	if err := srv.Start(ctx); err != nil {
+	err = srv.Start(ctx)
+
+	// Export the spans still buffered before exiting
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer flushCancel()
+	if tracingErr := shutdownTracing(flushCtx); tracingErr != nil {
+		slog.Warn("Failed to flush traces", "error", tracingErr)
+	}
+
+	if err != nil {
 		slog.Error("Server failed", "error", err)
 		os.Exit(1)
 	}
 
 	slog.Info("Server stopped")
 }
+
+// newLogHandler returns a JSON or text log handler writing to w
+func newLogHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case nextdns.LogFormatJSON:
+		return slog.NewJSONHandler(w, opts)
+	case nextdns.LogFormatText, "":
+	default:
+		slog.Warn("Invalid log format, using 'text'", "format", format)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// printBanner writes the startup banner to w unless SUPPRESS_BANNER is set.
+// JSON logging implies it, so log pipelines only see JSON.
+func printBanner(w io.Writer, config *nextdns.Config) {
+	if config.SuppressBanner || config.LogFormat == nextdns.LogFormatJSON {
+		return
+	}
+	fmt.Fprintf(w, banner, Version, buildCommit(), runtime.Version())
+}
+
+// printVersion writes the version, commit and Go version for --version
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "external-dns-nextdns-webhook %s (commit %s, %s)\n", Version, buildCommit(), runtime.Version())
+}
+
+// buildCommit returns Commit, or the VCS revision Go embedded in the binary
+// when the build didn't set it
+func buildCommit() string {
+	if Commit != "unknown" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return Commit
+}
+
+// validateConfig runs the startup checks without serving: it loads the
+// configuration, builds the provider and, unless dry-run is on, tests the
+// NextDNS API once. The write check never runs, so validating doesn't touch
+// the profile. Each check is reported to w; the result is false if any
+// check failed.
+func validateConfig(ctx context.Context, w io.Writer) bool {
+	fmt.Fprintln(w, "Validation report")
+
+	config, err := nextdns.LoadConfig()
+	if !reportCheck(w, "configuration", err) {
+		return reportResult(w, false)
+	}
+	fmt.Fprintf(w, "         profile %s, dry-run %v, records %s\n",
+		config.ProfileID, config.DryRun, strings.Join(config.SupportedRecords, ", "))
+
+	provider, err := nextdns.NewUncheckedProvider(config)
+	if !reportCheck(w, "provider", err) {
+		return reportResult(w, false)
+	}
+
+	if config.DryRun {
+		fmt.Fprintln(w, "  [skip] NextDNS API connection (dry-run)")
+		return reportResult(w, true)
+	}
+	return reportResult(w, reportCheck(w, "NextDNS API connection ("+config.ConnectionTestMode+")", provider.TestConnection(ctx)))
+}
+
+// reportCheck writes one line of the validation report
+func reportCheck(w io.Writer, check string, err error) bool {
+	if err != nil {
+		fmt.Fprintf(w, "  [fail] %s: %v\n", check, err)
+		return false
+	}
+	fmt.Fprintf(w, "  [ok]   %s\n", check)
+	return true
+}
+
+// reportResult writes the overall result of the validation report
+func reportResult(w io.Writer, valid bool) bool {
+	if valid {
+		fmt.Fprintln(w, "Result: valid")
+	} else {
+		fmt.Fprintln(w, "Result: invalid")
+	}
+	return valid
+}
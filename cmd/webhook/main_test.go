@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/nextdns"
+)
+
+func TestPrintBanner(t *testing.T) {
+	tests := []struct {
+		name     string
+		suppress bool
+		format   string
+		want     string
+	}{
+		{name: "printed by default", suppress: false, want: "Version: dev"},
+		{name: "suppressed when configured", suppress: true, want: ""},
+		{name: "suppressed with JSON logs", format: nextdns.LogFormatJSON, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printBanner(&buf, &nextdns.Config{SuppressBanner: tt.suppress, LogFormat: tt.format})
+
+			if tt.want == "" && buf.Len() != 0 {
+				t.Errorf("printBanner() wrote %q, want nothing", buf.String())
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("printBanner() wrote %q, want it to contain %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	var buf bytes.Buffer
+	printVersion(&buf)
+
+	for _, want := range []string{"external-dns-nextdns-webhook dev", "commit ", runtime.Version()} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("printVersion() wrote %q, want it to contain %q", buf.String(), want)
+		}
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("printVersion() wrote %q, want a single line", buf.String())
+	}
+}
+
+func TestNewLogHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		wantJSON bool
+	}{
+		{name: "text by default", format: "", wantJSON: false},
+		{name: "text", format: nextdns.LogFormatText, wantJSON: false},
+		{name: "json", format: nextdns.LogFormatJSON, wantJSON: true},
+		{name: "unknown falls back to text", format: "xml", wantJSON: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(newLogHandler(&buf, tt.format, slog.LevelInfo))
+			logger.Info("Applying changes", "create", 1)
+
+			var entry map[string]any
+			isJSON := json.Unmarshal(buf.Bytes(), &entry) == nil
+			if isJSON != tt.wantJSON {
+				t.Fatalf("output %q is JSON = %v, want %v", buf.String(), isJSON, tt.wantJSON)
+			}
+			if tt.wantJSON && entry["msg"] != "Applying changes" {
+				t.Errorf("msg = %v, want %q", entry["msg"], "Applying changes")
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	var requests, writes atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodGet {
+			writes.Add(1)
+		}
+		if r.Header.Get("X-Api-Key") != "good-key" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"forbidden"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	t.Cleanup(api.Close)
+
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantValid    bool
+		wantLines    []string
+		wantRequests int32
+	}{
+		{
+			name:      "missing API key",
+			env:       map[string]string{"NEXTDNS_PROFILE_ID": "abc123"},
+			wantValid: false,
+			wantLines: []string{"[fail] configuration: NEXTDNS_API_KEY", "Result: invalid"},
+		},
+		{
+			name:      "unimplemented record types",
+			env:       map[string]string{"NEXTDNS_API_KEY": "good-key", "NEXTDNS_PROFILE_ID": "abc123", "SUPPORTED_RECORDS": "A,TXT", "DRY_RUN": "true"},
+			wantValid: false,
+			wantLines: []string{"[ok]   configuration", "[fail] provider: record types TXT", "Result: invalid"},
+		},
+		{
+			name:      "dry-run skips the connection test",
+			env:       map[string]string{"NEXTDNS_API_KEY": "good-key", "NEXTDNS_PROFILE_ID": "abc123", "DRY_RUN": "true"},
+			wantValid: true,
+			wantLines: []string{"profile abc123, dry-run true", "[ok]   provider", "[skip] NextDNS API connection", "Result: valid"},
+		},
+		{
+			name:         "API reachable",
+			env:          map[string]string{"NEXTDNS_API_KEY": "good-key", "NEXTDNS_PROFILE_ID": "abc123", "NEXTDNS_BASE_URL": api.URL},
+			wantValid:    true,
+			wantLines:    []string{"[ok]   NextDNS API connection (list)", "Result: valid"},
+			wantRequests: 1,
+		},
+		{
+			name:         "write check is not run",
+			env:          map[string]string{"NEXTDNS_API_KEY": "good-key", "NEXTDNS_PROFILE_ID": "abc123", "NEXTDNS_BASE_URL": api.URL, "WRITE_CHECK_ENABLED": "true"},
+			wantValid:    true,
+			wantLines:    []string{"[ok]   provider", "[ok]   NextDNS API connection (list)", "Result: valid"},
+			wantRequests: 1,
+		},
+		{
+			name:         "API rejects the key",
+			env:          map[string]string{"NEXTDNS_API_KEY": "bad-key", "NEXTDNS_PROFILE_ID": "abc123", "NEXTDNS_BASE_URL": api.URL},
+			wantValid:    false,
+			wantLines:    []string{"[fail] NextDNS API connection (list)", "Result: invalid"},
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"NEXTDNS_API_KEY", "NEXTDNS_PROFILE_ID", "NEXTDNS_BASE_URL", "DRY_RUN", "RECORD_PROFILE", "SUPPORTED_RECORDS", "WRITE_CHECK_ENABLED"} {
+				t.Setenv(key, tt.env[key])
+			}
+			requests.Store(0)
+			writes.Store(0)
+
+			var buf bytes.Buffer
+			if got := validateConfig(context.Background(), &buf); got != tt.wantValid {
+				t.Errorf("validateConfig() = %v, want %v; report:\n%s", got, tt.wantValid, buf.String())
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(buf.String(), line) {
+					t.Errorf("report is missing %q:\n%s", line, buf.String())
+				}
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("API requests = %d, want %d", got, tt.wantRequests)
+			}
+			if got := writes.Load(); got != 0 {
+				t.Errorf("API writes = %d, want none", got)
+			}
+		})
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	t.Run("disabled without an endpoint", func(t *testing.T) {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		previous := otel.GetTracerProvider()
+
+		shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			t.Fatalf("setupTracing() error = %v", err)
+		}
+		if otel.GetTracerProvider() != previous {
+			t.Error("setupTracing() replaced the tracer provider without an endpoint")
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutdown() error = %v", err)
+		}
+	})
+
+	t.Run("exports to the endpoint", func(t *testing.T) {
+		exported := make(chan struct{}, 1)
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/traces" {
+				select {
+				case exported <- struct{}{}:
+				default:
+				}
+			}
+		}))
+		defer collector.Close()
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+		previous := otel.GetTracerProvider()
+		t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+		shutdown, err := setupTracing(context.Background())
+		if err != nil {
+			t.Fatalf("setupTracing() error = %v", err)
+		}
+		_, span := otel.Tracer("test").Start(context.Background(), "test")
+		span.End()
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown() error = %v", err)
+		}
+
+		select {
+		case <-exported:
+		default:
+			t.Error("no spans exported to the collector on shutdown")
+		}
+	})
+}
@@ -0,0 +1,201 @@
+// Package metrics defines the Prometheus metrics exposed by the webhook.
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exposed by the webhook
+const namespace = "nextdns"
+
+// Registry holds all webhook metrics. A dedicated registry (rather than the
+// global default) keeps the exposition limited to metrics we own.
+var Registry = prometheus.NewRegistry()
+
+// Label values for RecordOperations
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+
+	ModeLive   = "live"
+	ModeDryRun = "dryrun"
+)
+
+// Label values for DeleteOutcomes
+const (
+	DeleteOutcomeDeleted = "deleted"
+	DeleteOutcomeAbsent  = "already_absent"
+)
+
+// Label values for RecordsSkipped
+const (
+	SkipReasonMissingID   = "missing_id"
+	SkipReasonUndecodable = "undecodable_content"
+)
+
+// Label values for EndpointsSkipped
+const (
+	SkipReasonUnsupportedType = "unsupported_type"
+	SkipReasonDomainFilter    = "domain_filter"
+	SkipReasonBlockedTarget   = "blocked_target"
+)
+
+// Label values for CreateFailures
+const (
+	FailureClassTransient = "transient"
+	FailureClassPermanent = "permanent"
+)
+
+// BuildInfo is a constant gauge (value 1) labeled with build metadata
+var BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "build_info",
+	Help:      "Build metadata of the running webhook. Always 1.",
+}, []string{"version", "commit", "go_version"})
+
+// RecordOperations counts record changes by operation and mode: "live" for
+// changes written to NextDNS, "dryrun" for changes only previewed
+var RecordOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "record_operations_total",
+	Help:      "Record create/update/delete operations, by operation and mode (live or dryrun).",
+}, []string{"operation", "mode"})
+
+// DeleteOutcomes counts rewrite deletes by outcome: "deleted" when a rewrite
+// was removed, "already_absent" when it was already gone (deletes are
+// idempotent, so re-applied deletes land here)
+var DeleteOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "delete_outcomes_total",
+	Help:      "Rewrite deletes by outcome (deleted or already_absent).",
+}, []string{"outcome"})
+
+// RecordsSkipped counts rewrites Records left out of its response because
+// they couldn't be converted to endpoints, by reason
+var RecordsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "records_skipped_total",
+	Help:      "Rewrites skipped by Records because they could not be converted, by reason.",
+}, []string{"reason"})
+
+// EndpointsSkipped counts desired endpoints AdjustEndpoints dropped, by
+// reason. external-dns adjusts its endpoints on every sync, so a steadily
+// rising count means it keeps sending records the webhook won't manage,
+// usually a sign of mismatched filters or record types.
+var EndpointsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "skipped_endpoints_total",
+	Help:      "Endpoints dropped by AdjustEndpoints, by reason (unsupported_type, domain_filter, blocked_target).",
+}, []string{"reason"})
+
+// CreateFailures counts record creates that failed, by class: "transient"
+// when the final error was retryable (5xx, 429, network) and retries ran
+// out, "permanent" when NextDNS rejected the create outright (4xx)
+var CreateFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "create_failures_total",
+	Help:      "Failed record creates, by class (transient or permanent).",
+}, []string{"class"})
+
+// APIAttempts counts every NextDNS API call attempt, including retries,
+// by operation (e.g. "ListRewrites")
+var APIAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "api_attempts_total",
+	Help:      "NextDNS API call attempts including retries, by operation.",
+}, []string{"operation"})
+
+// APIErrors counts failed NextDNS API call attempts, including retried
+// ones, by operation and status class: "4xx", "5xx", or "network" when no
+// HTTP response was received
+var APIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "api_errors_total",
+	Help:      "Failed NextDNS API call attempts, by operation and status class (4xx, 5xx, network).",
+}, []string{"operation", "status_class"})
+
+// APIRequestDuration observes how long each NextDNS API call attempt took,
+// successful or not, by operation
+var APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "api_request_duration_seconds",
+	Help:      "Duration of NextDNS API call attempts, by operation.",
+	Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+}, []string{"operation"})
+
+// RetryBackoff observes how long each retry actually waited before the next
+// attempt, by operation. A wait cut short by cancellation is observed too.
+var RetryBackoff = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "retry_backoff_seconds",
+	Help:      "Time spent waiting between NextDNS API retry attempts, by operation.",
+	Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+}, []string{"operation"})
+
+// ApplyConcurrency is the effective number of creates or deletes NextDNS
+// is sent at once, by operation. It drops below the configured value while
+// the API is rate limiting and recovers once it stops.
+var ApplyConcurrency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "apply_concurrency",
+	Help:      "Effective apply concurrency after rate-limit backoff, by operation (create or delete).",
+}, []string{"operation"})
+
+// BatchFailures counts batches that failed to apply when APPLY_BATCH_WINDOW
+// closed. Nothing waits on those applies, so this and the error log are
+// the only trace; external-dns plans the changes again on its next sync.
+var BatchFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "batch_failures_total",
+	Help:      "Batched applies that failed when the batch window closed.",
+})
+
+// SyncDuration observes the time from a Records call to the end of the
+// ApplyChanges that follows it, i.e. one external-dns sync cycle that
+// changed something. Cycles without changes never call ApplyChanges and
+// aren't observed.
+var SyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "sync_duration_seconds",
+	Help:      "Time from a Records request to the end of the following ApplyChanges.",
+	Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		BuildInfo,
+		RecordOperations,
+		DeleteOutcomes,
+		RecordsSkipped,
+		EndpointsSkipped,
+		CreateFailures,
+		APIAttempts,
+		APIErrors,
+		APIRequestDuration,
+		RetryBackoff,
+		ApplyConcurrency,
+		BatchFailures,
+		SyncDuration,
+	)
+}
+
+// SetBuildInfo records the build metadata of the running binary.
+// Version and commit are injected at build time via ldflags.
+func SetBuildInfo(version, commit string) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues(version, commit, runtime.Version()).Set(1)
+}
+
+// Handler returns an HTTP handler that serves the registry in the
+// Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo("v1.2.3", "abc1234")
+
+	got := testutil.ToFloat64(BuildInfo.WithLabelValues("v1.2.3", "abc1234", runtime.Version()))
+	if got != 1 {
+		t.Errorf("build_info value = %v, want 1", got)
+	}
+
+	// Setting again replaces the previous label set rather than adding to it
+	SetBuildInfo("v1.2.4", "def5678")
+	if count := testutil.CollectAndCount(BuildInfo); count != 1 {
+		t.Errorf("build_info series count = %d, want 1", count)
+	}
+}
+
+func TestHandler_ExposesBuildInfo(t *testing.T) {
+	SetBuildInfo("v9.9.9", "deadbee")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Handler() status = %v, want %v", resp.StatusCode, http.StatusOK)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	if !strings.Contains(string(body), `nextdns_build_info{`) {
+		t.Fatalf("metrics output missing nextdns_build_info:\n%s", body)
+	}
+	if !strings.Contains(string(body), `version="v9.9.9"`) {
+		t.Errorf("nextdns_build_info missing version label:\n%s", body)
+	}
+}
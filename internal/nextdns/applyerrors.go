@@ -0,0 +1,70 @@
+package nextdns
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApplyError describes a record change that failed during ApplyChanges
+type ApplyError struct {
+	DNSName    string    `json:"dns_name"`
+	RecordType string    `json:"record_type"`
+	Action     string    `json:"action"`
+	Timestamp  time.Time `json:"timestamp"`
+	Error      string    `json:"error"`
+}
+
+// applyErrors holds the most recent failure per record change until the
+// next successful apply. A nil *applyErrors records nothing.
+type applyErrors struct {
+	mu      sync.Mutex
+	entries map[string]ApplyError
+}
+
+// newApplyErrors creates an empty error set
+func newApplyErrors() *applyErrors {
+	return &applyErrors{entries: make(map[string]ApplyError)}
+}
+
+// record stores entry, replacing an earlier failure of the same change
+func (e *applyErrors) record(entry ApplyError) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entries[entry.Action+"/"+entry.DNSName+"/"+entry.RecordType] = entry
+}
+
+// clear forgets all recorded failures
+func (e *applyErrors) clear() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	clear(e.entries)
+}
+
+// list returns the recorded failures ordered by name, type, and action
+func (e *applyErrors) list() []ApplyError {
+	if e == nil {
+		return []ApplyError{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]ApplyError, 0, len(e.entries))
+	for _, entry := range e.entries {
+		result = append(result, entry)
+	}
+	slices.SortFunc(result, func(a, b ApplyError) int {
+		return strings.Compare(a.DNSName+"/"+a.RecordType+"/"+a.Action, b.DNSName+"/"+b.RecordType+"/"+b.Action)
+	})
+	return result
+}
@@ -0,0 +1,59 @@
+package nextdns
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestApplyChanges_RecordsAndClearsErrors(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config:      &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client:      fake.client(),
+		applyErrors: newApplyErrors(),
+	}
+	provider.warm.Store(true)
+	ctx := context.Background()
+
+	changes := func() *plan.Changes {
+		return &plan.Changes{
+			Create: []*endpoint.Endpoint{
+				{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			},
+		}
+	}
+
+	// Lookups fail, so the create fails
+	fake.listStatus = http.StatusUnauthorized
+	if err := provider.ApplyChanges(ctx, changes()); err == nil {
+		t.Fatal("ApplyChanges() error = nil, want the lookup failure")
+	}
+	// A repeated failure replaces the earlier entry rather than adding one
+	if err := provider.ApplyChanges(ctx, changes()); err == nil {
+		t.Fatal("second ApplyChanges() error = nil, want the lookup failure")
+	}
+
+	got := provider.ApplyErrors()
+	if len(got) != 1 {
+		t.Fatalf("ApplyErrors() = %+v, want 1 entry", got)
+	}
+	if got[0].DNSName != "web.example.com" || got[0].RecordType != "A" || got[0].Action != "create" {
+		t.Errorf("ApplyErrors()[0] = %+v, want create web.example.com A", got[0])
+	}
+	if got[0].Error == "" || got[0].Timestamp.IsZero() {
+		t.Errorf("ApplyErrors()[0] = %+v, want an error message and timestamp", got[0])
+	}
+
+	// The next successful apply clears them
+	fake.listStatus = 0
+	if err := provider.ApplyChanges(ctx, changes()); err != nil {
+		t.Fatalf("ApplyChanges() after recovery error = %v", err)
+	}
+	if got := provider.ApplyErrors(); len(got) != 0 {
+		t.Errorf("ApplyErrors() after success = %+v, want none", got)
+	}
+}
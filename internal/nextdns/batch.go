@@ -0,0 +1,170 @@
+package nextdns
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
+)
+
+// changeBatcher buffers incoming change sets for a fixed window and applies
+// them together. applyChanges runs creates, then updates, then deletes, so
+// the buffered changes are reduced to one net change per record first:
+// otherwise a delete followed by a create of the same record would leave it
+// deleted. external-dns keeps re-planning from Records while a batch is
+// pending, so the same change usually arrives more than once; that reduces
+// to a single change too.
+type changeBatcher struct {
+	window  time.Duration
+	timeout time.Duration // per-change deadline of a flush the window triggers; 0 for none
+	apply   func(ctx context.Context, changes *plan.Changes) error
+
+	mu      sync.Mutex
+	pending map[string]*pendingChange
+	order   []string // pending keys in arrival order
+	timer   *time.Timer
+}
+
+// pendingChange is the net change to one record (name and type) in a batch
+type pendingChange struct {
+	before *endpoint.Endpoint // the record before the batch, nil if it didn't exist
+	after  *endpoint.Endpoint // the latest desired record, nil once deleted
+}
+
+// newChangeBatcher creates a batcher that hands merged changes to apply once
+// window has passed since the first buffered change. A flush the window
+// triggers gets timeout per change to finish.
+func newChangeBatcher(window, timeout time.Duration, apply func(ctx context.Context, changes *plan.Changes) error) *changeBatcher {
+	return &changeBatcher{
+		window:  window,
+		timeout: timeout,
+		apply:   apply,
+	}
+}
+
+// add buffers changes, starting the batch window if none is open
+func (b *changeBatcher) add(changes *plan.Changes) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending == nil {
+		b.pending = make(map[string]*pendingChange)
+	}
+
+	for _, ep := range changes.Create {
+		b.record(nil, ep)
+	}
+	for i := range changes.UpdateOld {
+		b.record(changes.UpdateOld[i], changes.UpdateNew[i])
+	}
+	for _, ep := range changes.Delete {
+		b.record(ep, nil)
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.flushWindow)
+	}
+}
+
+// record folds a change from before to after into the pending batch. The
+// first change to a record fixes its before state; later ones only move
+// its after state.
+func (b *changeBatcher) record(before, after *endpoint.Endpoint) {
+	ep := after
+	if ep == nil {
+		ep = before
+	}
+	key := ep.DNSName + "/" + strings.ToUpper(ep.RecordType)
+
+	change, ok := b.pending[key]
+	if !ok {
+		change = &pendingChange{before: before}
+		b.pending[key] = change
+		b.order = append(b.order, key)
+	}
+	change.after = after
+}
+
+// take removes the pending batch and returns its net changes, nil if
+// nothing is buffered
+func (b *changeBatcher) take() *plan.Changes {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.pending == nil {
+		return nil
+	}
+
+	changes := &plan.Changes{}
+	for _, key := range b.order {
+		change := b.pending[key]
+		switch {
+		case change.before == nil && change.after == nil:
+			// Created and deleted again within the window
+		case change.before == nil:
+			changes.Create = append(changes.Create, change.after)
+		case change.after == nil:
+			changes.Delete = append(changes.Delete, change.before)
+		default:
+			changes.UpdateOld = append(changes.UpdateOld, change.before)
+			changes.UpdateNew = append(changes.UpdateNew, change.after)
+		}
+	}
+	b.pending = nil
+	b.order = nil
+	return changes
+}
+
+// flushWindow applies the batch when the window closes. No request is
+// waiting on it, so the flush gets its own deadline and a failure is
+// counted as well as logged; external-dns plans the lost changes again
+// from Records on its next sync.
+func (b *changeBatcher) flushWindow() {
+	changes := b.take()
+	if changes == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if b.timeout > 0 {
+		// Each change is at least one request, plus the list that finds them
+		count := len(changes.Create) + len(changes.UpdateOld) + len(changes.Delete)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout*time.Duration(count+1))
+		defer cancel()
+	}
+
+	if err := b.applyBatch(ctx, changes); err != nil {
+		metrics.BatchFailures.Inc()
+		slog.Error("Failed to apply batched changes", "error", err)
+	}
+}
+
+// flush applies the pending batch now, if there is one
+func (b *changeBatcher) flush(ctx context.Context) error {
+	changes := b.take()
+	if changes == nil {
+		return nil
+	}
+	return b.applyBatch(ctx, changes)
+}
+
+// applyBatch hands the net changes of a batch to apply
+func (b *changeBatcher) applyBatch(ctx context.Context, changes *plan.Changes) error {
+	slog.Info("Applying batched changes",
+		"create", len(changes.Create),
+		"update", len(changes.UpdateOld),
+		"delete", len(changes.Delete))
+
+	return b.apply(ctx, changes)
+}
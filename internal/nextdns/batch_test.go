@@ -0,0 +1,219 @@
+package nextdns
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
+)
+
+// newBatchingProvider returns a provider backed by the fake API with batching enabled
+func newBatchingProvider(fake *fakeNextDNS, window time.Duration) *Provider {
+	p := &Provider{
+		config: &Config{
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+			ApplyBatchWindow: window,
+		},
+		client: fake.client(),
+	}
+	p.batcher = newChangeBatcher(window, time.Second, p.applyChanges)
+	p.warm.Store(true)
+	return p
+}
+
+func TestApplyChanges_BatchCoalescesApplies(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	// A long window so the test controls when the batch is applied
+	provider := newBatchingProvider(fake, time.Hour)
+	ctx := context.Background()
+
+	web := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+	api := &endpoint.Endpoint{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}
+
+	// external-dns re-plans the same create until it shows up in Records
+	applies := []*plan.Changes{
+		{Create: []*endpoint.Endpoint{web}},
+		{Create: []*endpoint.Endpoint{web}},
+		{Create: []*endpoint.Endpoint{web, api}},
+	}
+	for i, changes := range applies {
+		if err := provider.ApplyChanges(ctx, changes); err != nil {
+			t.Fatalf("ApplyChanges() #%d error = %v", i, err)
+		}
+	}
+
+	if fake.listCalls != 0 || fake.createCalls != 0 {
+		t.Fatalf("API called before the batch window closed: list=%d create=%d", fake.listCalls, fake.createCalls)
+	}
+
+	if err := provider.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if fake.createCalls != 2 {
+		t.Errorf("create calls = %d, want 2 (one per distinct record)", fake.createCalls)
+	}
+	// The first lookup lists the profile; the second is served by the index
+	if fake.listCalls != 1 {
+		t.Errorf("list calls = %d, want 1", fake.listCalls)
+	}
+	if got := len(fake.records()); got != 2 {
+		t.Errorf("stored records = %d, want 2", got)
+	}
+
+	// Nothing left to apply
+	if err := provider.Flush(ctx); err != nil {
+		t.Fatalf("second Flush() error = %v", err)
+	}
+	if fake.createCalls != 2 {
+		t.Errorf("create calls after empty flush = %d, want 2", fake.createCalls)
+	}
+}
+
+func TestApplyChanges_BatchAppliesAfterWindow(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := newBatchingProvider(fake, 20*time.Millisecond)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fake.records()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("batched changes were not applied after the window")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestApplyChanges_BatchNetChanges verifies that changes to one record
+// within the window are reduced to their net effect, whatever order
+// applyChanges runs creates, updates, and deletes in.
+func TestApplyChanges_BatchNetChanges(t *testing.T) {
+	a := func(target string) *endpoint.Endpoint {
+		return &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{target}}
+	}
+
+	tests := []struct {
+		name        string
+		existing    string
+		applies     []*plan.Changes
+		want        []string
+		wantCreates int
+	}{
+		{
+			name:     "deleted then recreated unchanged",
+			existing: "10.0.0.1",
+			applies: []*plan.Changes{
+				{Delete: []*endpoint.Endpoint{a("10.0.0.1")}},
+				{Create: []*endpoint.Endpoint{a("10.0.0.1")}},
+			},
+			want: []string{"10.0.0.1"},
+		},
+		{
+			name:     "deleted then recreated with a new target",
+			existing: "10.0.0.1",
+			applies: []*plan.Changes{
+				{Delete: []*endpoint.Endpoint{a("10.0.0.1")}},
+				{Create: []*endpoint.Endpoint{a("10.0.0.2")}},
+			},
+			want:        []string{"10.0.0.2"},
+			wantCreates: 1,
+		},
+		{
+			name: "created then deleted",
+			applies: []*plan.Changes{
+				{Create: []*endpoint.Endpoint{a("10.0.0.1")}},
+				{Delete: []*endpoint.Endpoint{a("10.0.0.1")}},
+			},
+			want: nil,
+		},
+		{
+			name:     "updated twice",
+			existing: "10.0.0.1",
+			applies: []*plan.Changes{
+				{UpdateOld: []*endpoint.Endpoint{a("10.0.0.1")}, UpdateNew: []*endpoint.Endpoint{a("10.0.0.2")}},
+				{UpdateOld: []*endpoint.Endpoint{a("10.0.0.2")}, UpdateNew: []*endpoint.Endpoint{a("10.0.0.3")}},
+			},
+			want:        []string{"10.0.0.3"},
+			wantCreates: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			if tt.existing != "" {
+				fake.add("web.example.com", tt.existing)
+			}
+			provider := newBatchingProvider(fake, time.Hour)
+			ctx := context.Background()
+
+			for i, changes := range tt.applies {
+				if err := provider.ApplyChanges(ctx, changes); err != nil {
+					t.Fatalf("ApplyChanges() #%d error = %v", i, err)
+				}
+			}
+			if err := provider.Flush(ctx); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			var got []string
+			for _, rewrite := range fake.records() {
+				got = append(got, rewrite.Content)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stored targets = %v, want %v", got, tt.want)
+			}
+			if fake.createCalls != tt.wantCreates {
+				t.Errorf("create calls = %d, want %d", fake.createCalls, tt.wantCreates)
+			}
+		})
+	}
+}
+
+// TestApplyChanges_BatchWindowFailure verifies that a batch that fails when
+// the window closes is counted, since nothing else reports it
+func TestApplyChanges_BatchWindowFailure(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.createStatus = http.StatusBadRequest
+	provider := newBatchingProvider(fake, 20*time.Millisecond)
+	before := testutil.ToFloat64(metrics.BatchFailures)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(metrics.BatchFailures) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("failed batch was not counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFlush_NoBatching(t *testing.T) {
+	provider := &Provider{config: &Config{}}
+	if err := provider.Flush(context.Background()); err != nil {
+		t.Errorf("Flush() without batching error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,36 @@
+package nextdns
+
+import "strings"
+
+// Capabilities describes what the provider supports, for operators and
+// tooling to introspect
+type Capabilities struct {
+	// RecordTypes are the record types the provider manages
+	RecordTypes []string `json:"record_types"`
+	// NativeUpdates is false: NextDNS has no rewrite update call, so an
+	// update deletes and recreates the changed targets
+	NativeUpdates bool `json:"native_updates"`
+	// TTLHonored is false: every rewrite is served at DefaultTTL
+	TTLHonored bool `json:"ttl_honored"`
+	// DefaultTTL is the TTL records are reported with
+	DefaultTTL int64 `json:"default_ttl"`
+	// TXTRegistry reports whether external-dns's txt registry records are
+	// stored (TXT_REGISTRY_ENABLED)
+	TXTRegistry bool `json:"txt_registry"`
+}
+
+// Capabilities returns what the provider supports with its configuration
+func (p *Provider) Capabilities() Capabilities {
+	recordTypes := make([]string, 0, len(p.config.SupportedRecords))
+	for _, recordType := range p.config.SupportedRecords {
+		recordTypes = append(recordTypes, strings.ToUpper(recordType))
+	}
+
+	return Capabilities{
+		RecordTypes:   recordTypes,
+		NativeUpdates: false,
+		TTLHonored:    false,
+		DefaultTTL:    int64(DefaultTTL),
+		TXTRegistry:   p.config.TXTRegistryEnabled,
+	}
+}
@@ -2,28 +2,102 @@ package nextdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/amalucelli/nextdns-go/nextdns"
-)
+	"go.opentelemetry.io/otel/attribute"
 
-// Retry configuration constants
-const (
-	maxRetryAttempts = 3
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 )
 
-// retryDelays defines the exponential backoff delays for retry attempts
-var retryDelays = []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second}
+// defaultBaseURL is the NextDNS API base URL the SDK uses by default
+const defaultBaseURL = "https://api.nextdns.io/"
+
+// retryPolicy is how often and how patiently API calls are retried: up to
+// maxRetries retries after the first attempt, waiting baseDelay, then
+// doubling it before each further retry. With jitter each wait is instead
+// a random duration up to that delay ("full jitter"), so replicas and
+// concurrent applies that failed together don't all retry together.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	jitter     bool
+}
+
+// maxRetryAttempts caps RETRY_MAX_ATTEMPTS (the first attempt plus ten
+// retries); with doubling delays more retries would stall an apply for hours
+const maxRetryAttempts = 11
+
+// defaultRetryPolicy retries three times after 1s, 2s and 4s
+var defaultRetryPolicy = retryPolicy{maxRetries: 3, baseDelay: time.Second}
+
+// delay returns how long to wait before retry number attempt+1
+func (r retryPolicy) delay(attempt int) time.Duration {
+	return r.baseDelay << attempt
+}
+
+// wait returns the pause before retry number attempt+1: delay, or with
+// jitter a random duration between 0 and delay
+func (r retryPolicy) wait(attempt int) time.Duration {
+	delay := r.delay(attempt)
+	if !r.jitter || delay <= 0 {
+		return delay
+	}
+	return rand.N(delay + 1)
+}
 
 // Client wraps the NextDNS API client and provides DNS record management
 type Client struct {
 	api       *nextdns.Client
 	profileID string
+
+	// createLimit and deleteLimit, if set, adapt apply concurrency to the
+	// rate limiting seen by creates and deletes
+	createLimit *adaptiveLimit
+	deleteLimit *adaptiveLimit
+
+	// index answers name/type lookups from the last listing
+	index rewriteIndex
+
+	// list, if set, reuses a recent listing instead of calling the API
+	list *listCache
+
+	// retry, if set, replaces defaultRetryPolicy
+	retry *retryPolicy
+
+	// timeout, if set, bounds each API request, so a hung connection
+	// fails (and is retried) even when the caller's context never ends
+	timeout time.Duration
+
+	// rate, if set, spaces out API requests to stay under NextDNS's rate
+	// limit
+	rate *rateLimiter
+}
+
+// withTimeout derives the context for one API request from ctx
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// retryPolicy returns the client's retry policy
+func (c *Client) retryPolicy() retryPolicy {
+	if c.retry == nil {
+		return defaultRetryPolicy
+	}
+	return *c.retry
 }
 
 // NewClient creates a new NextDNS client wrapper
@@ -41,8 +115,14 @@ func NewClient(apiKey, profileID, baseURL string) (*Client, error) {
 	}
 
 	// Add custom base URL if provided
-	if baseURL != "" && baseURL != "https://api.nextdns.io" {
-		opts = append(opts, nextdns.WithBaseURL(baseURL))
+	if baseURL != "" {
+		normalized, err := normalizeBaseURL(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		if normalized != defaultBaseURL {
+			opts = append(opts, nextdns.WithBaseURL(normalized))
+		}
 	}
 
 	// Create NextDNS client
@@ -63,6 +143,26 @@ func NewClient(apiKey, profileID, baseURL string) (*Client, error) {
 	return client, nil
 }
 
+// normalizeBaseURL validates an API base URL and makes sure its path ends in
+// a slash. The SDK resolves request paths relative to the base URL, so without
+// the slash a path prefix like /proxy/nextdns would lose its last segment.
+func normalizeBaseURL(baseURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", baseURL)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", fmt.Errorf("invalid base URL %q: must not have a query or fragment", baseURL)
+	}
+
+	parsed.Path = strings.TrimRight(parsed.Path, "/") + "/"
+	parsed.RawPath = ""
+	return parsed.String(), nil
+}
+
 // isRetryableError determines if an error is retryable based on HTTP status codes
 // and error types. Retryable errors include:
 // - Network timeouts
@@ -70,11 +170,17 @@ func NewClient(apiKey, profileID, baseURL string) (*Client, error) {
 // - Rate limit errors (429)
 // Non-retryable errors include:
 // - 4xx client errors (400, 401, 403, 404)
+// An API error's status code decides on its own; the message checks only
+// classify errors without one, such as network failures.
 func isRetryableError(err error) bool {
 	if err == nil {
 		return false
 	}
 
+	if code, ok := apiStatusCode(err); ok {
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+
 	errStr := err.Error()
 
 	// Check for network timeout errors
@@ -82,6 +188,12 @@ func isRetryableError(err error) bool {
 		return true
 	}
 
+	// A request that ran into API_TIMEOUT. retryWithBackoff stops on its
+	// own once the caller's context is done.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
 	// Check for HTTP status codes in error message
 	// NextDNS SDK returns errors with status codes in the message
 	retryableStatusCodes := []int{429, 500, 502, 503, 504}
@@ -120,12 +232,39 @@ func isRetryableError(err error) bool {
 	return false
 }
 
+// rewriteIDPattern matches the short opaque IDs NextDNS assigns to rewrites.
+// Anything else (empty, whitespace, path separators) can't be used in later
+// API calls.
+var rewriteIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// isPlausibleRewriteID reports whether id looks like a usable rewrite ID
+func isPlausibleRewriteID(id string) bool {
+	return rewriteIDPattern.MatchString(id)
+}
+
+// isRateLimitError reports whether err is a NextDNS API 429 response
+func isRateLimitError(err error) bool {
+	if code, ok := apiStatusCode(err); ok {
+		return code == http.StatusTooManyRequests
+	}
+	return err != nil && strings.Contains(err.Error(), "429")
+}
+
+// isNotFoundError reports whether err is a NextDNS API "not found" error,
+// e.g. when deleting a rewrite ID that no longer exists
+func isNotFoundError(err error) bool {
+	var apiErr *nextdns.Error
+	return errors.As(err, &apiErr) && apiErr.Type == nextdns.ErrorTypeNotFound
+}
+
 // retryWithBackoff executes an operation with exponential backoff retry logic.
-// It retries the operation up to maxRetryAttempts times with delays of 1s, 2s, 4s.
+// It retries the operation up to policy.maxRetries times, doubling the delay
+// from policy.baseDelay (by default 1s, 2s, 4s).
 // The function respects context cancellation during retry delays.
 //
 // Parameters:
 // - ctx: Context for cancellation support
+// - policy: Retry count and base delay
 // - operation: The function to execute (returns error)
 // - operationName: Name of the operation for logging purposes
 //
@@ -133,10 +272,10 @@ func isRetryableError(err error) bool {
 // - nil if the operation succeeds
 // - The last error if all retries are exhausted
 // - The error immediately if it is non-retryable (4xx errors)
-func retryWithBackoff(ctx context.Context, operation func() error, operationName string) error {
+func retryWithBackoff(ctx context.Context, policy retryPolicy, operation func() error, operationName string) error {
 	var lastErr error
 
-	for attempt := 0; attempt <= maxRetryAttempts; attempt++ {
+	for attempt := 0; attempt <= policy.maxRetries; attempt++ {
 		// Check context before each attempt
 		select {
 		case <-ctx.Done():
@@ -145,11 +284,17 @@ func retryWithBackoff(ctx context.Context, operation func() error, operationName
 		}
 
 		// Execute the operation
-		err := operation()
+		metrics.APIAttempts.WithLabelValues(operationName).Inc()
+		attemptStart := time.Now()
+		err := normalizeAPIError(operation())
+		metrics.APIRequestDuration.WithLabelValues(operationName).Observe(time.Since(attemptStart).Seconds())
+		if err != nil {
+			metrics.APIErrors.WithLabelValues(operationName, statusClass(err)).Inc()
+		}
 		if err == nil {
 			// Success
 			if attempt > 0 {
-				slog.Debug("Operation succeeded after retry",
+				slog.DebugContext(ctx, "Operation succeeded after retry",
 					"operation", operationName,
 					"attempt", attempt+1)
 			}
@@ -160,97 +305,200 @@ func retryWithBackoff(ctx context.Context, operation func() error, operationName
 
 		// Check if error is retryable
 		if !isRetryableError(err) {
-			slog.Debug("Non-retryable error encountered, failing immediately",
+			slog.DebugContext(ctx, "Non-retryable error encountered, failing immediately",
 				"operation", operationName,
 				"error", err.Error())
 			return err
 		}
 
 		// Check if we have retries remaining
-		if attempt >= maxRetryAttempts {
+		if attempt >= policy.maxRetries {
 			break
 		}
 
 		// Get delay for this attempt
-		delay := retryDelays[attempt]
+		delay := policy.wait(attempt)
 
-		slog.Debug("Retryable error encountered, will retry after delay",
+		slog.DebugContext(ctx, "Retryable error encountered, will retry after delay",
 			"operation", operationName,
 			"attempt", attempt+1,
 			"error", err.Error(),
 			"delay", delay.String())
 
 		// Wait with context cancellation support
+		waitStart := time.Now()
 		select {
 		case <-ctx.Done():
+			metrics.RetryBackoff.WithLabelValues(operationName).Observe(time.Since(waitStart).Seconds())
 			return ctx.Err()
 		case <-time.After(delay):
 			// Continue to next attempt
 		}
+		metrics.RetryBackoff.WithLabelValues(operationName).Observe(time.Since(waitStart).Seconds())
 	}
 
 	// All retries exhausted
-	slog.Warn("All retry attempts exhausted",
+	slog.WarnContext(ctx, "All retry attempts exhausted",
 		"operation", operationName,
-		"max_attempts", maxRetryAttempts+1,
+		"max_attempts", policy.maxRetries+1,
 		"error", lastErr.Error())
 
 	return lastErr
 }
 
-// TestConnection verifies that the client can communicate with the NextDNS API
-func (c *Client) TestConnection(ctx context.Context) error {
-	slog.Debug("Testing connection to NextDNS API")
-
-	// Try to list rewrites as a connection test
-	_, err := c.ListRewrites(ctx)
+// TestConnection verifies that the client can communicate with the NextDNS
+// API. ConnectionTestList lists the profile's rewrites; ConnectionTestLight
+// fetches the profile's settings instead, which stays cheap on large profiles.
+func (c *Client) TestConnection(ctx context.Context, mode string) error {
+	slog.DebugContext(ctx, "Testing connection to NextDNS API", "mode", mode)
+
+	var err error
+	if mode == ConnectionTestLight {
+		spanCtx, span := startSpan(ctx, "nextdns.GetSettings", attrProfileID.String(c.profileID))
+		err = retryWithBackoff(spanCtx, c.retryPolicy(), func() error {
+			if err := c.rate.wait(spanCtx); err != nil {
+				return err
+			}
+			reqCtx, cancel := c.withTimeout(spanCtx)
+			defer cancel()
+			_, getErr := c.api.Settings.Get(reqCtx, &nextdns.GetSettingsRequest{ProfileID: c.profileID})
+			return getErr
+		}, "GetSettings")
+		endSpan(span, err)
+	} else {
+		// Try to list rewrites as a connection test
+		_, err = c.ListRewrites(ctx)
+	}
 	if err != nil {
 		return fmt.Errorf("connection test failed: %w", err)
 	}
 
-	slog.Info("Successfully connected to NextDNS API")
+	slog.InfoContext(ctx, "Successfully connected to NextDNS API")
+	return nil
+}
+
+// writeCheckContent is the canary rewrite's content, an address from the
+// TEST-NET-1 documentation range
+const writeCheckContent = "192.0.2.1"
+
+// TestWrite verifies the API key can write to the profile by creating a
+// canary rewrite named name and deleting it again
+func (c *Client) TestWrite(ctx context.Context, name string) error {
+	slog.DebugContext(ctx, "Testing write access to NextDNS API", "name", name)
+
+	id, err := c.CreateRewrite(ctx, name, "A", writeCheckContent)
+	if err != nil {
+		return fmt.Errorf("write check failed: %w", err)
+	}
+	if err := c.DeleteRewrite(ctx, id); err != nil {
+		return fmt.Errorf("write check created canary rewrite %s (ID %s) but failed to delete it: %w", name, id, err)
+	}
+
+	slog.InfoContext(ctx, "Successfully verified write access to NextDNS API")
 	return nil
 }
 
 // ListRewrites fetches all DNS rewrites for the configured profile
 // This method includes automatic retry with exponential backoff for transient errors
 func (c *Client) ListRewrites(ctx context.Context) ([]*nextdns.Rewrites, error) {
-	slog.Debug("Listing DNS rewrites", "profile_id", c.profileID)
+	if rewrites, ok := c.list.get(); ok {
+		slog.DebugContext(ctx, "Using cached DNS rewrites",
+			"profile_id", c.profileID,
+			"count", len(rewrites))
+		return rewrites, nil
+	}
+
+	slog.DebugContext(ctx, "Listing DNS rewrites", "profile_id", c.profileID)
 
+	generation := c.list.start()
+	rewrites, err := c.listRewrites(ctx)
+	if err != nil {
+		c.index.invalidate()
+		return nil, fmt.Errorf("failed to list rewrites: %w", classifyAPIError(err, ErrProfileUnavailable))
+	}
+
+	slog.DebugContext(ctx, "Successfully listed DNS rewrites",
+		"profile_id", c.profileID,
+		"count", len(rewrites))
+	c.index.rebuild(rewrites)
+	c.list.put(generation, rewrites)
+
+	return rewrites, nil
+}
+
+// listRewrites fetches the profile's rewrites without touching the index
+func (c *Client) listRewrites(ctx context.Context) ([]*nextdns.Rewrites, error) {
+	ctx, span := startSpan(ctx, "nextdns.ListRewrites", attrProfileID.String(c.profileID))
 	var rewrites []*nextdns.Rewrites
 
-	err := retryWithBackoff(ctx, func() error {
+	err := retryWithBackoff(ctx, c.retryPolicy(), func() error {
 		request := &nextdns.ListRewritesRequest{
 			ProfileID: c.profileID,
 		}
 
+		if err := c.rate.wait(ctx); err != nil {
+			return err
+		}
+		reqCtx, cancel := c.withTimeout(ctx)
+		defer cancel()
 		var listErr error
-		rewrites, listErr = c.api.Rewrites.List(ctx, request)
+		rewrites, listErr = c.api.Rewrites.List(reqCtx, request)
 		return listErr
 	}, "ListRewrites")
+	span.SetAttributes(attribute.Int("nextdns.rewrites", len(rewrites)))
+	endSpan(span, err)
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to list rewrites: %w", err)
-	}
+	return rewrites, err
+}
 
-	slog.Debug("Successfully listed DNS rewrites",
-		"profile_id", c.profileID,
-		"count", len(rewrites))
+// VerifyRewrite waits until a listing includes the rewrite with id. NextDNS
+// is eventually consistent, so a rewrite created moments ago can be missing
+// from the next listings; the list is checked up to attempts times,
+// interval apart. These listings don't rebuild the index, which already
+// holds the new rewrite.
+func (c *Client) VerifyRewrite(ctx context.Context, id, name string, attempts int, interval time.Duration) error {
+	for attempt := 1; attempt <= attempts; attempt++ {
+		rewrites, err := c.listRewrites(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list rewrites to verify %s: %w", name, classifyAPIError(err, ErrProfileUnavailable))
+		}
+		if slices.ContainsFunc(rewrites, func(rewrite *nextdns.Rewrites) bool { return rewrite.ID == id }) {
+			if attempt > 1 {
+				slog.DebugContext(ctx, "Written rewrite became visible after re-checking",
+					"id", id,
+					"name", name,
+					"attempt", attempt)
+			}
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
 
-	return rewrites, nil
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return fmt.Errorf("%w: rewrite %s (%s) not listed after %d checks", ErrWriteNotVisible, name, id, attempts)
 }
 
 // CreateRewrite creates a new DNS rewrite record
 // This method includes automatic retry with exponential backoff for transient errors
-func (c *Client) CreateRewrite(ctx context.Context, name, recordType, content string) (string, error) {
-	slog.Debug("Creating DNS rewrite",
+func (c *Client) CreateRewrite(ctx context.Context, name, recordType, content string) (id string, err error) {
+	ctx, span := startSpan(ctx, "nextdns.CreateRewrite",
+		attrProfileID.String(c.profileID),
+		attrRecordName.String(name),
+		attrRecordType.String(recordType))
+	defer func() { endSpan(span, err) }()
+
+	slog.DebugContext(ctx, "Creating DNS rewrite",
 		"name", name,
 		"type", recordType,
 		"content", content)
 
-	var id string
-
-	err := retryWithBackoff(ctx, func() error {
+	err = retryWithBackoff(ctx, c.retryPolicy(), func() error {
 		// Note: NextDNS API does not accept the Type field on creation
 		// It automatically determines the type based on the content
 		request := &nextdns.CreateRewritesRequest{
@@ -261,16 +509,32 @@ func (c *Client) CreateRewrite(ctx context.Context, name, recordType, content st
 			},
 		}
 
+		if err := c.rate.wait(ctx); err != nil {
+			return err
+		}
+		reqCtx, cancel := c.withTimeout(ctx)
+		defer cancel()
 		var createErr error
-		id, createErr = c.api.Rewrites.Create(ctx, request)
+		id, createErr = c.api.Rewrites.Create(reqCtx, request)
+		c.createLimit.observe(createErr)
 		return createErr
 	}, "CreateRewrite")
+	// Even a failed create may have been applied
+	c.list.invalidate()
 
 	if err != nil {
-		return "", fmt.Errorf("failed to create rewrite: %w", err)
+		return "", fmt.Errorf("failed to create rewrite: %w", classifyAPIError(err, ErrProfileUnavailable))
+	}
+
+	// Later deletes and updates address the rewrite by this ID, so a missing
+	// or malformed one must surface now rather than as a broken delete
+	if !isPlausibleRewriteID(id) {
+		return "", fmt.Errorf("NextDNS returned an invalid ID %q for created rewrite %s (%s); the record may exist without a usable ID", id, name, content)
 	}
 
-	slog.Info("Successfully created DNS rewrite",
+	c.index.add(&nextdns.Rewrites{ID: id, Name: name, Type: recordType, Content: content})
+
+	slog.InfoContext(ctx, "Successfully created DNS rewrite",
 		"id", id,
 		"name", name,
 		"type", recordType,
@@ -281,41 +545,87 @@ func (c *Client) CreateRewrite(ctx context.Context, name, recordType, content st
 
 // DeleteRewrite deletes a DNS rewrite record by ID
 // This method includes automatic retry with exponential backoff for transient errors
-func (c *Client) DeleteRewrite(ctx context.Context, id string) error {
-	slog.Debug("Deleting DNS rewrite", "id", id)
+func (c *Client) DeleteRewrite(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, "nextdns.DeleteRewrite",
+		attrProfileID.String(c.profileID),
+		attrRewriteID.String(id))
+	defer func() { endSpan(span, err) }()
+
+	slog.DebugContext(ctx, "Deleting DNS rewrite", "id", id)
 
-	err := retryWithBackoff(ctx, func() error {
+	err = retryWithBackoff(ctx, c.retryPolicy(), func() error {
 		request := &nextdns.DeleteRewritesRequest{
 			ProfileID: c.profileID,
 			ID:        id,
 		}
 
-		return c.api.Rewrites.Delete(ctx, request)
+		if err := c.rate.wait(ctx); err != nil {
+			return err
+		}
+		reqCtx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		deleteErr := c.api.Rewrites.Delete(reqCtx, request)
+		c.deleteLimit.observe(deleteErr)
+		return deleteErr
 	}, "DeleteRewrite")
+	c.list.invalidate()
 
 	if err != nil {
-		return fmt.Errorf("failed to delete rewrite: %w", err)
+		// A missing ID means the index is out of date with the profile
+		if isNotFoundError(err) {
+			c.index.invalidate()
+		}
+		return fmt.Errorf("failed to delete rewrite: %w", classifyAPIError(err, ErrRecordNotFound))
 	}
+	c.index.remove(id)
 
-	slog.Info("Successfully deleted DNS rewrite", "id", id)
+	slog.InfoContext(ctx, "Successfully deleted DNS rewrite", "id", id)
 	return nil
 }
 
+// lookupRewrites returns the rewrites with the given name and type from the
+// index, listing the profile first if the index is invalid
+func (c *Client) lookupRewrites(ctx context.Context, name, recordType string) ([]*nextdns.Rewrites, error) {
+	if rewrites, ok := c.index.lookup(name, recordType); ok {
+		return rewrites, nil
+	}
+	rewrites, err := c.ListRewrites(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s %s: %w", recordType, name, err)
+	}
+	return slices.DeleteFunc(slices.Clone(rewrites), func(rewrite *nextdns.Rewrites) bool {
+		return indexKey(rewrite.Name, rewrite.Type) != indexKey(name, recordType)
+	}), nil
+}
+
+// IndexedRewrites returns every rewrite in the profile from the index,
+// listing the profile first if the index is invalid. Within one sync this
+// reuses the listing Records made instead of fetching it again.
+func (c *Client) IndexedRewrites(ctx context.Context) ([]*nextdns.Rewrites, error) {
+	if rewrites, ok := c.index.all(); ok {
+		return rewrites, nil
+	}
+	return c.ListRewrites(ctx)
+}
+
 // FindRewriteByName finds a DNS rewrite by its name and type
-// Returns the rewrite and true if found, nil and false if not found
+// Names are compared case-insensitively, as DNS names are
+// Returns the rewrite and true if found, nil and false if not found.
+// A failed lookup always returns an error, so (nil, false, nil) reliably
+// means the record is absent.
 func (c *Client) FindRewriteByName(ctx context.Context, name, recordType string) (*nextdns.Rewrites, bool, error) {
-	slog.Debug("Finding DNS rewrite by name",
+	slog.DebugContext(ctx, "Finding DNS rewrite by name",
 		"name", name,
 		"type", recordType)
 
-	rewrites, err := c.ListRewrites(ctx)
+	rewrites, err := c.lookupRewrites(ctx, name, recordType)
 	if err != nil {
 		return nil, false, err
 	}
 
 	for _, rewrite := range rewrites {
-		if rewrite.Name == name && rewrite.Type == recordType {
-			slog.Debug("Found matching DNS rewrite",
+		if strings.EqualFold(rewrite.Name, name) && rewrite.Type == recordType {
+			slog.DebugContext(ctx, "Found matching DNS rewrite",
 				"id", rewrite.ID,
 				"name", rewrite.Name,
 				"type", rewrite.Type,
@@ -324,18 +634,42 @@ func (c *Client) FindRewriteByName(ctx context.Context, name, recordType string)
 		}
 	}
 
-	slog.Debug("No matching DNS rewrite found",
+	slog.DebugContext(ctx, "No matching DNS rewrite found",
 		"name", name,
 		"type", recordType)
 
 	return nil, false, nil
 }
 
+// FindRewriteByContent finds the DNS rewrite with the given name, type and
+// content. Content is compared case-insensitively and ignoring a trailing
+// dot, so a host name target matches however NextDNS stored it. Like
+// FindRewriteByName, (nil, false, nil) reliably means the record is absent.
+func (c *Client) FindRewriteByContent(ctx context.Context, name, recordType, content string) (*nextdns.Rewrites, bool, error) {
+	slog.DebugContext(ctx, "Finding DNS rewrite by content",
+		"name", name,
+		"type", recordType,
+		"content", content)
+
+	rewrites, err := c.lookupRewrites(ctx, name, recordType)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, rewrite := range rewrites {
+		if strings.EqualFold(rewrite.Name, name) && rewrite.Type == recordType &&
+			strings.EqualFold(strings.TrimSuffix(rewrite.Content, "."), strings.TrimSuffix(content, ".")) {
+			return rewrite, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
 // UpdateRewrite updates a DNS rewrite by deleting the old one and creating a new one
 // NextDNS API does not have a native update endpoint, so we use delete + create
 // Note: Both DeleteRewrite and CreateRewrite have their own retry logic
 func (c *Client) UpdateRewrite(ctx context.Context, id, name, recordType, content string) (string, error) {
-	slog.Debug("Updating DNS rewrite",
+	slog.DebugContext(ctx, "Updating DNS rewrite",
 		"id", id,
 		"name", name,
 		"type", recordType,
@@ -352,7 +686,39 @@ func (c *Client) UpdateRewrite(ctx context.Context, id, name, recordType, conten
 		return "", fmt.Errorf("failed to create new rewrite during update: %w", err)
 	}
 
-	slog.Info("Successfully updated DNS rewrite",
+	slog.InfoContext(ctx, "Successfully updated DNS rewrite",
+		"old_id", id,
+		"new_id", newID,
+		"name", name)
+
+	return newID, nil
+}
+
+// UpdateRewriteAtomic replaces a DNS rewrite by creating the new one before
+// deleting the old one, so the name keeps resolving throughout and a crash
+// mid-update leaves both rewrites rather than neither. If the old rewrite
+// can't be deleted, the new one is deleted again so the profile is left as
+// it was. An old rewrite that is already gone counts as deleted.
+func (c *Client) UpdateRewriteAtomic(ctx context.Context, id, name, recordType, content string) (string, error) {
+	slog.DebugContext(ctx, "Updating DNS rewrite (create before delete)",
+		"id", id,
+		"name", name,
+		"type", recordType,
+		"new_content", content)
+
+	newID, err := c.CreateRewrite(ctx, name, recordType, content)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new rewrite during update: %w", err)
+	}
+
+	if err := c.DeleteRewrite(ctx, id); err != nil && !errors.Is(err, ErrRecordNotFound) {
+		if rollbackErr := c.DeleteRewrite(ctx, newID); rollbackErr != nil {
+			return "", fmt.Errorf("failed to delete old rewrite %s during update (%w), and failed to roll back new rewrite %s: %w", id, err, newID, rollbackErr)
+		}
+		return "", fmt.Errorf("failed to delete old rewrite during update, rolled back: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Successfully updated DNS rewrite",
 		"old_id", id,
 		"new_id", newID,
 		"name", name)
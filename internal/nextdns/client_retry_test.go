@@ -3,8 +3,19 @@ package nextdns
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 )
 
 // TestRetryWithBackoff_SuccessNoRetry tests that successful operations do not retry
@@ -12,7 +23,7 @@ func TestRetryWithBackoff_SuccessNoRetry(t *testing.T) {
 	ctx := context.Background()
 	callCount := 0
 
-	err := retryWithBackoff(ctx, func() error {
+	err := retryWithBackoff(ctx, defaultRetryPolicy, func() error {
 		callCount++
 		return nil // Success on first call
 	}, "TestOperation")
@@ -27,15 +38,13 @@ func TestRetryWithBackoff_SuccessNoRetry(t *testing.T) {
 
 // TestRetryWithBackoff_RetryOn5xxEventualSuccess tests retry on 5xx errors with eventual success
 func TestRetryWithBackoff_RetryOn5xxEventualSuccess(t *testing.T) {
-	// Override retry delays for faster tests
-	originalDelays := retryDelays
-	retryDelays = []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
-	defer func() { retryDelays = originalDelays }()
+	// Short delays for faster tests
+	policy := retryPolicy{maxRetries: 3, baseDelay: 10 * time.Millisecond}
 
 	ctx := context.Background()
 	callCount := 0
 
-	err := retryWithBackoff(ctx, func() error {
+	err := retryWithBackoff(ctx, policy, func() error {
 		callCount++
 		if callCount < 3 {
 			// Fail with 500 error on first two calls
@@ -54,16 +63,14 @@ func TestRetryWithBackoff_RetryOn5xxEventualSuccess(t *testing.T) {
 
 // TestRetryWithBackoff_ExhaustedRetries tests that all retries are exhausted on persistent errors
 func TestRetryWithBackoff_ExhaustedRetries(t *testing.T) {
-	// Override retry delays for faster tests
-	originalDelays := retryDelays
-	retryDelays = []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
-	defer func() { retryDelays = originalDelays }()
+	// Short delays for faster tests
+	policy := retryPolicy{maxRetries: 3, baseDelay: 10 * time.Millisecond}
 
 	ctx := context.Background()
 	callCount := 0
 	serverError := errors.New("API error: 502 Bad Gateway")
 
-	err := retryWithBackoff(ctx, func() error {
+	err := retryWithBackoff(ctx, policy, func() error {
 		callCount++
 		return serverError
 	}, "TestOperation")
@@ -96,7 +103,7 @@ func TestRetryWithBackoff_NoRetryOn4xx(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			callCount = 0
 
-			err := retryWithBackoff(ctx, func() error {
+			err := retryWithBackoff(ctx, defaultRetryPolicy, func() error {
 				callCount++
 				return errors.New(tc.error)
 			}, "TestOperation")
@@ -145,6 +152,14 @@ func TestIsRetryableError(t *testing.T) {
 
 		// Unknown errors (not retryable by default)
 		{"unknown error", errors.New("some random error"), false},
+
+		// Typed API errors are classified by status code, whatever the message says
+		{"typed 503, wrapped", fmt.Errorf("failed to list rewrites: %w", &APIError{StatusCode: 503, Err: errors.New("upstream hiccup")}), true},
+		{"typed 429", &APIError{StatusCode: 429, Err: errors.New("slow down")}, true},
+		{"typed 400 mentioning 500", &APIError{StatusCode: 400, Err: errors.New("name exceeds 500 characters")}, false},
+		{"typed 404 mentioning a timeout", &APIError{StatusCode: 404, Err: errors.New("profile timeout-test not found")}, false},
+		{"SDK 5xx", &nextdns.Error{Type: nextdns.ErrorTypeServiceError, Meta: map[string]string{"http_status": "Bad Gateway"}}, true},
+		{"SDK 403", &nextdns.Error{Type: nextdns.ErrorTypeAuthentication, Errors: &nextdns.ErrorResponse{}, Meta: map[string]string{"http_status": "Forbidden"}}, false},
 	}
 
 	for _, tc := range testCases {
@@ -157,12 +172,92 @@ func TestIsRetryableError(t *testing.T) {
 	}
 }
 
+// TestRetryPolicy_Delay tests that delays double from the base delay
+func TestRetryPolicy_Delay(t *testing.T) {
+	if got := defaultRetryPolicy.maxRetries; got != 3 {
+		t.Errorf("default retries = %d, want 3", got)
+	}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := defaultRetryPolicy.delay(attempt); got != want {
+			t.Errorf("default delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	policy := retryPolicy{maxRetries: 5, baseDelay: 250 * time.Millisecond}
+	if got := policy.delay(4); got != 4*time.Second {
+		t.Errorf("delay(4) = %v, want 4s", got)
+	}
+}
+
+// TestRetryPolicy_Jitter tests that jittered waits stay between 0 and the
+// delay and actually vary
+func TestRetryPolicy_Jitter(t *testing.T) {
+	policy := retryPolicy{maxRetries: 3, baseDelay: 100 * time.Millisecond, jitter: true}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 50; i++ {
+			wait := policy.wait(attempt)
+			if wait < 0 || wait > policy.delay(attempt) {
+				t.Fatalf("wait(%d) = %v, want between 0 and %v", attempt, wait, policy.delay(attempt))
+			}
+			seen[wait] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("wait(%d) returned the same duration 50 times, want jittered waits", attempt)
+		}
+	}
+
+	policy.jitter = false
+	if got := policy.wait(2); got != 400*time.Millisecond {
+		t.Errorf("wait(2) without jitter = %v, want 400ms", got)
+	}
+}
+
+// TestRetryWithBackoff_Jitter tests that jittered retries wait no longer
+// than the unjittered delays
+func TestRetryWithBackoff_Jitter(t *testing.T) {
+	policy := retryPolicy{maxRetries: 3, baseDelay: 20 * time.Millisecond, jitter: true}
+	callCount := 0
+
+	start := time.Now()
+	err := retryWithBackoff(context.Background(), policy, func() error {
+		callCount++
+		return errors.New("API error: 503 Service Unavailable")
+	}, "TestOperation")
+
+	if err == nil {
+		t.Error("retryWithBackoff() expected error, got nil")
+	}
+	if callCount != 4 {
+		t.Errorf("retryWithBackoff() called operation %d times, expected 4", callCount)
+	}
+	// The waits are at most 20ms, 40ms and 80ms; allow scheduling slack
+	if elapsed := time.Since(start); elapsed > 140*time.Millisecond+time.Second {
+		t.Errorf("retryWithBackoff() took %v, want at most the 140ms of unjittered delays", elapsed)
+	}
+}
+
+// TestRetryWithBackoff_ZeroRetries tests that a policy without retries fails fast
+func TestRetryWithBackoff_ZeroRetries(t *testing.T) {
+	callCount := 0
+	err := retryWithBackoff(context.Background(), retryPolicy{}, func() error {
+		callCount++
+		return errors.New("API error: 503 Service Unavailable")
+	}, "TestOperation")
+
+	if err == nil {
+		t.Error("retryWithBackoff() expected error, got nil")
+	}
+	if callCount != 1 {
+		t.Errorf("retryWithBackoff() called operation %d times, expected 1", callCount)
+	}
+}
+
 // TestRetryWithBackoff_ContextCancellation tests that context cancellation stops retries
 func TestRetryWithBackoff_ContextCancellation(t *testing.T) {
-	// Override retry delays for faster tests
-	originalDelays := retryDelays
-	retryDelays = []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
-	defer func() { retryDelays = originalDelays }()
+	// Short delays for faster tests
+	policy := retryPolicy{maxRetries: 3, baseDelay: 100 * time.Millisecond}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	callCount := 0
@@ -173,7 +268,7 @@ func TestRetryWithBackoff_ContextCancellation(t *testing.T) {
 		cancel()
 	}()
 
-	err := retryWithBackoff(ctx, func() error {
+	err := retryWithBackoff(ctx, policy, func() error {
 		callCount++
 		return errors.New("API error: 500 Internal Server Error")
 	}, "TestOperation")
@@ -191,3 +286,142 @@ func TestRetryWithBackoff_ContextCancellation(t *testing.T) {
 		t.Errorf("retryWithBackoff() called operation %d times, expected at most 2 due to cancellation", callCount)
 	}
 }
+
+// TestIsNotFoundError tests detection of NextDNS not-found errors through wrapping
+func TestIsNotFoundError(t *testing.T) {
+	notFound := &nextdns.Error{Type: nextdns.ErrorTypeNotFound, Message: "response error received", Errors: &nextdns.ErrorResponse{}}
+	authErr := &nextdns.Error{Type: nextdns.ErrorTypeAuthentication, Message: "response error received", Errors: &nextdns.ErrorResponse{}}
+
+	testCases := []struct {
+		name  string
+		error error
+		want  bool
+	}{
+		{"nil error", nil, false},
+		{"not found", notFound, true},
+		{"wrapped not found", fmt.Errorf("failed to delete rewrite: %w", notFound), true},
+		{"authentication error", authErr, false},
+		{"plain error", errors.New("404 Not Found"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isNotFoundError(tc.error); got != tc.want {
+				t.Errorf("isNotFoundError(%v) = %v, want %v", tc.error, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRetryWithBackoff_Metrics tests that attempts are counted and retry waits observed
+func TestRetryWithBackoff_Metrics(t *testing.T) {
+	// Short delays for faster tests
+	policy := retryPolicy{maxRetries: 3, baseDelay: 10 * time.Millisecond}
+
+	// A unique operation name keeps the series independent of other tests
+	operation := "TestMetricsOperation"
+	callCount := 0
+
+	err := retryWithBackoff(context.Background(), policy, func() error {
+		callCount++
+		if callCount < 3 {
+			return errors.New("API error: 503 Service Unavailable")
+		}
+		return nil
+	}, operation)
+	if err != nil {
+		t.Fatalf("retryWithBackoff() unexpected error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.APIAttempts.WithLabelValues(operation)); got != 3 {
+		t.Errorf("attempts = %v, want 3", got)
+	}
+
+	histogram := &dto.Metric{}
+	if err := metrics.RetryBackoff.WithLabelValues(operation).(prometheus.Histogram).Write(histogram); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	if got := histogram.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("backoff observations = %d, want 2 (one per retry)", got)
+	}
+	// The two waits were 10ms and 20ms
+	if got := histogram.GetHistogram().GetSampleSum(); got < 0.03 {
+		t.Errorf("backoff total = %vs, want at least 0.03s", got)
+	}
+}
+
+// TestRetryWithBackoff_ErrorAndLatencyMetrics tests that every attempt's
+// duration is observed and failed attempts are counted by status class
+func TestRetryWithBackoff_ErrorAndLatencyMetrics(t *testing.T) {
+	policy := retryPolicy{maxRetries: 3, baseDelay: time.Millisecond}
+
+	// A unique operation name keeps the series independent of other tests
+	operation := "TestErrorMetricsOperation"
+	attemptErrors := []error{
+		&nextdns.Error{Type: nextdns.ErrorTypeServiceError, Message: "internal service error received"},
+		errors.New("dial tcp: connection refused"),
+		&nextdns.Error{Type: nextdns.ErrorTypeRequest, Message: "response error received", Errors: &nextdns.ErrorResponse{}},
+	}
+	callCount := 0
+
+	err := retryWithBackoff(context.Background(), policy, func() error {
+		callCount++
+		return attemptErrors[callCount-1]
+	}, operation)
+	if err == nil {
+		t.Fatal("retryWithBackoff() expected error, got nil")
+	}
+	if callCount != 3 {
+		t.Fatalf("retryWithBackoff() called operation %d times, expected 3", callCount)
+	}
+
+	for _, class := range []string{"5xx", "network", "4xx"} {
+		if got := testutil.ToFloat64(metrics.APIErrors.WithLabelValues(operation, class)); got != 1 {
+			t.Errorf("%s errors = %v, want 1", class, got)
+		}
+	}
+
+	histogram := &dto.Metric{}
+	if err := metrics.APIRequestDuration.WithLabelValues(operation).(prometheus.Histogram).Write(histogram); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	if got := histogram.GetHistogram().GetSampleCount(); got != 3 {
+		t.Errorf("duration observations = %d, want 3 (one per attempt)", got)
+	}
+}
+
+// TestClient_APITimeout verifies that a hung API request is cut off by the
+// client's timeout and retried, even though the caller's context has no
+// deadline
+func TestClient_APITimeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	client, err := NewClient("test-key", "test-profile", server.URL)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.timeout = 50 * time.Millisecond
+	client.retry = &retryPolicy{maxRetries: 1, baseDelay: time.Millisecond}
+
+	start := time.Now()
+	_, err = client.ListRewrites(context.Background())
+	if err == nil {
+		t.Fatal("ListRewrites() succeeded against a hung API, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ListRewrites() took %v, want it bounded by the timeout", elapsed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("API calls = %d, want 2 (timed-out request retried once)", got)
+	}
+}
@@ -2,8 +2,14 @@ package nextdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/amalucelli/nextdns-go/nextdns"
 )
@@ -30,6 +36,20 @@ func TestNewClient(t *testing.T) {
 			baseURL:   "https://custom.nextdns.io",
 			wantErr:   false,
 		},
+		{
+			name:      "base URL with path prefix",
+			apiKey:    "test-api-key",
+			profileID: "test-profile",
+			baseURL:   "https://proxy.example.com/nextdns/",
+			wantErr:   false,
+		},
+		{
+			name:      "relative base URL",
+			apiKey:    "test-api-key",
+			profileID: "test-profile",
+			baseURL:   "api.nextdns.io",
+			wantErr:   true,
+		},
 		{
 			name:      "empty API key",
 			apiKey:    "",
@@ -89,17 +109,24 @@ func TestClientFields(t *testing.T) {
 type mockRewritesService struct {
 	rewrites []*nextdns.Rewrites
 	listErr  error
+
+	// created records every rewrite passed to Create, in call order
+	created []*nextdns.Rewrites
+	// deleted records every ID passed to Delete, in call order
+	deleted []string
 }
 
 func (m *mockRewritesService) List(_ context.Context, _ *nextdns.ListRewritesRequest) ([]*nextdns.Rewrites, error) {
 	return m.rewrites, m.listErr
 }
 
-func (m *mockRewritesService) Create(_ context.Context, _ *nextdns.CreateRewritesRequest) (string, error) {
-	return "", nil
+func (m *mockRewritesService) Create(_ context.Context, request *nextdns.CreateRewritesRequest) (string, error) {
+	m.created = append(m.created, request.Rewrites)
+	return fmt.Sprintf("created-%d", len(m.created)), nil
 }
 
-func (m *mockRewritesService) Delete(_ context.Context, _ *nextdns.DeleteRewritesRequest) error {
+func (m *mockRewritesService) Delete(_ context.Context, request *nextdns.DeleteRewritesRequest) error {
+	m.deleted = append(m.deleted, request.ID)
 	return nil
 }
 
@@ -141,6 +168,16 @@ func TestFindRewriteByName(t *testing.T) {
 			},
 			wantFound: false,
 		},
+		{
+			name:       "case-insensitive name match",
+			searchName: "Test.Example.COM",
+			searchType: "A",
+			rewrites: []*nextdns.Rewrites{
+				{ID: "1", Name: "test.example.com", Type: "A", Content: "192.168.1.1"},
+			},
+			wantFound:   true,
+			wantContent: "192.168.1.1",
+		},
 		{
 			name:       "wrong type",
 			searchName: "test.example.com",
@@ -204,3 +241,228 @@ func TestFindRewriteByName(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateRewrite_ValidatesReturnedID(t *testing.T) {
+	tests := []struct {
+		name      string
+		createdID func(id string) string
+		wantErr   bool
+	}{
+		{name: "valid ID", createdID: nil, wantErr: false},
+		{name: "empty ID", createdID: func(string) string { return "" }, wantErr: true},
+		{name: "whitespace ID", createdID: func(string) string { return "  " }, wantErr: true},
+		{name: "ID with path separator", createdID: func(string) string { return "abc/def" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.createdID = tt.createdID
+
+			id, err := fake.client().CreateRewrite(context.Background(), "web.example.com", "A", "10.0.0.1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "invalid ID") {
+					t.Errorf("CreateRewrite() error = %v, want it to mention the invalid ID", err)
+				}
+				if id != "" {
+					t.Errorf("CreateRewrite() id = %q, want empty on error", id)
+				}
+				return
+			}
+			if id == "" {
+				t.Error("CreateRewrite() returned an empty ID without error")
+			}
+		})
+	}
+}
+
+func TestVerifyRewrite_EventualConsistency(t *testing.T) {
+	tests := []struct {
+		name      string
+		hidden    int
+		wantErr   error
+		wantLists int
+	}{
+		{name: "listed immediately", hidden: 0, wantLists: 1},
+		{name: "listed on the second check", hidden: 1, wantLists: 2},
+		{name: "never listed within the attempts", hidden: 3, wantErr: ErrWriteNotVisible, wantLists: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.hideCreatedLists = tt.hidden
+			client := fake.client()
+
+			id, err := client.CreateRewrite(context.Background(), "web.example.com", "A", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("CreateRewrite() error = %v", err)
+			}
+
+			err = client.VerifyRewrite(context.Background(), id, "web.example.com", 3, time.Millisecond)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyRewrite() error = %v, want %v", err, tt.wantErr)
+			}
+			if fake.listCalls != tt.wantLists {
+				t.Errorf("list calls = %d, want %d", fake.listCalls, tt.wantLists)
+			}
+
+			// A lagging listing must not drop the new rewrite from the index
+			if _, found, _ := client.FindRewriteByName(context.Background(), "web.example.com", "A"); !found {
+				t.Error("created rewrite missing from the index after verification")
+			}
+		})
+	}
+}
+
+func TestUpdateRewriteAtomic(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(f *fakeNextDNS, oldID string)
+		wantErr     bool
+		wantContent []string
+	}{
+		{
+			name:        "replaces the old rewrite",
+			wantContent: []string{"10.0.0.2"},
+		},
+		{
+			name:        "old rewrite already gone",
+			setup:       func(f *fakeNextDNS, oldID string) { f.removeLocked(oldID) },
+			wantContent: []string{"10.0.0.2"},
+		},
+		{
+			name:        "failed delete rolls back the new rewrite",
+			setup:       func(f *fakeNextDNS, oldID string) { f.rejectDeleteID = oldID },
+			wantErr:     true,
+			wantContent: []string{"10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			oldID := fake.add("web.example.com", "10.0.0.1")
+			if tt.setup != nil {
+				tt.setup(fake, oldID)
+			}
+
+			newID, err := fake.client().UpdateRewriteAtomic(context.Background(), oldID, "web.example.com", "A", "10.0.0.2")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateRewriteAtomic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (newID == "" || newID == oldID) {
+				t.Errorf("UpdateRewriteAtomic() id = %q, want a new ID", newID)
+			}
+
+			var contents []string
+			for _, record := range fake.records() {
+				contents = append(contents, record.Content)
+			}
+			if !slices.Equal(contents, tt.wantContent) {
+				t.Errorf("records after update = %v, want %v", contents, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestTestConnection_Mode(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		wantList     int
+		wantSettings int
+	}{
+		{name: "list mode lists rewrites", mode: ConnectionTestList, wantList: 1, wantSettings: 0},
+		{name: "light mode fetches settings", mode: ConnectionTestLight, wantList: 0, wantSettings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+
+			if err := fake.client().TestConnection(context.Background(), tt.mode); err != nil {
+				t.Fatalf("TestConnection() error = %v", err)
+			}
+
+			if fake.listCalls != tt.wantList {
+				t.Errorf("list calls = %d, want %d", fake.listCalls, tt.wantList)
+			}
+			if fake.settingsCalls != tt.wantSettings {
+				t.Errorf("settings calls = %d, want %d", fake.settingsCalls, tt.wantSettings)
+			}
+		})
+	}
+}
+
+func TestTestConnection_LightModeWrongProfile(t *testing.T) {
+	fake := newFakeNextDNS(t)
+
+	client, err := NewClient("test-key", "other-profile", fake.server.URL)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	if err := client.TestConnection(context.Background(), ConnectionTestLight); err == nil {
+		t.Error("TestConnection() error = nil, want failure for an unknown profile")
+	}
+}
+
+func TestNormalizeBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{name: "host only", baseURL: "https://api.nextdns.io", want: "https://api.nextdns.io/"},
+		{name: "trailing slash kept", baseURL: "https://api.nextdns.io/", want: "https://api.nextdns.io/"},
+		{name: "path prefix gains slash", baseURL: "http://localhost:8080/proxy/nextdns", want: "http://localhost:8080/proxy/nextdns/"},
+		{name: "repeated trailing slashes collapse", baseURL: "http://localhost:8080/proxy//", want: "http://localhost:8080/proxy/"},
+		{name: "surrounding whitespace", baseURL: " https://api.nextdns.io ", want: "https://api.nextdns.io/"},
+		{name: "missing scheme", baseURL: "api.nextdns.io", wantErr: true},
+		{name: "unsupported scheme", baseURL: "ftp://api.nextdns.io", wantErr: true},
+		{name: "query string", baseURL: "https://api.nextdns.io/?x=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeBaseURL(tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeBaseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeBaseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClient_BaseURLPathPrefix(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+
+	// Serve the fake API under a path prefix, as a reverse proxy would
+	proxy := httptest.NewServer(http.StripPrefix("/proxy/nextdns", fake.server.Config.Handler))
+	t.Cleanup(proxy.Close)
+
+	for _, baseURL := range []string{proxy.URL + "/proxy/nextdns", proxy.URL + "/proxy/nextdns/"} {
+		t.Run(baseURL, func(t *testing.T) {
+			client, err := NewClient("test-key", fake.profileID, baseURL)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			rewrites, err := client.ListRewrites(context.Background())
+			if err != nil {
+				t.Fatalf("ListRewrites() error = %v", err)
+			}
+			if len(rewrites) != 1 || rewrites[0].Name != "web.example.com" {
+				t.Errorf("ListRewrites() = %v, want web.example.com", rewrites)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package nextdns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// recordCodec converts between an external-dns target and the content of a
+// NextDNS rewrite for one record type
+type recordCodec interface {
+	// encode validates an endpoint target and returns the rewrite content
+	encode(target string) (string, error)
+	// decode turns rewrite content back into an endpoint target
+	decode(content string) (string, error)
+}
+
+// recordCodecs holds the codec for each record type NextDNS rewrites can
+// store; see implementedRecordTypes
+var recordCodecs = map[string]recordCodec{
+	endpoint.RecordTypeA:     ipCodec{v6: false},
+	endpoint.RecordTypeAAAA:  ipCodec{v6: true},
+	endpoint.RecordTypeCNAME: hostCodec{},
+}
+
+// codecFor returns the codec registered for recordType
+func codecFor(recordType string) (recordCodec, error) {
+	codec, ok := recordCodecs[strings.ToUpper(recordType)]
+	if !ok {
+		return nil, fmt.Errorf("no content codec registered for record type %q", recordType)
+	}
+	return codec, nil
+}
+
+// ipCodec handles A (IPv4) and AAAA (IPv6) addresses
+type ipCodec struct {
+	v6 bool
+}
+
+func (c ipCodec) encode(target string) (string, error) {
+	ip := net.ParseIP(target)
+	if ip == nil || (ip.To4() != nil) == c.v6 {
+		family := "IPv4"
+		if c.v6 {
+			family = "IPv6"
+		}
+		return "", fmt.Errorf("%q is not an %s address", target, family)
+	}
+	return target, nil
+}
+
+func (c ipCodec) decode(content string) (string, error) {
+	return c.encode(content)
+}
+
+// hostCodec handles CNAME targets, which are host names. Targets written
+// to NextDNS must be well-formed; content read back is only checked loosely
+// so a rewrite created elsewhere is still reported.
+type hostCodec struct{}
+
+func (hostCodec) encode(target string) (string, error) {
+	if !isHostName(target) {
+		return "", fmt.Errorf("%q is not a host name", target)
+	}
+	return target, nil
+}
+
+func (hostCodec) decode(content string) (string, error) {
+	if strings.TrimSuffix(content, ".") == "" || strings.ContainsAny(content, " \t") {
+		return "", fmt.Errorf("%q is not a host name", content)
+	}
+	return content, nil
+}
+
+// isHostName reports whether name is a DNS host name: at most 253
+// characters of dot-separated labels of 1 to 63 letters, digits, hyphens
+// and underscores, no label starting or ending with a hyphen. One trailing
+// dot is allowed.
+func isHostName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// encodeTarget converts an endpoint target into rewrite content
+func encodeTarget(recordType, target string) (string, error) {
+	codec, err := codecFor(recordType)
+	if err != nil {
+		return "", err
+	}
+	content, err := codec.encode(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s target: %w", recordType, err)
+	}
+	return content, nil
+}
+
+// decodeContent converts rewrite content into an endpoint target
+func decodeContent(recordType, content string) (string, error) {
+	codec, err := codecFor(recordType)
+	if err != nil {
+		return "", err
+	}
+	target, err := codec.decode(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s content: %w", recordType, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,84 @@
+package nextdns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordCodecs_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		recordType  string
+		target      string
+		wantContent string
+	}{
+		{"A", "A", "192.168.1.1", "192.168.1.1"},
+		{"AAAA", "AAAA", "2001:db8::1", "2001:db8::1"},
+		{"CNAME", "CNAME", "target.example.com", "target.example.com"},
+		{"lowercase type", "cname", "target.example.com", "target.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := encodeTarget(tt.recordType, tt.target)
+			if err != nil {
+				t.Fatalf("encodeTarget() error = %v", err)
+			}
+			if content != tt.wantContent {
+				t.Errorf("encodeTarget() = %q, want %q", content, tt.wantContent)
+			}
+
+			target, err := decodeContent(tt.recordType, content)
+			if err != nil {
+				t.Fatalf("decodeContent() error = %v", err)
+			}
+			again, err := encodeTarget(tt.recordType, target)
+			if err != nil {
+				t.Fatalf("encodeTarget() of decoded target error = %v", err)
+			}
+			if again != content {
+				t.Errorf("round trip changed content: %q -> %q -> %q", content, target, again)
+			}
+		})
+	}
+}
+
+func TestRecordCodecs_InvalidTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		target     string
+	}{
+		{"A with IPv6", "A", "2001:db8::1"},
+		{"A with hostname", "A", "example.com"},
+		{"AAAA with IPv4", "AAAA", "192.168.1.1"},
+		{"empty CNAME", "CNAME", ""},
+		{"CNAME with empty label", "CNAME", "lb..example.com"},
+		{"CNAME with invalid character", "CNAME", "lb/1.example.com"},
+		{"CNAME label starting with hyphen", "CNAME", "-lb.example.com"},
+		{"CNAME label too long", "CNAME", strings.Repeat("a", 64) + ".example.com"},
+		{"CNAME with IP and port", "CNAME", "10.0.0.1:80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encodeTarget(tt.recordType, tt.target); err == nil {
+				t.Errorf("encodeTarget(%q, %q) expected error", tt.recordType, tt.target)
+			}
+		})
+	}
+}
+
+func TestCodecFor_UnregisteredType(t *testing.T) {
+	_, err := codecFor("MX")
+	if err == nil {
+		t.Fatal("codecFor() expected error for unregistered type")
+	}
+	if !strings.Contains(err.Error(), `"MX"`) {
+		t.Errorf("error %q should name the record type", err)
+	}
+
+	if _, err := decodeContent("MX", "10 mail.example.com"); err == nil {
+		t.Error("decodeContent() expected error for unregistered type")
+	}
+}
@@ -0,0 +1,129 @@
+package nextdns
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// forEachLimit calls fn for every item with at most limit calls in flight.
+// A limit of 1 or less processes items sequentially, in order. The first
+// error is returned; once it occurs no further calls are started, but calls
+// already in flight are allowed to finish.
+func forEachLimit[T any](ctx context.Context, limit int, items []T, fn func(ctx context.Context, item T) error) error {
+	if limit <= 1 {
+		for _, item := range items {
+			if err := fn(ctx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return forEachAdaptive(ctx, func() int { return limit }, items, fn)
+}
+
+// forEachAdaptive is forEachLimit with a limit that may change while items
+// are processed: limit is consulted before each call is started, so a lower
+// value takes effect as calls in flight finish.
+func forEachAdaptive[T any](ctx context.Context, limit func() int, items []T, fn func(ctx context.Context, item T) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		inflight int
+		firstErr error
+	)
+	done := sync.NewCond(&mu)
+
+	for _, item := range items {
+		mu.Lock()
+		for firstErr == nil && inflight >= max(limit(), 1) {
+			done.Wait()
+		}
+		if firstErr != nil {
+			mu.Unlock()
+			break
+		}
+		inflight++
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(item T) {
+			defer wg.Done()
+
+			err := fn(ctx, item)
+
+			mu.Lock()
+			inflight--
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			done.Broadcast()
+		}(item)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// adaptiveLimit is a concurrency limit that adjusts to NextDNS rate limiting
+// (additive increase, multiplicative decrease): each rate-limited call halves
+// it, and it grows by one after a full limit's worth of calls succeed without
+// one, never exceeding the configured maximum. A nil *adaptiveLimit ignores
+// results.
+type adaptiveLimit struct {
+	mu        sync.Mutex
+	limit     int
+	current   int
+	successes int
+	gauge     prometheus.Gauge
+}
+
+// newAdaptiveLimit creates a limit starting at (and capped to) limit,
+// reporting its current value to gauge
+func newAdaptiveLimit(limit int, gauge prometheus.Gauge) *adaptiveLimit {
+	limit = max(limit, 1)
+	gauge.Set(float64(limit))
+	return &adaptiveLimit{limit: limit, current: limit, gauge: gauge}
+}
+
+// get returns the current limit
+func (l *adaptiveLimit) get() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current
+}
+
+// observe adjusts the limit after an API call: err is the call's result.
+// Failures other than rate limiting say nothing about load and are ignored.
+func (l *adaptiveLimit) observe(err error) {
+	if l == nil || (err != nil && !isRateLimitError(err)) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err != nil {
+		l.current = max(l.current/2, 1)
+		l.successes = 0
+	} else if l.current < l.limit {
+		l.successes++
+		if l.successes >= l.current {
+			l.current++
+			l.successes = 0
+		}
+	}
+	l.gauge.Set(float64(l.current))
+}
+
+// forEachEndpoint runs fn over endpoints with at most limit's current value
+// in flight, or configured when there is no adaptive limit
+func forEachEndpoint(ctx context.Context, limit *adaptiveLimit, configured int, endpoints []*endpoint.Endpoint, fn func(ctx context.Context, ep *endpoint.Endpoint) error) error {
+	if limit == nil {
+		return forEachLimit(ctx, configured, endpoints, fn)
+	}
+	return forEachAdaptive(ctx, limit.get, endpoints, fn)
+}
@@ -0,0 +1,200 @@
+package nextdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// inflightRewritesService is a concurrency-safe RewritesService that records
+// the peak number of Create and Delete calls in flight at once.
+type inflightRewritesService struct {
+	rewrites []*nextdns.Rewrites
+	delay    time.Duration
+
+	// rateLimited rejects this many Create calls with a 429 before accepting any
+	rateLimited int
+
+	mu                       sync.Mutex
+	creating, deleting       int
+	maxCreating, maxDeleting int
+	created                  int
+}
+
+func (m *inflightRewritesService) List(_ context.Context, _ *nextdns.ListRewritesRequest) ([]*nextdns.Rewrites, error) {
+	return m.rewrites, nil
+}
+
+func (m *inflightRewritesService) Create(_ context.Context, _ *nextdns.CreateRewritesRequest) (string, error) {
+	m.mu.Lock()
+	if m.rateLimited > 0 {
+		m.rateLimited--
+		m.mu.Unlock()
+		return "", errors.New("API error: 429 Too Many Requests")
+	}
+	m.creating++
+	m.maxCreating = max(m.maxCreating, m.creating)
+	m.created++
+	id := fmt.Sprintf("created-%d", m.created)
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	m.creating--
+	m.mu.Unlock()
+	return id, nil
+}
+
+func (m *inflightRewritesService) Delete(_ context.Context, _ *nextdns.DeleteRewritesRequest) error {
+	m.mu.Lock()
+	m.deleting++
+	m.maxDeleting = max(m.maxDeleting, m.deleting)
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	m.deleting--
+	m.mu.Unlock()
+	return nil
+}
+
+func TestApplyChanges_ConcurrencyLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		createLimit int
+		deleteLimit int
+	}{
+		{name: "sequential", createLimit: 1, deleteLimit: 1},
+		{name: "creates wider than deletes", createLimit: 4, deleteLimit: 2},
+		{name: "deletes wider than creates", createLimit: 2, deleteLimit: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := &plan.Changes{}
+			var existing []*nextdns.Rewrites
+			for i := 0; i < 10; i++ {
+				changes.Create = append(changes.Create, &endpoint.Endpoint{
+					DNSName: fmt.Sprintf("new-%d.example.com", i), RecordType: "A", Targets: []string{"10.0.0.1"},
+				})
+				name := fmt.Sprintf("old-%d.example.com", i)
+				existing = append(existing, &nextdns.Rewrites{ID: fmt.Sprintf("old-%d", i), Name: name, Type: "A", Content: "10.0.1.1"})
+				changes.Delete = append(changes.Delete, &endpoint.Endpoint{
+					DNSName: name, RecordType: "A", Targets: []string{"10.0.1.1"},
+				})
+			}
+
+			mock := &inflightRewritesService{rewrites: existing, delay: 10 * time.Millisecond}
+			api, _ := nextdns.New(nextdns.WithAPIKey("test-key"))
+			api.Rewrites = mock
+
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:       []string{"A", "AAAA", "CNAME"},
+					ApplyConcurrencyCreate: tt.createLimit,
+					ApplyConcurrencyDelete: tt.deleteLimit,
+				},
+				client: &Client{api: api, profileID: "test-profile"},
+			}
+			provider.warm.Store(true)
+
+			if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+
+			if mock.maxCreating != tt.createLimit {
+				t.Errorf("peak concurrent creates = %d, want %d", mock.maxCreating, tt.createLimit)
+			}
+			if mock.maxDeleting != tt.deleteLimit {
+				t.Errorf("peak concurrent deletes = %d, want %d", mock.maxDeleting, tt.deleteLimit)
+			}
+			if mock.created != len(changes.Create) {
+				t.Errorf("creates = %d, want %d", mock.created, len(changes.Create))
+			}
+		})
+	}
+}
+
+// TestApplyChanges_AdaptiveConcurrency verifies that rate-limited creates
+// halve the effective concurrency and that it climbs back to the configured
+// value once creates succeed again.
+func TestApplyChanges_AdaptiveConcurrency(t *testing.T) {
+	mock := &inflightRewritesService{rateLimited: 2}
+	api, _ := nextdns.New(nextdns.WithAPIKey("test-key"))
+	api.Rewrites = mock
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_apply_concurrency"})
+	limit := newAdaptiveLimit(4, gauge)
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, ApplyConcurrencyCreate: 4},
+		client: &Client{api: api, profileID: "test-profile", createLimit: limit, retry: &retryPolicy{maxRetries: 3, baseDelay: time.Millisecond}},
+	}
+	provider.warm.Store(true)
+
+	creates := func(n int) *plan.Changes {
+		changes := &plan.Changes{}
+		for i := 0; i < n; i++ {
+			changes.Create = append(changes.Create, &endpoint.Endpoint{
+				DNSName: fmt.Sprintf("new-%d.example.com", i), RecordType: "A", Targets: []string{"10.0.0.1"},
+			})
+		}
+		return changes
+	}
+
+	// Two 429s halve the limit twice (4 -> 2 -> 1); the retry that then
+	// succeeds raises it by one
+	if err := provider.ApplyChanges(context.Background(), creates(1)); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if got := limit.get(); got != 2 {
+		t.Errorf("concurrency after rate limiting = %d, want 2", got)
+	}
+	if got := testutil.ToFloat64(gauge); got != 2 {
+		t.Errorf("concurrency gauge after rate limiting = %v, want 2", got)
+	}
+
+	// Without further 429s it recovers to the configured limit, no higher
+	if err := provider.ApplyChanges(context.Background(), creates(20)); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if got := limit.get(); got != 4 {
+		t.Errorf("concurrency after recovery = %d, want 4", got)
+	}
+	if got := testutil.ToFloat64(gauge); got != 4 {
+		t.Errorf("concurrency gauge after recovery = %v, want 4", got)
+	}
+	if mock.maxCreating > 4 {
+		t.Errorf("peak concurrent creates = %d, want at most 4", mock.maxCreating)
+	}
+}
+
+func TestForEachLimit_StopsAfterError(t *testing.T) {
+	var calls atomic.Int32
+	items := make([]int, 50)
+	boom := errors.New("boom")
+
+	err := forEachLimit(context.Background(), 2, items, func(_ context.Context, _ int) error {
+		calls.Add(1)
+		time.Sleep(time.Millisecond)
+		return boom
+	})
+
+	if !errors.Is(err, boom) {
+		t.Fatalf("forEachLimit() error = %v, want %v", err, boom)
+	}
+	if n := calls.Load(); n >= int32(len(items)) {
+		t.Errorf("forEachLimit() made %d calls after an error, want it to stop early", n)
+	}
+}
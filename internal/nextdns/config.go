@@ -2,11 +2,66 @@ package nextdns
 
 import (
 	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// Supported values for Config.NameCase
+const (
+	NameCaseLower    = "lower"
+	NameCasePreserve = "preserve"
+)
+
+// Supported values for Config.LogFormat
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Supported values for Config.ConnectionTestMode
+const (
+	ConnectionTestList  = "list"
+	ConnectionTestLight = "light"
+)
+
+// Supported values for Config.RecordsLimitPolicy
+const (
+	RecordsLimitError    = "error"
+	RecordsLimitTruncate = "truncate"
+)
+
+// Supported values for Config.VerifyCNAMETarget
+const (
+	VerifyCNAMETargetOff   = "off"
+	VerifyCNAMETargetWarn  = "warn"
+	VerifyCNAMETargetError = "error"
+)
+
+// Supported values for Config.CNAMETargetForm
+const (
+	CNAMETargetFormRelative = "relative"
+	CNAMETargetFormAbsolute = "absolute"
+)
+
+// Supported values for Config.QuotaExceededPolicy
+const (
+	QuotaExceededFail        = "fail"
+	QuotaExceededSkipCreates = "skip-creates"
+)
+
+// recordProfiles maps RECORD_PROFILE presets to the record types they
+// enable. Presets only list types NextDNS rewrites can store.
+var recordProfiles = map[string][]string{
+	"minimal":  {"A", "AAAA"},
+	"standard": {"A", "AAAA", "CNAME"},
+}
+
 // Config holds the configuration for the NextDNS provider
 type Config struct {
 	// NextDNS API configuration
@@ -14,50 +69,414 @@ type Config struct {
 	ProfileID string
 	BaseURL   string
 
+	// ConnectionTestMode selects the startup connection check: "list"
+	// (default) lists rewrites, "light" fetches profile settings
+	ConnectionTestMode string
+
+	// WriteCheckEnabled creates and immediately deletes a canary rewrite
+	// named WriteCheckName at startup to verify the API key can write
+	WriteCheckEnabled bool
+	WriteCheckName    string
+
 	// Server configuration
-	ServerPort int
-	HealthPort int
+	ServerPort            int
+	HealthPort            int
+	ServerHost            string        // bind address of the webhook API server
+	HealthHost            string        // bind address of the health server
+	DisableHTTPKeepAlives bool          // close API connections after each response
+	RequestIDHeader       string        // request ID header read and echoed by the webhook API
+	ReadinessInitialDelay time.Duration // /readyz reports not ready until this long after startup
+	MaxConcurrentRequests int           // webhook API requests served at once (0: unlimited)
+	APIReadTimeout        time.Duration // webhook API server read timeout
+	APIWriteTimeout       time.Duration // webhook API server write timeout
+	ShutdownTimeout       time.Duration // time allowed for in-flight requests and flushes on shutdown
 
-	// Domain filtering
-	DomainFilter []string
+	// Domain filtering. A name under an ExcludeDomainFilter domain is
+	// left alone even when it matches DomainFilter. RegexDomainFilter, when
+	// set, replaces DomainFilter with a regular expression on the name.
+	DomainFilter        []string
+	ExcludeDomainFilter []string
+	RegexDomainFilter   string
+
+	// Debug endpoints on the health server, authenticated with DebugToken.
+	// DebugHistorySize is how many applied changes /debug/history keeps.
+	DebugEndpointsEnabled bool
+	DebugToken            string
+	DebugHistorySize      int
 
 	// Behavior configuration
 	DryRun           bool
+	DryRunOutputFile string // dry-run change summary is also written here as JSON
 	LogLevel         string
+	LogFormat        string // "text" (default) or "json"
+	SuppressBanner   bool   // skip the startup banner on stdout
 	SupportedRecords []string
+	RecordProfile    string // preset that supplies SupportedRecords when SUPPORTED_RECORDS is unset
+	NameCase         string // "lower" (default) or "preserve"
+
+	// DefaultRecordType is used for endpoints that arrive without a record
+	// type whose type can't be inferred from their targets (empty: drop them)
+	DefaultRecordType string
+
+	// CNAMETargetQualify, when set, is the base domain that relative
+	// (single-label) CNAME targets are qualified with on create and
+	// stripped back to on read
+	CNAMETargetQualify string
+
+	// CNAMETargetForm is the form CNAME targets are written, read and
+	// compared in: "relative" (default) without a trailing dot, "absolute"
+	// with one, whichever form NextDNS returns
+	CNAMETargetForm string
+
+	// FlattenCNAME replaces CNAMEs at a zone apex (a DomainFilter domain)
+	// with A/AAAA records for the addresses the target resolves to, looked
+	// up via FlattenCNAMEResolver ("host:port", empty: system resolver) and
+	// cached for FlattenCNAMECacheTTL
+	FlattenCNAME         bool
+	FlattenCNAMEResolver string
+	FlattenCNAMECacheTTL time.Duration
+
+	// VerifyCNAMETarget looks up CNAME targets before creating them and, if
+	// they don't resolve, logs a warning ("warn") or fails the create ("error")
+	VerifyCNAMETarget string
+
+	// Retries of failed NextDNS API calls: up to RetryMaxAttempts attempts
+	// in total, counting the first, waiting RetryBaseDelay before the first
+	// retry and doubling it before each further one. RetryJitter randomizes each wait between
+	// 0 and that delay.
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryJitter      bool
+
+	// APITimeout bounds each NextDNS API request (0: no limit beyond the
+	// caller's context)
+	APITimeout time.Duration
+
+	// APIRateLimit caps outbound NextDNS API requests per second, retries
+	// included (0: no limit)
+	APIRateLimit float64
+
+	// CacheTTL is how long a listing of the profile's rewrites is reused
+	// before listing again (0 disables the cache). Creates and deletes
+	// drop the cached listing.
+	CacheTTL time.Duration
+
+	// VerifyWritesAttempts, when above 0, lists the profile after each
+	// create until the new rewrite shows up, up to this many times,
+	// VerifyWritesInterval apart, to ride out NextDNS's eventual consistency
+	VerifyWritesAttempts int
+	VerifyWritesInterval time.Duration
+
+	// Maximum creates, updates and deletes in flight while applying
+	// changes (1 applies them one at a time). ApplyConcurrency bounds
+	// updates, which stay in order per name, and is the default for the
+	// other two.
+	ApplyConcurrency       int
+	ApplyConcurrencyCreate int
+	ApplyConcurrencyDelete int
+
+	// ApplyTypeOrder, when set, applies changes one record type at a time in
+	// this order (unlisted types last) instead of all creates, updates, then
+	// deletes across types
+	ApplyTypeOrder []string
+
+	// ApplyBatchWindow buffers applies for this long and writes them
+	// together (0 disables batching)
+	ApplyBatchWindow time.Duration
+
+	// Records response limit: when more than MaxRecordsReturned endpoints
+	// would be returned (0 disables the limit), RecordsLimitPolicy decides
+	// whether Records fails ("error") or returns the first N ("truncate")
+	MaxRecordsReturned int
+	RecordsLimitPolicy string
+
+	// TXTRegistryEnabled stores the ownership TXT records of external-dns's
+	// txt registry as rewrites in a separate namespace and reports them back
+	TXTRegistryEnabled bool
+
+	// BlockedTargets lists target values that must never be published;
+	// AdjustEndpoints drops endpoints that include one
+	BlockedTargets []string
+
+	// QuotaExceededPolicy decides what happens when NextDNS refuses a create
+	// because the profile's rewrite quota is full: "fail" (default) stops
+	// the batch, "skip-creates" skips the remaining creates but still applies
+	// updates and deletes. Either way the apply returns ErrQuotaExceeded.
+	QuotaExceededPolicy string
+
+	// NoDeleteRecordTypes lists record types whose deletes are always
+	// skipped, even when external-dns plans them
+	NoDeleteRecordTypes []string
+
+	// Deletion safety: refuse batches deleting more than this fraction of
+	// managed records (0 disables the check) unless AllowMassDelete is set
+	MaxDeleteFraction float64
+	AllowMassDelete   bool
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
+	applyConcurrency := getEnvInt("APPLY_CONCURRENCY", 1)
 	config := &Config{
 		APIKey:           getEnv("NEXTDNS_API_KEY", ""),
 		ProfileID:        getEnv("NEXTDNS_PROFILE_ID", ""),
 		BaseURL:          getEnv("NEXTDNS_BASE_URL", "https://api.nextdns.io"),
 		ServerPort:       getEnvInt("SERVER_PORT", 8888),
+		ServerHost:       getEnv("SERVER_HOST", "127.0.0.1"),
 		HealthPort:       getEnvInt("HEALTH_PORT", 8080),
+		HealthHost:       getEnv("HEALTH_HOST", "0.0.0.0"),
 		DryRun:           getEnvBool("DRY_RUN", false),
+		DryRunOutputFile: getEnv("DRY_RUN_OUTPUT_FILE", ""),
 		LogLevel:         getEnv("LOG_LEVEL", "info"),
-		SupportedRecords: getEnvList("SUPPORTED_RECORDS", []string{"A", "AAAA", "CNAME"}),
+		LogFormat:        strings.ToLower(getEnv("LOG_FORMAT", LogFormatText)),
+		SuppressBanner:   getEnvBool("SUPPRESS_BANNER", false),
+		RecordProfile:    strings.ToLower(getEnv("RECORD_PROFILE", "standard")),
+		NameCase:         strings.ToLower(getEnv("NAME_CASE", NameCaseLower)),
+		ApplyBatchWindow: getEnvDuration("APPLY_BATCH_WINDOW", 0),
+
+		DefaultRecordType: strings.ToUpper(getEnv("DEFAULT_RECORD_TYPE", "")),
+
+		RetryMaxAttempts: getEnvInt("RETRY_MAX_ATTEMPTS", 4),
+		RetryBaseDelay:   time.Duration(getEnvInt("RETRY_BASE_DELAY_MS", 1000)) * time.Millisecond,
+		RetryJitter:      getEnvBool("RETRY_JITTER", true),
+
+		VerifyWritesAttempts: getEnvInt("VERIFY_WRITES_ATTEMPTS", 0),
+		VerifyWritesInterval: getEnvDuration("VERIFY_WRITES_INTERVAL", 500*time.Millisecond),
+		CacheTTL:             getEnvDuration("CACHE_TTL", 10*time.Second),
+		APITimeout:           getEnvDuration("API_TIMEOUT", 30*time.Second),
+		APIRateLimit:         getEnvFloat("API_RATE_LIMIT", 0),
+
+		ApplyConcurrency:       applyConcurrency,
+		ApplyConcurrencyCreate: getEnvInt("APPLY_CONCURRENCY_CREATE", applyConcurrency),
+		ApplyConcurrencyDelete: getEnvInt("APPLY_CONCURRENCY_DELETE", applyConcurrency),
+		ApplyTypeOrder:         getEnvList("APPLY_TYPE_ORDER", nil),
+
+		CNAMETargetQualify:    strings.ToLower(strings.Trim(getEnv("CNAME_TARGET_QUALIFY", ""), ". ")),
+		VerifyCNAMETarget:     strings.ToLower(getEnv("VERIFY_CNAME_TARGET", VerifyCNAMETargetOff)),
+		CNAMETargetForm:       strings.ToLower(getEnv("CNAME_TARGET_FORM", CNAMETargetFormRelative)),
+		FlattenCNAME:          getEnvBool("FLATTEN_CNAME", false),
+		FlattenCNAMEResolver:  getEnv("FLATTEN_CNAME_RESOLVER", ""),
+		FlattenCNAMECacheTTL:  getEnvDuration("FLATTEN_CNAME_CACHE_TTL", 30*time.Second),
+		DisableHTTPKeepAlives: getEnvBool("DISABLE_HTTP_KEEPALIVES", false),
+		RequestIDHeader:       getEnv("REQUEST_ID_HEADER", "X-Request-ID"),
+		ReadinessInitialDelay: getEnvDuration("READINESS_INITIAL_DELAY", 0),
+		MaxConcurrentRequests: getEnvInt("MAX_CONCURRENT_REQUESTS", 0),
+		APIReadTimeout:        getEnvDuration("API_READ_TIMEOUT_HTTP", 30*time.Second),
+		APIWriteTimeout:       getEnvDuration("API_WRITE_TIMEOUT_HTTP", 30*time.Second),
+		ShutdownTimeout:       getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		ConnectionTestMode: strings.ToLower(getEnv("CONNECTION_TEST_MODE", ConnectionTestList)),
+		WriteCheckEnabled:  getEnvBool("WRITE_CHECK_ENABLED", false),
+		WriteCheckName:     getEnv("WRITE_CHECK_NAME", "nextdns-webhook-write-check.invalid"),
+
+		DebugEndpointsEnabled: getEnvBool("DEBUG_ENDPOINTS_ENABLED", false),
+		DebugToken:            getEnv("DEBUG_TOKEN", ""),
+		DebugHistorySize:      getEnvInt("DEBUG_HISTORY_SIZE", 100),
+
+		MaxRecordsReturned: getEnvInt("MAX_RECORDS_RETURNED", 0),
+		RecordsLimitPolicy: strings.ToLower(getEnv("RECORDS_LIMIT_POLICY", RecordsLimitError)),
+
+		BlockedTargets:      getEnvList("BLOCKED_TARGETS", nil),
+		TXTRegistryEnabled:  getEnvBool("TXT_REGISTRY_ENABLED", false),
+		QuotaExceededPolicy: strings.ToLower(getEnv("QUOTA_EXCEEDED_POLICY", QuotaExceededFail)),
+		NoDeleteRecordTypes: getEnvList("NO_DELETE_RECORD_TYPES", nil),
+
+		MaxDeleteFraction: getEnvFloat("MAX_DELETE_FRACTION", 0),
+		AllowMassDelete:   getEnvBool("ALLOW_MASS_DELETE", false),
+	}
+
+	// Supported records: an explicit SUPPORTED_RECORDS list wins over the preset
+	preset, ok := recordProfiles[config.RecordProfile]
+	if !ok {
+		return nil, fmt.Errorf("RECORD_PROFILE must be one of minimal, standard, got %q", config.RecordProfile)
 	}
+	config.SupportedRecords = getEnvList("SUPPORTED_RECORDS", slices.Clone(preset))
 
 	// Domain filter
 	domainFilterStr := getEnv("DOMAIN_FILTER", "")
 	if domainFilterStr != "" {
-		config.DomainFilter = strings.Split(domainFilterStr, ",")
-		for i := range config.DomainFilter {
-			config.DomainFilter[i] = strings.TrimSpace(config.DomainFilter[i])
+		for _, domain := range strings.Split(domainFilterStr, ",") {
+			domain = strings.TrimSpace(domain)
+			// An empty entry (e.g. from a trailing comma) would match every name
+			if domain == "" {
+				slog.Warn("Ignoring empty DOMAIN_FILTER entry", "domain_filter", domainFilterStr)
+				continue
+			}
+			config.DomainFilter = append(config.DomainFilter, domain)
+		}
+	}
+
+	config.RegexDomainFilter = getEnv("REGEX_DOMAIN_FILTER", "")
+	if config.RegexDomainFilter != "" && len(config.DomainFilter) > 0 {
+		return nil, fmt.Errorf("DOMAIN_FILTER and REGEX_DOMAIN_FILTER are mutually exclusive")
+	}
+
+	// Domain exclusions
+	excludeFilterStr := getEnv("EXCLUDE_DOMAIN_FILTER", "")
+	if excludeFilterStr != "" {
+		for _, domain := range strings.Split(excludeFilterStr, ",") {
+			domain = strings.TrimSpace(domain)
+			// An empty entry would exclude every name
+			if domain == "" {
+				slog.Warn("Ignoring empty EXCLUDE_DOMAIN_FILTER entry", "exclude_domain_filter", excludeFilterStr)
+				continue
+			}
+			config.ExcludeDomainFilter = append(config.ExcludeDomainFilter, domain)
 		}
 	}
 
 	// Validate required fields
+	// A key mounted from a secret file keeps it out of the environment
+	if apiKeyFile := getEnv("NEXTDNS_API_KEY_FILE", ""); apiKeyFile != "" {
+		if config.APIKey != "" {
+			return nil, fmt.Errorf("NEXTDNS_API_KEY and NEXTDNS_API_KEY_FILE are mutually exclusive")
+		}
+		key, err := os.ReadFile(apiKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NEXTDNS_API_KEY_FILE: %w", err)
+		}
+		config.APIKey = strings.TrimSpace(string(key))
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("NEXTDNS_API_KEY_FILE %s is empty", apiKeyFile)
+		}
+	}
+
 	if config.APIKey == "" {
-		return nil, fmt.Errorf("NEXTDNS_API_KEY environment variable is required")
+		return nil, fmt.Errorf("NEXTDNS_API_KEY or NEXTDNS_API_KEY_FILE is required")
 	}
 
 	if config.ProfileID == "" {
 		return nil, fmt.Errorf("NEXTDNS_PROFILE_ID environment variable is required")
 	}
 
+	// Use the client's own rules, so a base URL that passes here is one the
+	// client accepts; a typo then fails at startup, not on the first call
+	if _, err := normalizeBaseURL(config.BaseURL); err != nil {
+		return nil, fmt.Errorf("NEXTDNS_BASE_URL: %w", err)
+	}
+
+	if config.DebugEndpointsEnabled && config.DebugToken == "" {
+		return nil, fmt.Errorf("DEBUG_TOKEN is required when DEBUG_ENDPOINTS_ENABLED is true")
+	}
+
+	if config.DebugHistorySize < 1 {
+		return nil, fmt.Errorf("DEBUG_HISTORY_SIZE must be at least 1, got %d", config.DebugHistorySize)
+	}
+
+	if config.ConnectionTestMode != ConnectionTestList && config.ConnectionTestMode != ConnectionTestLight {
+		return nil, fmt.Errorf("CONNECTION_TEST_MODE must be %q or %q, got %q", ConnectionTestList, ConnectionTestLight, config.ConnectionTestMode)
+	}
+
+	if config.WriteCheckEnabled && config.WriteCheckName == "" {
+		return nil, fmt.Errorf("WRITE_CHECK_NAME is required when WRITE_CHECK_ENABLED is true")
+	}
+
+	if config.CNAMETargetForm != CNAMETargetFormRelative && config.CNAMETargetForm != CNAMETargetFormAbsolute {
+		return nil, fmt.Errorf("CNAME_TARGET_FORM must be %q or %q, got %q", CNAMETargetFormRelative, CNAMETargetFormAbsolute, config.CNAMETargetForm)
+	}
+
+	if !slices.Contains([]string{VerifyCNAMETargetOff, VerifyCNAMETargetWarn, VerifyCNAMETargetError}, config.VerifyCNAMETarget) {
+		return nil, fmt.Errorf("VERIFY_CNAME_TARGET must be %q, %q, or %q, got %q", VerifyCNAMETargetOff, VerifyCNAMETargetWarn, VerifyCNAMETargetError, config.VerifyCNAMETarget)
+	}
+
+	if config.FlattenCNAME && len(config.DomainFilter) == 0 {
+		return nil, fmt.Errorf("FLATTEN_CNAME requires DOMAIN_FILTER, whose domains are the zone apexes to flatten")
+	}
+
+	if config.FlattenCNAMEResolver != "" {
+		if _, _, err := net.SplitHostPort(config.FlattenCNAMEResolver); err != nil {
+			return nil, fmt.Errorf("FLATTEN_CNAME_RESOLVER must be host:port, got %q: %w", config.FlattenCNAMEResolver, err)
+		}
+	}
+
+	if config.APITimeout < 0 {
+		return nil, fmt.Errorf("API_TIMEOUT must not be negative, got %v", config.APITimeout)
+	}
+
+	if config.APIRateLimit < 0 || math.IsNaN(config.APIRateLimit) {
+		return nil, fmt.Errorf("API_RATE_LIMIT must not be negative, got %v", config.APIRateLimit)
+	}
+
+	if config.CacheTTL < 0 {
+		return nil, fmt.Errorf("CACHE_TTL must not be negative, got %v", config.CacheTTL)
+	}
+
+	if config.ReadinessInitialDelay < 0 {
+		return nil, fmt.Errorf("READINESS_INITIAL_DELAY must not be negative, got %v", config.ReadinessInitialDelay)
+	}
+
+	if config.FlattenCNAMECacheTTL < 0 {
+		return nil, fmt.Errorf("FLATTEN_CNAME_CACHE_TTL must not be negative, got %v", config.FlattenCNAMECacheTTL)
+	}
+
+	if config.QuotaExceededPolicy != QuotaExceededFail && config.QuotaExceededPolicy != QuotaExceededSkipCreates {
+		return nil, fmt.Errorf("QUOTA_EXCEEDED_POLICY must be %q or %q, got %q", QuotaExceededFail, QuotaExceededSkipCreates, config.QuotaExceededPolicy)
+	}
+
+	if config.DefaultRecordType != "" && !slices.Contains(implementedRecordTypes, config.DefaultRecordType) {
+		return nil, fmt.Errorf("DEFAULT_RECORD_TYPE must be A, AAAA, or CNAME, got %q", config.DefaultRecordType)
+	}
+
+	if config.NameCase != NameCaseLower && config.NameCase != NameCasePreserve {
+		return nil, fmt.Errorf("NAME_CASE must be %q or %q, got %q", NameCaseLower, NameCasePreserve, config.NameCase)
+	}
+
+	if config.MaxRecordsReturned < 0 {
+		return nil, fmt.Errorf("MAX_RECORDS_RETURNED must not be negative, got %d", config.MaxRecordsReturned)
+	}
+
+	if config.RecordsLimitPolicy != RecordsLimitError && config.RecordsLimitPolicy != RecordsLimitTruncate {
+		return nil, fmt.Errorf("RECORDS_LIMIT_POLICY must be %q or %q, got %q", RecordsLimitError, RecordsLimitTruncate, config.RecordsLimitPolicy)
+	}
+
+	if config.ApplyConcurrency < 1 {
+		return nil, fmt.Errorf("APPLY_CONCURRENCY must be at least 1, got %d", config.ApplyConcurrency)
+	}
+
+	if config.ApplyConcurrencyCreate < 1 {
+		return nil, fmt.Errorf("APPLY_CONCURRENCY_CREATE must be at least 1, got %d", config.ApplyConcurrencyCreate)
+	}
+
+	if config.ApplyConcurrencyDelete < 1 {
+		return nil, fmt.Errorf("APPLY_CONCURRENCY_DELETE must be at least 1, got %d", config.ApplyConcurrencyDelete)
+	}
+
+	if config.RetryMaxAttempts < 1 || config.RetryMaxAttempts > maxRetryAttempts {
+		return nil, fmt.Errorf("RETRY_MAX_ATTEMPTS must be between 1 and %d, got %d", maxRetryAttempts, config.RetryMaxAttempts)
+	}
+
+	if config.RetryBaseDelay < 0 {
+		return nil, fmt.Errorf("RETRY_BASE_DELAY_MS must not be negative, got %d", config.RetryBaseDelay.Milliseconds())
+	}
+
+	if config.MaxConcurrentRequests < 0 {
+		return nil, fmt.Errorf("MAX_CONCURRENT_REQUESTS must not be negative, got %d", config.MaxConcurrentRequests)
+	}
+
+	if config.VerifyWritesAttempts < 0 {
+		return nil, fmt.Errorf("VERIFY_WRITES_ATTEMPTS must not be negative, got %d", config.VerifyWritesAttempts)
+	}
+
+	if config.VerifyWritesInterval <= 0 {
+		return nil, fmt.Errorf("VERIFY_WRITES_INTERVAL must be positive, got %v", config.VerifyWritesInterval)
+	}
+
+	if config.APIReadTimeout <= 0 || config.APIWriteTimeout <= 0 {
+		return nil, fmt.Errorf("API_READ_TIMEOUT_HTTP and API_WRITE_TIMEOUT_HTTP must be positive, got %v and %v", config.APIReadTimeout, config.APIWriteTimeout)
+	}
+
+	if config.ShutdownTimeout <= 0 {
+		return nil, fmt.Errorf("SHUTDOWN_TIMEOUT must be positive, got %v", config.ShutdownTimeout)
+	}
+
+	if config.ApplyBatchWindow < 0 {
+		return nil, fmt.Errorf("APPLY_BATCH_WINDOW must not be negative, got %v", config.ApplyBatchWindow)
+	}
+
+	if config.MaxDeleteFraction < 0 || config.MaxDeleteFraction > 1 {
+		return nil, fmt.Errorf("MAX_DELETE_FRACTION must be between 0 and 1, got %v", config.MaxDeleteFraction)
+	}
+
 	return config, nil
 }
 
@@ -83,6 +502,32 @@ func getEnvInt(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvFloat gets a float environment variable with a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "500ms") with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // getEnvBool gets a boolean environment variable with a default value
 func getEnvBool(key string, defaultValue bool) bool {
 	valueStr := os.Getenv(key)
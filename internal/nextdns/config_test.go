@@ -2,8 +2,12 @@ package nextdns
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -27,15 +31,41 @@ func TestLoadConfig(t *testing.T) {
 				"DOMAIN_FILTER":      "example.com,test.com",
 			},
 			want: &Config{
-				APIKey:           "test-api-key",
-				ProfileID:        "test-profile",
-				BaseURL:          "https://test.nextdns.io",
-				ServerPort:       9999,
-				HealthPort:       9998,
-				DryRun:           true,
-				LogLevel:         "debug",
-				SupportedRecords: []string{"A", "AAAA", "CNAME", "TXT"},
-				DomainFilter:     []string{"example.com", "test.com"},
+				APIKey:                 "test-api-key",
+				ProfileID:              "test-profile",
+				BaseURL:                "https://test.nextdns.io",
+				ServerPort:             9999,
+				HealthPort:             9998,
+				ServerHost:             "127.0.0.1",
+				HealthHost:             "0.0.0.0",
+				DryRun:                 true,
+				LogLevel:               "debug",
+				LogFormat:              "text",
+				SupportedRecords:       []string{"A", "AAAA", "CNAME", "TXT"},
+				RecordProfile:          "standard",
+				NameCase:               "lower",
+				RecordsLimitPolicy:     "error",
+				ConnectionTestMode:     "list",
+				APIReadTimeout:         30 * time.Second,
+				APIWriteTimeout:        30 * time.Second,
+				ShutdownTimeout:        30 * time.Second,
+				ApplyConcurrency:       1,
+				ApplyConcurrencyCreate: 1,
+				ApplyConcurrencyDelete: 1,
+				DebugHistorySize:       100,
+				VerifyCNAMETarget:      "off",
+				QuotaExceededPolicy:    "fail",
+				WriteCheckName:         "nextdns-webhook-write-check.invalid",
+				RequestIDHeader:        "X-Request-ID",
+				RetryMaxAttempts:       4,
+				RetryBaseDelay:         time.Second,
+				RetryJitter:            true,
+				VerifyWritesInterval:   500 * time.Millisecond,
+				FlattenCNAMECacheTTL:   30 * time.Second,
+				CNAMETargetForm:        "relative",
+				CacheTTL:               10 * time.Second,
+				APITimeout:             30 * time.Second,
+				DomainFilter:           []string{"example.com", "test.com"},
 			},
 			wantErr: false,
 		},
@@ -46,15 +76,41 @@ func TestLoadConfig(t *testing.T) {
 				"NEXTDNS_PROFILE_ID": "test-profile",
 			},
 			want: &Config{
-				APIKey:           "test-api-key",
-				ProfileID:        "test-profile",
-				BaseURL:          "https://api.nextdns.io",
-				ServerPort:       8888,
-				HealthPort:       8080,
-				DryRun:           false,
-				LogLevel:         "info",
-				SupportedRecords: []string{"A", "AAAA", "CNAME"},
-				DomainFilter:     nil,
+				APIKey:                 "test-api-key",
+				ProfileID:              "test-profile",
+				BaseURL:                "https://api.nextdns.io",
+				ServerPort:             8888,
+				HealthPort:             8080,
+				ServerHost:             "127.0.0.1",
+				HealthHost:             "0.0.0.0",
+				DryRun:                 false,
+				LogLevel:               "info",
+				LogFormat:              "text",
+				SupportedRecords:       []string{"A", "AAAA", "CNAME"},
+				RecordProfile:          "standard",
+				NameCase:               "lower",
+				RecordsLimitPolicy:     "error",
+				ConnectionTestMode:     "list",
+				APIReadTimeout:         30 * time.Second,
+				APIWriteTimeout:        30 * time.Second,
+				ShutdownTimeout:        30 * time.Second,
+				ApplyConcurrency:       1,
+				ApplyConcurrencyCreate: 1,
+				ApplyConcurrencyDelete: 1,
+				DebugHistorySize:       100,
+				VerifyCNAMETarget:      "off",
+				QuotaExceededPolicy:    "fail",
+				WriteCheckName:         "nextdns-webhook-write-check.invalid",
+				RequestIDHeader:        "X-Request-ID",
+				RetryMaxAttempts:       4,
+				RetryBaseDelay:         time.Second,
+				RetryJitter:            true,
+				VerifyWritesInterval:   500 * time.Millisecond,
+				FlattenCNAMECacheTTL:   30 * time.Second,
+				CNAMETargetForm:        "relative",
+				CacheTTL:               10 * time.Second,
+				APITimeout:             30 * time.Second,
+				DomainFilter:           nil,
 			},
 			wantErr: false,
 		},
@@ -74,6 +130,58 @@ func TestLoadConfig(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "domain and regex filters together",
+			envVars: map[string]string{
+				"NEXTDNS_API_KEY":     "test-api-key",
+				"NEXTDNS_PROFILE_ID":  "test-profile",
+				"DOMAIN_FILTER":       "example.com",
+				"REGEX_DOMAIN_FILTER": `\.example\.com$`,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "base URL with a misspelled scheme",
+			envVars: map[string]string{
+				"NEXTDNS_API_KEY":    "test-api-key",
+				"NEXTDNS_PROFILE_ID": "test-profile",
+				"NEXTDNS_BASE_URL":   "htps://api.nextdns.io",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "base URL without a host",
+			envVars: map[string]string{
+				"NEXTDNS_API_KEY":    "test-api-key",
+				"NEXTDNS_PROFILE_ID": "test-profile",
+				"NEXTDNS_BASE_URL":   "https://",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "base URL that doesn't parse",
+			envVars: map[string]string{
+				"NEXTDNS_API_KEY":    "test-api-key",
+				"NEXTDNS_PROFILE_ID": "test-profile",
+				"NEXTDNS_BASE_URL":   "http://api.nextdns.io:port",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			// The client rejects this too, so startup must
+			name: "base URL with a query",
+			envVars: map[string]string{
+				"NEXTDNS_API_KEY":    "test-api-key",
+				"NEXTDNS_PROFILE_ID": "test-profile",
+				"NEXTDNS_BASE_URL":   "https://api.nextdns.io/?region=eu",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "domain filter with spaces",
 			envVars: map[string]string{
@@ -82,15 +190,41 @@ func TestLoadConfig(t *testing.T) {
 				"DOMAIN_FILTER":      "  example.com  ,  test.com  ",
 			},
 			want: &Config{
-				APIKey:           "test-api-key",
-				ProfileID:        "test-profile",
-				BaseURL:          "https://api.nextdns.io",
-				ServerPort:       8888,
-				HealthPort:       8080,
-				DryRun:           false,
-				LogLevel:         "info",
-				SupportedRecords: []string{"A", "AAAA", "CNAME"},
-				DomainFilter:     []string{"example.com", "test.com"},
+				APIKey:                 "test-api-key",
+				ProfileID:              "test-profile",
+				BaseURL:                "https://api.nextdns.io",
+				ServerPort:             8888,
+				HealthPort:             8080,
+				ServerHost:             "127.0.0.1",
+				HealthHost:             "0.0.0.0",
+				DryRun:                 false,
+				LogLevel:               "info",
+				LogFormat:              "text",
+				SupportedRecords:       []string{"A", "AAAA", "CNAME"},
+				RecordProfile:          "standard",
+				NameCase:               "lower",
+				RecordsLimitPolicy:     "error",
+				ConnectionTestMode:     "list",
+				APIReadTimeout:         30 * time.Second,
+				APIWriteTimeout:        30 * time.Second,
+				ShutdownTimeout:        30 * time.Second,
+				ApplyConcurrency:       1,
+				ApplyConcurrencyCreate: 1,
+				ApplyConcurrencyDelete: 1,
+				DebugHistorySize:       100,
+				VerifyCNAMETarget:      "off",
+				QuotaExceededPolicy:    "fail",
+				WriteCheckName:         "nextdns-webhook-write-check.invalid",
+				RequestIDHeader:        "X-Request-ID",
+				RetryMaxAttempts:       4,
+				RetryBaseDelay:         time.Second,
+				RetryJitter:            true,
+				VerifyWritesInterval:   500 * time.Millisecond,
+				FlattenCNAMECacheTTL:   30 * time.Second,
+				CNAMETargetForm:        "relative",
+				CacheTTL:               10 * time.Second,
+				APITimeout:             30 * time.Second,
+				DomainFilter:           []string{"example.com", "test.com"},
 			},
 			wantErr: false,
 		},
@@ -323,3 +457,722 @@ func TestGetEnvList(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEnvFloat(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		defaultValue float64
+		envValue     string
+		want         float64
+	}{
+		{
+			name:         "valid float",
+			key:          "TEST_FLOAT",
+			defaultValue: 0.5,
+			envValue:     "0.25",
+			want:         0.25,
+		},
+		{
+			name:         "invalid float",
+			key:          "TEST_FLOAT",
+			defaultValue: 0.5,
+			envValue:     "not-a-number",
+			want:         0.5,
+		},
+		{
+			name:         "empty env var",
+			key:          "TEST_FLOAT",
+			defaultValue: 0.5,
+			envValue:     "",
+			want:         0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			if tt.envValue != "" {
+				t.Setenv(tt.key, tt.envValue)
+			}
+
+			got := getEnvFloat(tt.key, tt.defaultValue)
+			if got != tt.want {
+				t.Errorf("getEnvFloat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_MaxDeleteFraction(t *testing.T) {
+	tests := []struct {
+		name         string
+		fraction     string
+		allowMass    string
+		wantFraction float64
+		wantAllow    bool
+		wantErr      bool
+	}{
+		{
+			name:         "disabled by default",
+			wantFraction: 0,
+		},
+		{
+			name:         "valid fraction with override",
+			fraction:     "0.3",
+			allowMass:    "true",
+			wantFraction: 0.3,
+			wantAllow:    true,
+		},
+		{
+			name:     "fraction above one",
+			fraction: "1.5",
+			wantErr:  true,
+		},
+		{
+			name:     "negative fraction",
+			fraction: "-0.1",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.fraction != "" {
+				t.Setenv("MAX_DELETE_FRACTION", tt.fraction)
+			}
+			if tt.allowMass != "" {
+				t.Setenv("ALLOW_MASS_DELETE", tt.allowMass)
+			}
+
+			got, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.MaxDeleteFraction != tt.wantFraction {
+				t.Errorf("MaxDeleteFraction = %v, want %v", got.MaxDeleteFraction, tt.wantFraction)
+			}
+			if got.AllowMassDelete != tt.wantAllow {
+				t.Errorf("AllowMassDelete = %v, want %v", got.AllowMassDelete, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_APIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "api-key")
+	if err := os.WriteFile(keyFile, []byte("  file-api-key\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		envKey  string
+		keyFile string
+		wantKey string
+		wantErr bool
+	}{
+		{name: "key from file, whitespace trimmed", keyFile: keyFile, wantKey: "file-api-key"},
+		{name: "key from environment", envKey: "env-api-key", wantKey: "env-api-key"},
+		{name: "both set", envKey: "env-api-key", keyFile: keyFile, wantErr: true},
+		{name: "missing file", keyFile: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "empty file", keyFile: emptyFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.envKey != "" {
+				t.Setenv("NEXTDNS_API_KEY", tt.envKey)
+			}
+			if tt.keyFile != "" {
+				t.Setenv("NEXTDNS_API_KEY_FILE", tt.keyFile)
+			}
+
+			got, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.APIKey != tt.wantKey {
+				t.Errorf("APIKey = %q, want %q", got.APIKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  string
+		baseDelayMS  string
+		wantAttempts int
+		jitter       string
+		wantDelay    time.Duration
+		wantJitter   bool
+		wantErr      bool
+	}{
+		{name: "defaults", wantAttempts: 4, wantDelay: time.Second, wantJitter: true},
+		{name: "more attempts", maxAttempts: "6", baseDelayMS: "250", wantAttempts: 6, wantDelay: 250 * time.Millisecond, wantJitter: true},
+		{name: "fail fast", maxAttempts: "1", wantAttempts: 1, wantDelay: time.Second, wantJitter: true},
+		{name: "exact delays", jitter: "false", wantAttempts: 4, wantDelay: time.Second, wantJitter: false},
+		{name: "zero attempts", maxAttempts: "0", wantErr: true},
+		{name: "too many attempts", maxAttempts: "12", wantErr: true},
+		{name: "negative delay", baseDelayMS: "-5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.maxAttempts != "" {
+				t.Setenv("RETRY_MAX_ATTEMPTS", tt.maxAttempts)
+			}
+			if tt.baseDelayMS != "" {
+				t.Setenv("RETRY_BASE_DELAY_MS", tt.baseDelayMS)
+			}
+			if tt.jitter != "" {
+				t.Setenv("RETRY_JITTER", tt.jitter)
+			}
+
+			got, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.RetryMaxAttempts != tt.wantAttempts || got.RetryBaseDelay != tt.wantDelay {
+				t.Errorf("retry = %d attempts after %v, want %d after %v", got.RetryMaxAttempts, got.RetryBaseDelay, tt.wantAttempts, tt.wantDelay)
+			}
+			if got.RetryJitter != tt.wantJitter {
+				t.Errorf("RetryJitter = %v, want %v", got.RetryJitter, tt.wantJitter)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_NameCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		nameCase string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default is lower", want: "lower"},
+		{name: "preserve", nameCase: "preserve", want: "preserve"},
+		{name: "case-insensitive value", nameCase: "LOWER", want: "lower"},
+		{name: "invalid value", nameCase: "upper", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.nameCase != "" {
+				t.Setenv("NAME_CASE", tt.nameCase)
+			}
+
+			got, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.NameCase != tt.want {
+				t.Errorf("NameCase = %v, want %v", got.NameCase, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_RecordProfile(t *testing.T) {
+	tests := []struct {
+		name             string
+		recordProfile    string
+		supportedRecords string
+		want             []string
+		wantErr          bool
+	}{
+		{
+			name: "default is standard",
+			want: []string{"A", "AAAA", "CNAME"},
+		},
+		{
+			name:          "minimal",
+			recordProfile: "minimal",
+			want:          []string{"A", "AAAA"},
+		},
+		{
+			name:          "standard",
+			recordProfile: "standard",
+			want:          []string{"A", "AAAA", "CNAME"},
+		},
+		{
+			name:             "explicit SUPPORTED_RECORDS overrides preset",
+			recordProfile:    "minimal",
+			supportedRecords: "A,CNAME",
+			want:             []string{"A", "CNAME"},
+		},
+		{
+			name:          "unknown preset",
+			recordProfile: "everything",
+			wantErr:       true,
+		},
+		{
+			name:          "removed full preset",
+			recordProfile: "full",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.recordProfile != "" {
+				t.Setenv("RECORD_PROFILE", tt.recordProfile)
+			}
+			if tt.supportedRecords != "" {
+				t.Setenv("SUPPORTED_RECORDS", tt.supportedRecords)
+			}
+
+			got, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got.SupportedRecords, tt.want) {
+				t.Errorf("SupportedRecords = %v, want %v", got.SupportedRecords, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecordProfiles_StartProvider verifies that every RECORD_PROFILE preset
+// only enables record types the provider implements.
+func TestRecordProfiles_StartProvider(t *testing.T) {
+	for name, recordTypes := range recordProfiles {
+		t.Run(name, func(t *testing.T) {
+			config := &Config{
+				APIKey:           "test-api-key",
+				ProfileID:        "test-profile",
+				DryRun:           true,
+				SupportedRecords: slices.Clone(recordTypes),
+			}
+			if _, err := NewProvider(config); err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DomainFilterEmptyEntries(t *testing.T) {
+	tests := []struct {
+		name         string
+		domainFilter string
+		want         []string
+		wantWarnings int
+	}{
+		{
+			name:         "empty entry between domains",
+			domainFilter: "example.com,,test.com",
+			want:         []string{"example.com", "test.com"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "trailing comma and whitespace-only entry",
+			domainFilter: "example.com, ,",
+			want:         []string{"example.com"},
+			wantWarnings: 2,
+		},
+		{
+			name:         "only separators",
+			domainFilter: ",",
+			want:         nil,
+			wantWarnings: 2,
+		},
+		{
+			name:         "clean list",
+			domainFilter: "example.com,test.com",
+			want:         []string{"example.com", "test.com"},
+			wantWarnings: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			t.Setenv("DOMAIN_FILTER", tt.domainFilter)
+
+			got, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got.DomainFilter, tt.want) {
+				t.Errorf("DomainFilter = %#v, want %#v", got.DomainFilter, tt.want)
+			}
+
+			warnings := strings.Count(logs.String(), "Ignoring empty DOMAIN_FILTER entry")
+			if warnings != tt.wantWarnings {
+				t.Errorf("got %d empty-entry warnings, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DebugEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "disabled by default",
+			envVars: map[string]string{},
+		},
+		{
+			name: "enabled with token",
+			envVars: map[string]string{
+				"DEBUG_ENDPOINTS_ENABLED": "true",
+				"DEBUG_TOKEN":             "secret",
+			},
+		},
+		{
+			name: "enabled without token",
+			envVars: map[string]string{
+				"DEBUG_ENDPOINTS_ENABLED": "true",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			for k, v := range tt.envVars {
+				t.Setenv(k, v)
+			}
+
+			_, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ApplyBatchWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "disabled by default", value: "", want: 0},
+		{name: "valid duration", value: "2s", want: 2 * time.Second},
+		{name: "invalid duration falls back to default", value: "soon", want: 0},
+		{name: "negative", value: "-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.value != "" {
+				t.Setenv("APPLY_BATCH_WINDOW", tt.value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.ApplyBatchWindow != tt.want {
+				t.Errorf("ApplyBatchWindow = %v, want %v", config.ApplyBatchWindow, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_APIRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{name: "disabled by default", value: "", want: 0},
+		{name: "requests per second", value: "5", want: 5},
+		{name: "fractional rate", value: "0.5", want: 0.5},
+		{name: "negative", value: "-1", wantErr: true},
+		{name: "not a number", value: "NaN", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.value != "" {
+				t.Setenv("API_RATE_LIMIT", tt.value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.APIRateLimit != tt.want {
+				t.Errorf("APIRateLimit = %v, want %v", config.APIRateLimit, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ApplyConcurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantUpdate int
+		wantCreate int
+		wantDelete int
+		wantErr    bool
+	}{
+		{name: "sequential by default", wantUpdate: 1, wantCreate: 1, wantDelete: 1},
+		{name: "shared limit", env: map[string]string{"APPLY_CONCURRENCY": "4"}, wantUpdate: 4, wantCreate: 4, wantDelete: 4},
+		{
+			name:       "per-operation overrides",
+			env:        map[string]string{"APPLY_CONCURRENCY": "4", "APPLY_CONCURRENCY_CREATE": "2", "APPLY_CONCURRENCY_DELETE": "8"},
+			wantUpdate: 4,
+			wantCreate: 2,
+			wantDelete: 8,
+		},
+		{name: "zero", env: map[string]string{"APPLY_CONCURRENCY": "0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.ApplyConcurrency != tt.wantUpdate || config.ApplyConcurrencyCreate != tt.wantCreate || config.ApplyConcurrencyDelete != tt.wantDelete {
+				t.Errorf("apply concurrency = %d/%d/%d (update/create/delete), want %d/%d/%d",
+					config.ApplyConcurrency, config.ApplyConcurrencyCreate, config.ApplyConcurrencyDelete,
+					tt.wantUpdate, tt.wantCreate, tt.wantDelete)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_RecordsLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		envVars    map[string]string
+		wantLimit  int
+		wantPolicy string
+		wantErr    bool
+	}{
+		{name: "defaults", envVars: map[string]string{}, wantLimit: 0, wantPolicy: RecordsLimitError},
+		{
+			name:       "truncate policy",
+			envVars:    map[string]string{"MAX_RECORDS_RETURNED": "500", "RECORDS_LIMIT_POLICY": "Truncate"},
+			wantLimit:  500,
+			wantPolicy: RecordsLimitTruncate,
+		},
+		{name: "negative limit", envVars: map[string]string{"MAX_RECORDS_RETURNED": "-1"}, wantErr: true},
+		{name: "unknown policy", envVars: map[string]string{"RECORDS_LIMIT_POLICY": "drop"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			for k, v := range tt.envVars {
+				t.Setenv(k, v)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.MaxRecordsReturned != tt.wantLimit {
+				t.Errorf("MaxRecordsReturned = %d, want %d", config.MaxRecordsReturned, tt.wantLimit)
+			}
+			if config.RecordsLimitPolicy != tt.wantPolicy {
+				t.Errorf("RecordsLimitPolicy = %q, want %q", config.RecordsLimitPolicy, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ConnectionTestMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", value: "", want: ConnectionTestList},
+		{name: "list", value: "list", want: ConnectionTestList},
+		{name: "light is case-insensitive", value: "Light", want: ConnectionTestLight},
+		{name: "unknown mode", value: "ping", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.value != "" {
+				t.Setenv("CONNECTION_TEST_MODE", tt.value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.ConnectionTestMode != tt.want {
+				t.Errorf("ConnectionTestMode = %q, want %q", config.ConnectionTestMode, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_APITimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantRead  time.Duration
+		wantWrite time.Duration
+		wantErr   bool
+	}{
+		{name: "defaults", envVars: map[string]string{}, wantRead: 30 * time.Second, wantWrite: 30 * time.Second},
+		{
+			name:      "custom values",
+			envVars:   map[string]string{"API_READ_TIMEOUT_HTTP": "5s", "API_WRITE_TIMEOUT_HTTP": "2m"},
+			wantRead:  5 * time.Second,
+			wantWrite: 2 * time.Minute,
+		},
+		{name: "zero read timeout", envVars: map[string]string{"API_READ_TIMEOUT_HTTP": "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			for k, v := range tt.envVars {
+				t.Setenv(k, v)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if config.APIReadTimeout != tt.wantRead || config.APIWriteTimeout != tt.wantWrite {
+				t.Errorf("timeouts = %v/%v, want %v/%v", config.APIReadTimeout, config.APIWriteTimeout, tt.wantRead, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_VerifyCNAMETarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", value: "", want: VerifyCNAMETargetOff},
+		{name: "warn", value: "warn", want: VerifyCNAMETargetWarn},
+		{name: "error is case-insensitive", value: "ERROR", want: VerifyCNAMETargetError},
+		{name: "unknown mode", value: "strict", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.value != "" {
+				t.Setenv("VERIFY_CNAME_TARGET", tt.value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.VerifyCNAMETarget != tt.want {
+				t.Errorf("VerifyCNAMETarget = %q, want %q", config.VerifyCNAMETarget, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DefaultRecordType(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset", value: "", want: ""},
+		{name: "uppercased", value: "cname", want: "CNAME"},
+		{name: "unimplemented type", value: "TXT", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+			t.Setenv("NEXTDNS_API_KEY", "test-api-key")
+			t.Setenv("NEXTDNS_PROFILE_ID", "test-profile")
+			if tt.value != "" {
+				t.Setenv("DEFAULT_RECORD_TYPE", tt.value)
+			}
+
+			config, err := LoadConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.DefaultRecordType != tt.want {
+				t.Errorf("DefaultRecordType = %q, want %q", config.DefaultRecordType, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package nextdns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
+)
+
+// Sentinel errors for failures callers may want to handle specifically.
+// Errors returned by the client and provider wrap them, so match with
+// errors.Is.
+var (
+	// ErrRecordConflict means NextDNS rejected a create because the rewrite
+	// already exists
+	ErrRecordConflict = errors.New("record already exists")
+
+	// ErrRecordNotFound means the rewrite addressed by an operation doesn't exist
+	ErrRecordNotFound = errors.New("record not found")
+
+	// ErrProfileUnavailable means the profile can't be accessed: it doesn't
+	// exist or the API key isn't authorized for it
+	ErrProfileUnavailable = errors.New("profile unavailable")
+
+	// ErrWriteNotVisible means a created rewrite still wasn't listed after
+	// the VERIFY_WRITES_ATTEMPTS re-checks
+	ErrWriteNotVisible = errors.New("written record not visible")
+
+	// ErrQuotaExceeded means NextDNS rejected a create because the profile
+	// has reached its rewrite quota
+	ErrQuotaExceeded = errors.New("rewrite quota exceeded")
+)
+
+// APIError is a NextDNS API call that NextDNS answered with an error.
+// Client calls return it, wrapped, for every such failure, so callers can
+// check the status with errors.As instead of matching error messages. It
+// unwraps to the SDK's *nextdns.Error.
+type APIError struct {
+	// StatusCode is the HTTP status of the response. The SDK doesn't keep
+	// the code of a 5xx response it can't name, which counts as 500.
+	StatusCode int
+	Err        error
+}
+
+func (e *APIError) Error() string { return e.Err.Error() }
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// statusCodes maps the status texts the SDK reports back to their codes
+var statusCodes = func() map[string]int {
+	codes := make(map[string]int)
+	for code := 100; code < 600; code++ {
+		if text := http.StatusText(code); text != "" {
+			codes[text] = code
+		}
+	}
+	return codes
+}()
+
+// apiStatusCode returns the HTTP status of a NextDNS API error. ok is false
+// when err carries no response, e.g. a network failure.
+func apiStatusCode(err error) (code int, ok bool) {
+	var typed *APIError
+	if errors.As(err, &typed) && typed.StatusCode != 0 {
+		return typed.StatusCode, true
+	}
+	var apiErr *nextdns.Error
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	if code, ok := statusCodes[apiErr.Meta["http_status"]]; ok {
+		return code, true
+	}
+	// The SDK turns every 5xx response into a service error
+	if apiErr.Type == nextdns.ErrorTypeServiceError {
+		return http.StatusInternalServerError, true
+	}
+	return 0, false
+}
+
+// quotaErrorCodes are the API error codes NextDNS uses for a full profile
+var quotaErrorCodes = []string{"quotaExceeded", "limitReached"}
+
+// classifyAPIError wraps a NextDNS API error with the matching sentinel.
+// notFound is the sentinel for a 404, which depends on what was requested:
+// ErrProfileUnavailable when listing, ErrRecordNotFound when addressing a
+// single rewrite. Other errors are returned unchanged.
+func classifyAPIError(err error, notFound error) error {
+	var apiErr *nextdns.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case apiErr.Type == nextdns.ErrorTypeAuthentication,
+		apiErr.Meta["http_status"] == http.StatusText(http.StatusUnauthorized):
+		return fmt.Errorf("%w: %w", ErrProfileUnavailable, err)
+	case apiErr.Type == nextdns.ErrorTypeNotFound:
+		return fmt.Errorf("%w: %w", notFound, err)
+	case hasErrorCode(apiErr, "duplicate"):
+		return fmt.Errorf("%w: %w", ErrRecordConflict, err)
+	case slices.ContainsFunc(quotaErrorCodes, func(code string) bool { return hasErrorCode(apiErr, code) }):
+		return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+	}
+	return err
+}
+
+// normalizeAPIError makes SDK errors safe to format and wraps them in an
+// *APIError carrying the status code. The SDK builds 5xx errors without an
+// error response, and its Error method dereferences it, so printing one
+// panics; an empty response formats as the message alone.
+func normalizeAPIError(err error) error {
+	var apiErr *nextdns.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	if apiErr.Errors == nil {
+		apiErr.Errors = &nextdns.ErrorResponse{}
+	}
+	var typed *APIError
+	if errors.As(err, &typed) {
+		return err
+	}
+	code, _ := apiStatusCode(err)
+	return &APIError{StatusCode: code, Err: err}
+}
+
+// statusClass returns the HTTP status class ("4xx", "5xx") of a NextDNS API
+// error, or "network" when the call failed without an HTTP response
+func statusClass(err error) string {
+	var apiErr *nextdns.Error
+	if !errors.As(err, &apiErr) {
+		return "network"
+	}
+	if code, ok := apiStatusCode(err); ok && code >= http.StatusInternalServerError {
+		return "5xx"
+	}
+	return "4xx"
+}
+
+// hasErrorCode reports whether the API error response includes code
+func hasErrorCode(apiErr *nextdns.Error, code string) bool {
+	if apiErr.Errors == nil {
+		return false
+	}
+	for _, e := range apiErr.Errors.Errors {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// failureClass labels a final (post-retry) error for metrics: transient if
+// retrying later could succeed, permanent otherwise
+func failureClass(err error) string {
+	if isRetryableError(err) {
+		return metrics.FailureClassTransient
+	}
+	return metrics.FailureClassPermanent
+}
@@ -0,0 +1,187 @@
+package nextdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// TestApplyChanges_SentinelErrors verifies that API failures surface from
+// ApplyChanges wrapping the matching sentinel error.
+func TestApplyChanges_SentinelErrors(t *testing.T) {
+	create := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+	}
+	remove := &plan.Changes{
+		Delete: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(f *fakeNextDNS)
+		profile string
+		changes *plan.Changes
+		want    error
+	}{
+		{
+			name:    "duplicate create is a conflict",
+			setup:   func(f *fakeNextDNS) { f.createErrorCode = "duplicate" },
+			changes: create,
+			want:    ErrRecordConflict,
+		},
+		{
+			name: "rewrite that keeps disappearing is not found",
+			setup: func(f *fakeNextDNS) {
+				f.add("web.example.com", "10.0.0.1")
+				// Every delete races with a recreate under a new ID
+				f.beforeDelete = func(f *fakeNextDNS, id string) {
+					if f.removeLocked(id) {
+						f.addLocked("web.example.com", "10.0.0.1")
+					}
+				}
+			},
+			changes: remove,
+			want:    ErrRecordNotFound,
+		},
+		{
+			name:    "unknown profile is unavailable",
+			profile: "other-profile",
+			changes: create,
+			want:    ErrProfileUnavailable,
+		},
+		{
+			name:    "unauthorized key is unavailable",
+			setup:   func(f *fakeNextDNS) { f.listStatus = http.StatusUnauthorized },
+			changes: create,
+			want:    ErrProfileUnavailable,
+		},
+		{
+			name: "full profile exceeds the quota",
+			setup: func(f *fakeNextDNS) {
+				f.rewriteQuota = 1
+				f.add("other.example.com", "10.0.0.9")
+			},
+			changes: create,
+			want:    ErrQuotaExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			client := fake.client()
+			if tt.profile != "" {
+				client.profileID = tt.profile
+			}
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: client,
+			}
+			provider.warm.Store(true)
+
+			err := provider.ApplyChanges(context.Background(), tt.changes)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ApplyChanges() error = %v, want errors.Is %v", err, tt.want)
+			}
+			for _, other := range []error{ErrRecordConflict, ErrRecordNotFound, ErrProfileUnavailable, ErrQuotaExceeded} {
+				if other != tt.want && errors.Is(err, other) {
+					t.Errorf("ApplyChanges() error = %v also matches %v", err, other)
+				}
+			}
+		})
+	}
+}
+
+// TestClient_APIErrorStatusCode verifies that client calls report the HTTP
+// status of a failed request as an *APIError
+func TestClient_APIErrorStatusCode(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.createStatus = status
+			client := fake.client()
+			client.retry = &retryPolicy{maxRetries: 0}
+
+			_, err := client.CreateRewrite(context.Background(), "a.example.com", "A", "10.0.0.1")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("CreateRewrite() error = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, status)
+			}
+		})
+	}
+}
+
+// TestApplyChanges_QuotaExceededMidBatch verifies that hitting the rewrite
+// quota partway through a batch reports how many creates were applied and,
+// with the skip-creates policy, still applies the batch's deletes.
+func TestApplyChanges_QuotaExceededMidBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		wantDeleted bool
+	}{
+		{name: "fail stops the batch", policy: QuotaExceededFail, wantDeleted: false},
+		{name: "skip-creates still deletes", policy: QuotaExceededSkipCreates, wantDeleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.rewriteQuota = 3
+			fake.add("old.example.com", "10.0.0.100")
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:    []string{"A", "AAAA", "CNAME"},
+					QuotaExceededPolicy: tt.policy,
+				},
+				client: fake.client(),
+			}
+			provider.warm.Store(true)
+
+			changes := &plan.Changes{
+				Delete: []*endpoint.Endpoint{{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.100"}}},
+			}
+			for i := 1; i <= 4; i++ {
+				changes.Create = append(changes.Create, &endpoint.Endpoint{
+					DNSName:    fmt.Sprintf("web%d.example.com", i),
+					RecordType: "A",
+					Targets:    []string{fmt.Sprintf("10.0.0.%d", i)},
+				})
+			}
+
+			err := provider.ApplyChanges(context.Background(), changes)
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("ApplyChanges() error = %v, want errors.Is %v", err, ErrQuotaExceeded)
+			}
+			if !strings.Contains(err.Error(), "created 2 of 4 records") {
+				t.Errorf("ApplyChanges() error = %q, want partial-apply count", err)
+			}
+			// Creates after the first refusal are not attempted
+			if fake.createCalls != 3 {
+				t.Errorf("create calls = %d, want 3", fake.createCalls)
+			}
+
+			deleted := true
+			for _, record := range fake.records() {
+				if record.Name == "old.example.com" {
+					deleted = false
+				}
+			}
+			if deleted != tt.wantDeleted {
+				t.Errorf("old record deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
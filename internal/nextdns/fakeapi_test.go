@@ -0,0 +1,274 @@
+package nextdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+)
+
+// fakeNextDNS is an in-memory implementation of the NextDNS rewrites API
+// served over HTTP. Unlike mockRewritesService it exercises the real SDK
+// client, including its request paths and error decoding.
+type fakeNextDNS struct {
+	t         *testing.T
+	server    *httptest.Server
+	profileID string
+
+	mu       sync.Mutex
+	rewrites []*nextdns.Rewrites
+	nextID   int
+
+	// Call counters per operation
+	listCalls     int
+	createCalls   int
+	deleteCalls   int
+	settingsCalls int
+
+	// listStatus, if set, makes list requests fail with this HTTP status
+	listStatus int
+
+	// createStatus, if set, makes creates fail with this HTTP status
+	createStatus int
+
+	// createErrorCode, if set, makes creates fail with this API error code
+	createErrorCode string
+
+	// rejectDeleteID, if set, makes deletes of this rewrite ID fail
+	rejectDeleteID string
+
+	// readOnly makes writes fail as they do for a read-only API key
+	readOnly bool
+
+	// rewriteQuota, if set, makes creates fail once this many rewrites exist
+	rewriteQuota int
+
+	// createdID, if set, rewrites the ID reported back for a created rewrite
+	createdID func(id string) string
+
+	// hideCreatedLists, if set, leaves each created rewrite out of this
+	// many lists after its create, like an eventually consistent API
+	hideCreatedLists int
+	hidden           map[string]int
+
+	// beforeDelete, if set, runs (with the lock held) before a delete is processed
+	beforeDelete func(f *fakeNextDNS, id string)
+}
+
+// newFakeNextDNS starts a fake NextDNS API for the "test-profile" profile.
+// The server is closed automatically when the test finishes.
+func newFakeNextDNS(t *testing.T) *fakeNextDNS {
+	t.Helper()
+
+	f := &fakeNextDNS{t: t, profileID: "test-profile"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /profiles/{profile}/rewrites", f.handleList)
+	mux.HandleFunc("POST /profiles/{profile}/rewrites", f.handleCreate)
+	mux.HandleFunc("DELETE /profiles/{profile}/rewrites/{id}", f.handleDelete)
+	mux.HandleFunc("GET /profiles/{profile}/settings", f.handleSettings)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// client returns a Client pointed at the fake API
+func (f *fakeNextDNS) client() *Client {
+	f.t.Helper()
+
+	client, err := NewClient("test-key", f.profileID, f.server.URL)
+	if err != nil {
+		f.t.Fatalf("NewClient() failed: %v", err)
+	}
+	return client
+}
+
+// add stores a rewrite directly (bypassing the API) and returns its ID
+func (f *fakeNextDNS) add(name, content string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addLocked(name, content)
+}
+
+func (f *fakeNextDNS) addLocked(name, content string) string {
+	f.nextID++
+	id := fmt.Sprintf("fake-%d", f.nextID)
+	f.rewrites = append(f.rewrites, &nextdns.Rewrites{
+		ID:      id,
+		Name:    name,
+		Type:    rewriteType(content),
+		Content: content,
+	})
+	return id
+}
+
+// removeLocked deletes the rewrite with the given ID, reporting whether it existed
+func (f *fakeNextDNS) removeLocked(id string) bool {
+	for i, rewrite := range f.rewrites {
+		if rewrite.ID == id {
+			f.rewrites = append(f.rewrites[:i], f.rewrites[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// records returns a snapshot of the stored rewrites
+func (f *fakeNextDNS) records() []nextdns.Rewrites {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := make([]nextdns.Rewrites, 0, len(f.rewrites))
+	for _, rewrite := range f.rewrites {
+		out = append(out, *rewrite)
+	}
+	return out
+}
+
+func (f *fakeNextDNS) handleList(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listCalls++
+
+	if !f.checkProfile(w, r) {
+		return
+	}
+	if f.listStatus != 0 {
+		writeAPIError(w, f.listStatus, "listFailed")
+		return
+	}
+	visible := make([]*nextdns.Rewrites, 0, len(f.rewrites))
+	for _, rewrite := range f.rewrites {
+		if f.hidden[rewrite.ID] > 0 {
+			f.hidden[rewrite.ID]--
+			continue
+		}
+		visible = append(visible, rewrite)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": visible})
+}
+
+func (f *fakeNextDNS) handleCreate(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.createCalls++
+
+	if !f.checkProfile(w, r) {
+		return
+	}
+
+	if f.readOnly {
+		writeAPIError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if f.createStatus != 0 {
+		writeAPIError(w, f.createStatus, "createFailed")
+		return
+	}
+	if f.createErrorCode != "" {
+		writeAPIError(w, http.StatusBadRequest, f.createErrorCode)
+		return
+	}
+	if f.rewriteQuota > 0 && len(f.rewrites) >= f.rewriteQuota {
+		writeAPIError(w, http.StatusBadRequest, "quotaExceeded")
+		return
+	}
+
+	var body nextdns.Rewrites
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+
+	id := f.addLocked(body.Name, body.Content)
+	if f.hideCreatedLists > 0 {
+		if f.hidden == nil {
+			f.hidden = make(map[string]int)
+		}
+		f.hidden[id] = f.hideCreatedLists
+	}
+
+	created := *f.rewrites[len(f.rewrites)-1]
+	if f.createdID != nil {
+		created.ID = f.createdID(created.ID)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": created})
+}
+
+func (f *fakeNextDNS) handleDelete(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteCalls++
+
+	if !f.checkProfile(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	if id == f.rejectDeleteID {
+		writeAPIError(w, http.StatusBadRequest, "invalid")
+		return
+	}
+	if f.beforeDelete != nil {
+		f.beforeDelete(f, id)
+	}
+
+	if !f.removeLocked(id) {
+		writeAPIError(w, http.StatusNotFound, "notFound")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeNextDNS) handleSettings(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.settingsCalls++
+
+	if !f.checkProfile(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{}})
+}
+
+// checkProfile rejects requests for profiles other than the fake's own
+func (f *fakeNextDNS) checkProfile(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("profile") != f.profileID {
+		writeAPIError(w, http.StatusNotFound, "notFound")
+		return false
+	}
+	return true
+}
+
+// rewriteType mirrors how NextDNS infers the record type from the content
+func rewriteType(content string) string {
+	ip := net.ParseIP(content)
+	switch {
+	case ip == nil:
+		return "CNAME"
+	case ip.To4() != nil:
+		return "A"
+	default:
+		return "AAAA"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes an error body in the NextDNS API format
+func writeAPIError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]any{
+		"errors": []map[string]string{{"code": code}},
+	})
+}
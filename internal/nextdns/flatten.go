@@ -0,0 +1,168 @@
+package nextdns
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// flattenLookupTimeout bounds the lookups of one AdjustEndpoints call
+const flattenLookupTimeout = 5 * time.Second
+
+// cnameFlattener resolves the targets of apex CNAMEs for FLATTEN_CNAME,
+// caching each answer briefly so every sync doesn't query DNS again
+type cnameFlattener struct {
+	resolver hostResolver
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]flattenedTarget
+}
+
+// flattenedTarget is a cached lookup of one CNAME target
+type flattenedTarget struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newCNAMEFlattener returns a flattener that looks targets up with resolver
+// and caches each answer for ttl
+func newCNAMEFlattener(resolver hostResolver, ttl time.Duration) *cnameFlattener {
+	return &cnameFlattener{
+		resolver: resolver,
+		ttl:      ttl,
+		now:      time.Now,
+		cache:    make(map[string]flattenedTarget),
+	}
+}
+
+// newFlattenResolver returns a resolver that sends queries to server
+// ("host:port"), or the system resolver when server is empty
+func newFlattenResolver(server string) hostResolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// lookup returns the addresses target resolves to, from the cache while the
+// last answer is fresh
+func (f *cnameFlattener) lookup(ctx context.Context, target string) ([]string, error) {
+	key := strings.ToLower(strings.TrimSuffix(target, "."))
+
+	f.mu.Lock()
+	cached, ok := f.cache[key]
+	f.mu.Unlock()
+	if ok && f.now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := f.resolver.LookupHost(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.cache[key] = flattenedTarget{addrs: addrs, expires: f.now().Add(f.ttl)}
+	f.mu.Unlock()
+	return addrs, nil
+}
+
+// isZoneApex reports whether dnsName is one of the DOMAIN_FILTER domains
+func (p *Provider) isZoneApex(dnsName string) bool {
+	name := strings.TrimSuffix(dnsName, ".")
+	return slices.ContainsFunc(p.config.DomainFilter, func(domain string) bool {
+		return strings.EqualFold(name, strings.TrimSuffix(strings.TrimPrefix(domain, "."), "."))
+	})
+}
+
+// flattenApexCNAMEs replaces each CNAME endpoint at a zone apex with A and
+// AAAA endpoints holding the addresses its targets resolve to. An endpoint
+// whose targets can't all be resolved is kept as a CNAME.
+func (p *Provider) flattenApexCNAMEs(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if p.flattener == nil {
+		return endpoints
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flattenLookupTimeout)
+	defer cancel()
+
+	result := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if !strings.EqualFold(ep.RecordType, endpoint.RecordTypeCNAME) || !p.isZoneApex(ep.DNSName) {
+			result = append(result, ep)
+			continue
+		}
+
+		flattened, err := p.flattenCNAME(ctx, ep)
+		if err != nil {
+			slog.Warn("Failed to flatten apex CNAME, keeping it as a CNAME",
+				"dns_name", ep.DNSName,
+				"target", ep.Targets,
+				"error", err)
+			result = append(result, ep)
+			continue
+		}
+		slog.Debug("Flattened apex CNAME", "dns_name", ep.DNSName, "target", ep.Targets)
+		result = append(result, flattened...)
+	}
+	return result
+}
+
+// flattenCNAME resolves every target of ep and returns an A endpoint for
+// the IPv4 addresses and an AAAA endpoint for the IPv6 ones, whichever exist
+func (p *Provider) flattenCNAME(ctx context.Context, ep *endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	var v4, v6 []string
+	for _, target := range ep.Targets {
+		addrs, err := p.flattener.lookup(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			switch {
+			case ip == nil:
+				continue
+			case ip.To4() != nil:
+				v4 = append(v4, ip.String())
+			default:
+				v6 = append(v6, ip.String())
+			}
+		}
+	}
+
+	var flattened []*endpoint.Endpoint
+	for _, family := range []struct {
+		recordType string
+		addrs      []string
+	}{
+		{endpoint.RecordTypeA, v4},
+		{endpoint.RecordTypeAAAA, v6},
+	} {
+		if len(family.addrs) == 0 {
+			continue
+		}
+		slices.Sort(family.addrs)
+		flat := ep.DeepCopy()
+		flat.RecordType = family.recordType
+		flat.Targets = slices.Compact(family.addrs)
+		flattened = append(flattened, flat)
+	}
+	if len(flattened) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: strings.Join(ep.Targets, ","), IsNotFound: true}
+	}
+	return flattened, nil
+}
@@ -0,0 +1,116 @@
+package nextdns
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestAdjustEndpoints_FlattenApexCNAME(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  *endpoint.Endpoint
+		wantTypes []string
+		want      map[string][]string
+	}{
+		{
+			name:      "apex CNAME flattened to A and AAAA",
+			endpoint:  &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: []string{"lb.provider.net"}},
+			wantTypes: []string{"A", "AAAA"},
+			want:      map[string][]string{"A": {"10.0.0.1", "10.0.0.2"}, "AAAA": {"2001:db8::1"}},
+		},
+		{
+			name:      "IPv4-only target",
+			endpoint:  &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: []string{"v4.provider.net"}},
+			wantTypes: []string{"A"},
+			want:      map[string][]string{"A": {"10.0.0.3"}},
+		},
+		{
+			name:      "CNAME below the apex is kept",
+			endpoint:  &endpoint.Endpoint{DNSName: "www.example.com", RecordType: "CNAME", Targets: []string{"lb.provider.net"}},
+			wantTypes: []string{"CNAME"},
+			want:      map[string][]string{"CNAME": {"lb.provider.net"}},
+		},
+		{
+			name:      "unresolvable target is kept as a CNAME",
+			endpoint:  &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: []string{"gone.provider.net"}},
+			wantTypes: []string{"CNAME"},
+			want:      map[string][]string{"CNAME": {"gone.provider.net"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &stubResolver{hosts: map[string][]string{
+				"lb.provider.net": {"10.0.0.2", "2001:db8::1", "10.0.0.1"},
+				"v4.provider.net": {"10.0.0.3"},
+			}}
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+					DomainFilter:     []string{"example.com"},
+				},
+				flattener: newCNAMEFlattener(resolver, time.Minute),
+			}
+
+			adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{tt.endpoint})
+			if err != nil {
+				t.Fatalf("AdjustEndpoints() error = %v", err)
+			}
+
+			var gotTypes []string
+			got := make(map[string][]string)
+			for _, ep := range adjusted {
+				gotTypes = append(gotTypes, ep.RecordType)
+				got[ep.RecordType] = ep.Targets
+				if ep.DNSName != tt.endpoint.DNSName {
+					t.Errorf("DNSName = %q, want %q", ep.DNSName, tt.endpoint.DNSName)
+				}
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("record types = %v, want %v", gotTypes, tt.wantTypes)
+			}
+			for recordType, targets := range tt.want {
+				if !reflect.DeepEqual([]string(got[recordType]), targets) {
+					t.Errorf("%s targets = %v, want %v", recordType, got[recordType], targets)
+				}
+			}
+		})
+	}
+}
+
+func TestCNAMEFlattener_Cache(t *testing.T) {
+	resolver := &stubResolver{hosts: map[string][]string{"lb.provider.net": {"10.0.0.1"}}}
+	now := time.Now()
+	flattener := newCNAMEFlattener(resolver, 30*time.Second)
+	flattener.now = func() time.Time { return now }
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+			DomainFilter:     []string{"example.com"},
+		},
+		flattener: flattener,
+	}
+
+	adjust := func() {
+		t.Helper()
+		ep := &endpoint.Endpoint{DNSName: "example.com", RecordType: "CNAME", Targets: []string{"LB.provider.net."}}
+		if _, err := provider.AdjustEndpoints([]*endpoint.Endpoint{ep}); err != nil {
+			t.Fatalf("AdjustEndpoints() error = %v", err)
+		}
+	}
+
+	adjust()
+	adjust()
+	if len(resolver.lookups) != 1 {
+		t.Errorf("lookups within the cache TTL = %d, want 1", len(resolver.lookups))
+	}
+
+	now = now.Add(31 * time.Second)
+	adjust()
+	if len(resolver.lookups) != 2 {
+		t.Errorf("lookups after the cache TTL = %d, want 2", len(resolver.lookups))
+	}
+}
@@ -0,0 +1,69 @@
+package nextdns
+
+import (
+	"sync"
+	"time"
+)
+
+// Values for HistoryEntry.Outcome
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// HistoryEntry describes a single record change that was applied (or failed)
+type HistoryEntry struct {
+	DNSName    string    `json:"dns_name"`
+	RecordType string    `json:"record_type"`
+	Action     string    `json:"action"`
+	Timestamp  time.Time `json:"timestamp"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// changeHistory is a fixed-size ring buffer of the most recent applied
+// changes. A nil *changeHistory records nothing.
+type changeHistory struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+// newChangeHistory creates a history holding at most size entries
+func newChangeHistory(size int) *changeHistory {
+	return &changeHistory{entries: make([]HistoryEntry, size)}
+}
+
+// record adds an entry, evicting the oldest once the buffer is full
+func (h *changeHistory) record(entry HistoryEntry) {
+	if h == nil || len(h.entries) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the recorded entries, oldest first
+func (h *changeHistory) list() []HistoryEntry {
+	if h == nil {
+		return []HistoryEntry{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]HistoryEntry{}, h.entries[:h.next]...)
+	}
+	result := make([]HistoryEntry, 0, len(h.entries))
+	result = append(result, h.entries[h.next:]...)
+	return append(result, h.entries[:h.next]...)
+}
@@ -0,0 +1,97 @@
+package nextdns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestChangeHistory_CapsAtSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		records   int
+		wantNames []string
+	}{
+		{name: "empty", size: 3, records: 0, wantNames: []string{}},
+		{name: "below capacity", size: 3, records: 2, wantNames: []string{"r0", "r1"}},
+		{name: "exactly full", size: 3, records: 3, wantNames: []string{"r0", "r1", "r2"}},
+		{name: "wrapped", size: 3, records: 7, wantNames: []string{"r4", "r5", "r6"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := newChangeHistory(tt.size)
+			for i := 0; i < tt.records; i++ {
+				history.record(HistoryEntry{DNSName: fmt.Sprintf("r%d", i)})
+			}
+
+			got := history.list()
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("list() returned %d entries, want %d", len(got), len(tt.wantNames))
+			}
+			for i, name := range tt.wantNames {
+				if got[i].DNSName != name {
+					t.Errorf("entry %d = %q, want %q", i, got[i].DNSName, name)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyChanges_RecordsHistory(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config:  &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client:  fake.client(),
+		history: newChangeHistory(10),
+	}
+	provider.warm.Store(true)
+	ctx := context.Background()
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(ctx, changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	changes = &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(ctx, changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	got := provider.History()
+	if len(got) != 2 {
+		t.Fatalf("History() returned %d entries, want 2: %+v", len(got), got)
+	}
+	want := []struct{ action, name string }{
+		{"create", "web.example.com"},
+		{"delete", "web.example.com"},
+	}
+	for i, w := range want {
+		if got[i].Action != w.action || got[i].DNSName != w.name || got[i].RecordType != "A" {
+			t.Errorf("entry %d = %+v, want %s %s A", i, got[i], w.action, w.name)
+		}
+		if got[i].Outcome != OutcomeSuccess || got[i].Timestamp.IsZero() {
+			t.Errorf("entry %d outcome = %q, timestamp = %v, want success with a timestamp", i, got[i].Outcome, got[i].Timestamp)
+		}
+	}
+}
+
+func TestHistory_DisabledWithoutDebugEndpoints(t *testing.T) {
+	provider := &Provider{config: &Config{}}
+	provider.recordOutcome("create", &endpoint.Endpoint{DNSName: "web.example.com"}, nil)
+	if got := provider.History(); len(got) != 0 {
+		t.Errorf("History() = %+v, want empty when history is disabled", got)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package nextdns
+
+import (
+	"context"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// TestIntegration_RecordLifecycle drives a full create/read/update/delete
+// cycle through the provider against the fake NextDNS API, the way
+// external-dns would across successive sync loops.
+func TestIntegration_RecordLifecycle(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{
+			ProfileID:        fake.profileID,
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+		},
+		client: fake.client(),
+	}
+	ctx := context.Background()
+
+	records := func() []*endpoint.Endpoint {
+		t.Helper()
+		eps, err := provider.Records(ctx)
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		return eps
+	}
+	apply := func(changes *plan.Changes) {
+		t.Helper()
+		if err := provider.ApplyChanges(ctx, changes); err != nil {
+			t.Fatalf("ApplyChanges() error = %v", err)
+		}
+	}
+
+	// First sync: nothing exists yet
+	if got := records(); len(got) != 0 {
+		t.Fatalf("initial Records() = %v, want none", got)
+	}
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "www.example.com", RecordType: "CNAME", Targets: []string{"web.example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	apply(&plan.Changes{Create: desired})
+
+	got := records()
+	if len(got) != 2 {
+		t.Fatalf("Records() after create = %v, want 2 records", got)
+	}
+
+	// Second sync: the A record moves to a new address
+	var oldA *endpoint.Endpoint
+	for _, ep := range got {
+		if ep.RecordType == "A" {
+			oldA = ep
+		}
+	}
+	if oldA == nil {
+		t.Fatalf("Records() = %v, missing the A record", got)
+	}
+	newA := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}, RecordTTL: DefaultTTL}
+	apply(&plan.Changes{UpdateOld: []*endpoint.Endpoint{oldA}, UpdateNew: []*endpoint.Endpoint{newA}})
+
+	stored := fake.records()
+	if len(stored) != 2 {
+		t.Fatalf("stored records after update = %v, want 2", stored)
+	}
+	for _, rewrite := range stored {
+		if rewrite.Name == "web.example.com" && rewrite.Content != "10.0.0.2" {
+			t.Errorf("web.example.com = %s after update, want 10.0.0.2", rewrite.Content)
+		}
+	}
+
+	// Final sync: everything is removed from the cluster
+	apply(&plan.Changes{Delete: records()})
+	if got := records(); len(got) != 0 {
+		t.Errorf("Records() after delete = %v, want none", got)
+	}
+}
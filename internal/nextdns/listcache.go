@@ -0,0 +1,82 @@
+package nextdns
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+)
+
+// listCache memoizes the profile's rewrite listing for CACHE_TTL, so the
+// listings of one reconcile (Records, the delete threshold, index rebuilds)
+// share a single API call. Creates and deletes invalidate it. The zero
+// value, with no TTL, caches nothing.
+type listCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	rewrites []*nextdns.Rewrites
+	expires  time.Time
+	// generation advances on every invalidation, so a listing that was in
+	// flight during a write isn't stored over it
+	generation uint64
+}
+
+// newListCache returns a cache that keeps each listing for ttl
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{ttl: ttl, now: time.Now}
+}
+
+// get returns the cached listing while it is fresh
+func (l *listCache) get() ([]*nextdns.Rewrites, bool) {
+	if l == nil || l.ttl <= 0 {
+		return nil, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rewrites == nil || !l.now().Before(l.expires) {
+		return nil, false
+	}
+	return slices.Clone(l.rewrites), true
+}
+
+// start returns the generation a listing about to be fetched belongs to
+func (l *listCache) start() uint64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.generation
+}
+
+// put stores a listing fetched in generation, unless the cache has been
+// invalidated since
+func (l *listCache) put(generation uint64, rewrites []*nextdns.Rewrites) {
+	if l == nil || l.ttl <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if generation != l.generation {
+		return
+	}
+	l.rewrites = slices.Clone(rewrites)
+	if l.rewrites == nil {
+		l.rewrites = []*nextdns.Rewrites{}
+	}
+	l.expires = l.now().Add(l.ttl)
+}
+
+// invalidate drops the cached listing
+func (l *listCache) invalidate() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rewrites = nil
+	l.generation++
+}
@@ -0,0 +1,111 @@
+package nextdns
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListRewrites_Cache(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("a.example.com", "10.0.0.1")
+	client := fake.client()
+	now := time.Now()
+	client.list = newListCache(10 * time.Second)
+	client.list.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	listCalls := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return fake.listCalls
+	}
+	list := func(want int) {
+		t.Helper()
+		rewrites, err := client.ListRewrites(ctx)
+		if err != nil {
+			t.Fatalf("ListRewrites() error = %v", err)
+		}
+		if len(rewrites) != want {
+			t.Errorf("ListRewrites() returned %d rewrites, want %d", len(rewrites), want)
+		}
+	}
+
+	list(1)
+	list(1)
+	if got := listCalls(); got != 1 {
+		t.Errorf("API listings within the TTL = %d, want 1", got)
+	}
+
+	// A create drops the cached listing
+	if _, err := client.CreateRewrite(ctx, "b.example.com", "A", "10.0.0.2"); err != nil {
+		t.Fatalf("CreateRewrite() error = %v", err)
+	}
+	list(2)
+	if got := listCalls(); got != 2 {
+		t.Errorf("API listings after a create = %d, want 2", got)
+	}
+
+	// So does a delete
+	rewrites, _ := client.ListRewrites(ctx)
+	if err := client.DeleteRewrite(ctx, rewrites[0].ID); err != nil {
+		t.Fatalf("DeleteRewrite() error = %v", err)
+	}
+	list(1)
+	if got := listCalls(); got != 3 {
+		t.Errorf("API listings after a delete = %d, want 3", got)
+	}
+
+	now = now.Add(11 * time.Second)
+	list(1)
+	if got := listCalls(); got != 4 {
+		t.Errorf("API listings after the TTL = %d, want 4", got)
+	}
+}
+
+// TestListCache_ConcurrentAccess runs reads, listings and invalidations
+// together; run with -race to catch unsynchronized access
+func TestListCache_ConcurrentAccess(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("a.example.com", "10.0.0.1")
+	client := fake.client()
+	client.list = newListCache(time.Minute)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if i%4 == 0 {
+					client.list.invalidate()
+					continue
+				}
+				rewrites, err := client.ListRewrites(ctx)
+				if err != nil {
+					t.Errorf("ListRewrites() error = %v", err)
+					return
+				}
+				if len(rewrites) != 1 {
+					t.Errorf("ListRewrites() returned %d rewrites, want 1", len(rewrites))
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestListCache_StaleListingNotStored(t *testing.T) {
+	cache := newListCache(time.Minute)
+
+	generation := cache.start()
+	cache.invalidate() // a write lands while the listing is in flight
+	cache.put(generation, nil)
+
+	if _, ok := cache.get(); ok {
+		t.Error("listing fetched before an invalidation should not be cached")
+	}
+}
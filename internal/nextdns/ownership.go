@@ -0,0 +1,132 @@
+package nextdns
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+	"sigs.k8s.io/external-dns/endpoint"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
+)
+
+// NextDNS rewrites only hold A, AAAA and CNAME content, so the ownership TXT
+// records written by external-dns's txt registry are stored as CNAME
+// rewrites in a separate namespace: the rewrite is named
+// "<ownershipLabel>.<TXT name>" and its target carries the heritage string,
+// base32-encoded into labels under ownershipTargetSuffix. The TXT name is
+// kept as external-dns sent it, so registry prefixes and suffixes survive.
+const (
+	ownershipLabel        = "edns-owner"
+	ownershipTargetSuffix = "owner.invalid"
+)
+
+// ownershipEncoding is DNS-safe: lowercase letters and digits only
+var ownershipEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// isOwnershipRecord reports whether ep is a registry TXT record the provider
+// stores as an ownership rewrite
+func (p *Provider) isOwnershipRecord(ep *endpoint.Endpoint) bool {
+	return p.config.TXTRegistryEnabled && strings.EqualFold(ep.RecordType, endpoint.RecordTypeTXT)
+}
+
+// encodeOwnership returns the rewrite name and content storing a heritage
+// TXT target for dnsName. Only plain (unencrypted) heritage values are
+// accepted, so unrelated TXT records are never stored.
+func encodeOwnership(dnsName, target string) (string, string, error) {
+	if _, err := endpoint.NewLabelsFromStringPlain(target); err != nil {
+		return "", "", fmt.Errorf("TXT target %q is not an external-dns heritage record: %w", target, err)
+	}
+
+	// external-dns quotes TXT targets; the quotes aren't stored
+	value := target
+	if unquoted, err := strconv.Unquote(target); err == nil {
+		value = unquoted
+	}
+	encoded := strings.ToLower(ownershipEncoding.EncodeToString([]byte(value)))
+
+	var labels []string
+	for len(encoded) > 63 {
+		labels = append(labels, encoded[:63])
+		encoded = encoded[63:]
+	}
+	labels = append(labels, encoded, ownershipTargetSuffix)
+	content := strings.Join(labels, ".")
+	if len(content) > 253 {
+		return "", "", fmt.Errorf("TXT target %q is too long to store as an ownership record", target)
+	}
+
+	return ownershipLabel + "." + dnsName, content, nil
+}
+
+// decodeOwnership turns an ownership rewrite back into the TXT name and
+// quoted heritage target external-dns wrote. ok is false for other rewrites.
+func decodeOwnership(rewrite *nextdns.Rewrites) (dnsName, target string, ok bool) {
+	dnsName, isOwnership := strings.CutPrefix(rewrite.Name, ownershipLabel+".")
+	encoded, hasSuffix := strings.CutSuffix(strings.TrimSuffix(rewrite.Content, "."), "."+ownershipTargetSuffix)
+	if !isOwnership || !hasSuffix || rewrite.Type != endpoint.RecordTypeCNAME {
+		return "", "", false
+	}
+
+	value, err := ownershipEncoding.DecodeString(strings.ToUpper(strings.ReplaceAll(encoded, ".", "")))
+	if err != nil {
+		return "", "", false
+	}
+	return dnsName, strconv.Quote(string(value)), true
+}
+
+// createOwnershipRecord stores each heritage target of a registry TXT
+// endpoint, replacing an ownership rewrite that holds a different value
+func (p *Provider) createOwnershipRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	for _, target := range uniqueTargets(ep.Targets) {
+		name, content, err := encodeOwnership(p.normalizeName(ep.DNSName), target)
+		if err != nil {
+			return err
+		}
+
+		existing, found, err := p.client.FindRewriteByName(ctx, name, endpoint.RecordTypeCNAME)
+		if err != nil {
+			return fmt.Errorf("failed to check for existing ownership record: %w", err)
+		}
+		if found && existing.Content == content {
+			continue
+		}
+		if found {
+			if err := p.deleteRewrite(ctx, existing.ID, name, endpoint.RecordTypeCNAME, existing.Content); err != nil {
+				return fmt.Errorf("failed to replace ownership record: %w", err)
+			}
+		}
+
+		if _, err := p.client.CreateRewrite(ctx, name, endpoint.RecordTypeCNAME, content); err != nil {
+			return fmt.Errorf("failed to create ownership record: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteOwnershipRecord removes the ownership rewrites of a registry TXT
+// endpoint. Rewrites that are already gone count as deleted.
+func (p *Provider) deleteOwnershipRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	for _, target := range ep.Targets {
+		name, content, err := encodeOwnership(p.normalizeName(ep.DNSName), target)
+		if err != nil {
+			return err
+		}
+
+		existing, found, err := p.client.FindRewriteByContent(ctx, name, endpoint.RecordTypeCNAME, content)
+		if err != nil {
+			return fmt.Errorf("failed to find ownership record for deletion: %w", err)
+		}
+		if !found {
+			metrics.DeleteOutcomes.WithLabelValues(metrics.DeleteOutcomeAbsent).Inc()
+			continue
+		}
+		if err := p.deleteRewrite(ctx, existing.ID, name, endpoint.RecordTypeCNAME, content); err != nil {
+			return fmt.Errorf("failed to delete ownership record: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package nextdns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// TestOwnershipRecords_RoundTrip verifies that heritage TXT records written
+// through ApplyChanges come back from Records unchanged, alongside the
+// records they own, and can be deleted again.
+func TestOwnershipRecords_RoundTrip(t *testing.T) {
+	heritage := `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/web"`
+	// Long enough to need several labels in the encoded target
+	longHeritage := `"heritage=external-dns,external-dns/owner=cluster-with-a-long-name,external-dns/resource=ingress/some-namespace/some-ingress-name"`
+
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, TXTRegistryEnabled: true},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	owned := []*endpoint.Endpoint{
+		{DNSName: "a-web.example.com", RecordType: "TXT", Targets: []string{heritage}},
+		{DNSName: "web.example.com", RecordType: "TXT", Targets: []string{heritage}},
+		{DNSName: "prefix.cname-api.example.com", RecordType: "TXT", Targets: []string{longHeritage}},
+	}
+	changes := &plan.Changes{
+		Create: append([]*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		}, owned...),
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// Ownership rewrites live in their own namespace, never at the owned name
+	for _, record := range fake.records() {
+		if record.Name == "web.example.com" && record.Type != "A" {
+			t.Errorf("ownership record stored at the owned name: %+v", record)
+		}
+	}
+
+	records, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	got := map[string]string{}
+	for _, ep := range records {
+		if ep.RecordType == "TXT" {
+			got[ep.DNSName] = strings.Join(ep.Targets, ",")
+		}
+	}
+	for _, ep := range owned {
+		if got[ep.DNSName] != ep.Targets[0] {
+			t.Errorf("Records() TXT %s = %q, want %q", ep.DNSName, got[ep.DNSName], ep.Targets[0])
+		}
+	}
+	if len(got) != len(owned) {
+		t.Errorf("Records() returned %d TXT records, want %d", len(got), len(owned))
+	}
+
+	if err := provider.ApplyChanges(context.Background(), &plan.Changes{Delete: owned}); err != nil {
+		t.Fatalf("ApplyChanges() delete error = %v", err)
+	}
+	if remaining := fake.records(); len(remaining) != 1 || remaining[0].Name != "web.example.com" {
+		t.Errorf("records after deleting ownership = %v, want only the A record", remaining)
+	}
+}
+
+func TestEncodeOwnership_RejectsNonHeritage(t *testing.T) {
+	for _, target := range []string{`"v=spf1 -all"`, `"heritage=someone-else,external-dns/owner=default"`} {
+		if _, _, err := encodeOwnership("web.example.com", target); err == nil {
+			t.Errorf("encodeOwnership(%q) expected error", target)
+		}
+	}
+}
+
+func TestOwnershipRecords_DisabledByDefault(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "TXT", Targets: []string{`"heritage=external-dns"`}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if fake.createCalls != 0 {
+		t.Errorf("create calls = %d, want TXT skipped without TXT_REGISTRY_ENABLED", fake.createCalls)
+	}
+}
+
+func TestAdjustEndpoints_KeepsOwnershipRecords(t *testing.T) {
+	endpoints := func() []*endpoint.Endpoint {
+		return []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			{DNSName: "prefix.a-web.example.com", RecordType: "TXT", Targets: []string{`"heritage=external-dns,external-dns/owner=default"`}},
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		enabled bool
+		want    int
+	}{
+		{name: "enabled", enabled: true, want: 2},
+		{name: "disabled", enabled: false, want: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, TXTRegistryEnabled: tt.enabled},
+			}
+
+			adjusted, err := provider.AdjustEndpoints(endpoints())
+			if err != nil {
+				t.Fatalf("AdjustEndpoints() error = %v", err)
+			}
+			if len(adjusted) != tt.want {
+				t.Errorf("AdjustEndpoints() returned %d endpoints, want %d", len(adjusted), tt.want)
+			}
+		})
+	}
+}
+
+// TestOwnershipRecords_DeleteThreshold verifies that ownership rewrites are
+// left out of the delete threshold, so the records they own are what it
+// measures.
+func TestOwnershipRecords_DeleteThreshold(t *testing.T) {
+	heritage := `"heritage=external-dns,external-dns/owner=default"`
+
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, TXTRegistryEnabled: true, MaxDeleteFraction: 0.4},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	records := []*endpoint.Endpoint{
+		{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "a-web.example.com", RecordType: "TXT", Targets: []string{heritage}},
+		{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		{DNSName: "a-api.example.com", RecordType: "TXT", Targets: []string{heritage}},
+	}
+	if err := provider.ApplyChanges(context.Background(), &plan.Changes{Create: records}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// One of two owned records is half the profile; counting the ownership
+	// rewrites as managed would make it a quarter and let it through
+	err := provider.checkDeleteThreshold(context.Background(), &plan.Changes{Delete: records[:2]})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 managed records") {
+		t.Errorf("checkDeleteThreshold() error = %v, want 1 of 2 managed records refused", err)
+	}
+}
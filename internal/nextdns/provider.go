@@ -2,13 +2,24 @@ package nextdns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 )
 
 // overwriteAnnotationKey is the Kubernetes annotation key used to control
@@ -16,29 +27,128 @@ import (
 // it allows the provider to overwrite existing DNS records.
 const overwriteAnnotationKey = "external-dns.alpha.kubernetes.io/nextdns-allow-overwrite"
 
+// overwritePropertyKey is a per-endpoint provider-specific property that
+// controls overwrite behavior for that record. When set ("true" or "false")
+// it takes precedence over overwriteAnnotationKey.
+const overwritePropertyKey = "nextdns-webhook/overwrite"
+
+// rewriteIDProperty is the provider-specific property holding the NextDNS ID
+// of the rewrite behind an endpoint. Records doesn't report it (the planner
+// would see it as a difference from every desired endpoint), but deletes use
+// it when a caller supplies it.
+const rewriteIDProperty = "nextdns-id"
+
+// DefaultTTL is the TTL reported for NextDNS rewrites, which have no
+// per-record TTL. Endpoints with TTL 0 ("provider default") are given it.
+const DefaultTTL endpoint.TTL = 300
+
+// requestedTTLProperty is the provider-specific property that keeps an
+// endpoint's explicit TTL, since NextDNS can't store it on the rewrite
+const requestedTTLProperty = "nextdns/requested-ttl"
+
+// ErrProviderNotReady is returned by ApplyChanges until Records has
+// succeeded once. Until then the provider hasn't seen the profile's existing
+// records, so external-dns should retry later (the webhook answers 503).
+var ErrProviderNotReady = errors.New("provider not ready: waiting for the first successful Records call")
+
+// implementedRecordTypes are the record types this provider can encode as
+// NextDNS rewrites
+var implementedRecordTypes = []string{
+	endpoint.RecordTypeA,
+	endpoint.RecordTypeAAAA,
+	endpoint.RecordTypeCNAME,
+}
+
+// hostResolver looks up host names; *net.Resolver implements it
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
 // Provider implements the external-dns provider interface for NextDNS
 type Provider struct {
 	provider.BaseProvider
 	config          *Config
 	client          *Client
-	discoveredNames map[string]bool // DNS names discovered from k8s resources
+	discoveredNames atomic.Pointer[map[string]bool]   // DNS names discovered from k8s resources
+	requestedTTLs   atomic.Pointer[map[string]string] // explicit TTLs by name/type, mirrored into Records
+	batcher         *changeBatcher                    // set when ApplyBatchWindow is enabled
+	history         *changeHistory                    // set when debug endpoints are enabled
+	applyErrors     *applyErrors                      // set when debug endpoints are enabled
+	resolver        hostResolver                      // CNAME target lookups; net.DefaultResolver when nil
+	flattener       *cnameFlattener                   // set when FlattenCNAME is enabled
+	domainRegex     *regexp.Regexp                    // compiled RegexDomainFilter, nil when unset
+	warm            atomic.Bool                       // set after the first successful Records call
+	sync            syncTimer                         // times each Records -> ApplyChanges cycle
 }
 
-// NewProvider creates a new NextDNS provider
+// NewProvider creates a new NextDNS provider and runs its startup checks:
+// the connection test and, when enabled, the write check
 func NewProvider(config *Config) (*Provider, error) {
+	p, err := NewUncheckedProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.startupChecks(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewUncheckedProvider creates a new NextDNS provider without contacting the
+// API, so callers like --validate can run TestConnection once themselves
+// without writing the write-check canary
+func NewUncheckedProvider(config *Config) (*Provider, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
+	// Fail fast on record types that would only error at apply time
+	if err := checkRecordTypes(config.SupportedRecords); err != nil {
+		return nil, err
+	}
+
+	var domainRegex *regexp.Regexp
+	if config.RegexDomainFilter != "" {
+		re, err := regexp.Compile(config.RegexDomainFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REGEX_DOMAIN_FILTER %q: %w", config.RegexDomainFilter, err)
+		}
+		domainRegex = re
+	}
+
 	// Create NextDNS API client
 	client, err := NewClient(config.APIKey, config.ProfileID, config.BaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NextDNS client: %w", err)
 	}
 
+	// RetryMaxAttempts counts the first attempt too
+	client.retry = &retryPolicy{maxRetries: max(config.RetryMaxAttempts-1, 0), baseDelay: config.RetryBaseDelay, jitter: config.RetryJitter}
+	client.timeout = config.APITimeout
+	client.rate = newRateLimiter(config.APIRateLimit)
+	if config.CacheTTL > 0 {
+		client.list = newListCache(config.CacheTTL)
+	}
+
+	// Back off apply concurrency while NextDNS is rate limiting
+	client.createLimit = newAdaptiveLimit(config.ApplyConcurrencyCreate, metrics.ApplyConcurrency.WithLabelValues(metrics.OperationCreate))
+	client.deleteLimit = newAdaptiveLimit(config.ApplyConcurrencyDelete, metrics.ApplyConcurrency.WithLabelValues(metrics.OperationDelete))
+
 	p := &Provider{
-		config: config,
-		client: client,
+		config:      config,
+		client:      client,
+		domainRegex: domainRegex,
+	}
+	if config.FlattenCNAME {
+		p.flattener = newCNAMEFlattener(newFlattenResolver(config.FlattenCNAMEResolver), config.FlattenCNAMECacheTTL)
+	}
+	if config.ApplyBatchWindow > 0 {
+		// A change may use every retry attempt, each up to API_TIMEOUT
+		p.batcher = newChangeBatcher(config.ApplyBatchWindow, config.APITimeout*time.Duration(max(config.RetryMaxAttempts, 1)), p.applyChanges)
+	}
+	if config.DebugEndpointsEnabled {
+		p.history = newChangeHistory(config.DebugHistorySize)
+		p.applyErrors = newApplyErrors()
 	}
 
 	slog.Info("NextDNS provider initialized",
@@ -46,10 +156,17 @@ func NewProvider(config *Config) (*Provider, error) {
 		"base_url", config.BaseURL,
 		"dry_run", config.DryRun)
 
+	return p, nil
+}
+
+// startupChecks tests the connection and, when enabled, the write check. A
+// failed connection test is only logged; a failed write check is returned.
+func (p *Provider) startupChecks(ctx context.Context) error {
+	config, client := p.config, p.client
+
 	// Test connection if not in dry-run mode
 	if !config.DryRun {
-		ctx := context.Background()
-		if err := client.TestConnection(ctx); err != nil {
+		if err := client.TestConnection(ctx, config.ConnectionTestMode); err != nil {
 			slog.Warn("Failed to connect to NextDNS API - provider will continue but may fail on actual operations", "error", err)
 			// Don't return error here - allow provider to start even if connection test fails
 			// This is useful for scenarios where API might be temporarily unavailable
@@ -57,17 +174,37 @@ func NewProvider(config *Config) (*Provider, error) {
 			slog.Info("NextDNS connection verified - successfully authenticated with NextDNS API",
 				"profile_id", config.ProfileID)
 		}
+
+		// A read-only key passes the connection test, so only an actual write
+		// proves the provider can apply changes
+		if config.WriteCheckEnabled {
+			if err := client.TestWrite(ctx, config.WriteCheckName); err != nil {
+				return err
+			}
+		}
 	} else {
 		slog.Info("Dry-run mode enabled - skipping NextDNS API connection test",
 			"profile_id", config.ProfileID)
+		if looksLikeProduction(config) {
+			slog.Warn("DRY_RUN is enabled but the configuration looks like production: no changes will be written to NextDNS. Set DRY_RUN=false if this is unintended",
+				"profile_id", config.ProfileID,
+				"domain_filter", config.DomainFilter)
+		}
 	}
 
-	return p, nil
+	return nil
 }
 
 // Records returns the list of DNS records from NextDNS
-func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
-	slog.Debug("Fetching records from NextDNS")
+func (p *Provider) Records(ctx context.Context) (endpoints []*endpoint.Endpoint, err error) {
+	ctx, span := startSpan(ctx, "nextdns.Records", attrProfileID.String(p.config.ProfileID))
+	defer func() {
+		span.SetAttributes(attribute.Int("nextdns.records", len(endpoints)))
+		endSpan(span, err)
+	}()
+
+	syncID := p.sync.begin()
+	slog.DebugContext(ctx, "Fetching records from NextDNS", "sync_id", syncID)
 
 	// Fetch all rewrites from NextDNS API
 	rewrites, err := p.client.ListRewrites(ctx)
@@ -76,23 +213,74 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	}
 
 	// Convert NextDNS rewrites to external-dns endpoints
-	endpoints := make([]*endpoint.Endpoint, 0, len(rewrites))
+	endpoints = make([]*endpoint.Endpoint, 0, len(rewrites))
 	for _, rewrite := range rewrites {
+		// Rewrites without an ID can't be deleted or updated later, so don't
+		// report them to external-dns as records it could plan changes for
+		if rewrite.ID == "" {
+			slog.WarnContext(ctx, "Skipping rewrite returned without an ID",
+				"dns_name", rewrite.Name,
+				"record_type", rewrite.Type,
+				"content", rewrite.Content)
+			metrics.RecordsSkipped.WithLabelValues(metrics.SkipReasonMissingID).Inc()
+			continue
+		}
+
+		// Report ownership rewrites as the registry TXT records they store
+		if p.config.TXTRegistryEnabled {
+			if dnsName, target, ok := decodeOwnership(rewrite); ok {
+				endpoints = append(endpoints, &endpoint.Endpoint{
+					DNSName:    p.normalizeName(dnsName),
+					Targets:    []string{target},
+					RecordType: endpoint.RecordTypeTXT,
+					RecordTTL:  DefaultTTL,
+				})
+				continue
+			}
+		}
+
+		target, err := decodeContent(rewrite.Type, rewrite.Content)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping rewrite with undecodable content",
+				"dns_name", rewrite.Name,
+				"record_type", rewrite.Type,
+				"content", rewrite.Content,
+				"error", err)
+			metrics.RecordsSkipped.WithLabelValues(metrics.SkipReasonUndecodable).Inc()
+			continue
+		}
+
 		ep := &endpoint.Endpoint{
-			DNSName:    rewrite.Name,
-			Targets:    []string{rewrite.Content},
+			DNSName:    p.normalizeName(rewrite.Name),
+			Targets:    []string{p.canonicalCNAMETarget(rewrite.Type, p.relativeCNAMETarget(rewrite.Type, target))},
 			RecordType: rewrite.Type,
+			RecordTTL:  DefaultTTL,
+		}
+		// Report the explicit TTL the desired endpoint carries so the planner
+		// doesn't see a provider-specific difference on every sync
+		if ttl, ok := p.requestedTTL(ep.DNSName, ep.RecordType); ok {
+			ep.SetProviderSpecificProperty(requestedTTLProperty, ttl)
 		}
 		endpoints = append(endpoints, ep)
 	}
 
-	slog.Info("Records fetched from NextDNS", "count", len(endpoints))
+	// Report targets in a stable order so diffs don't depend on API ordering
+	for _, ep := range endpoints {
+		slices.Sort(ep.Targets)
+	}
+
+	slog.InfoContext(ctx, "Records fetched from NextDNS", "count", len(endpoints), "sync_id", syncID)
+
+	endpoints, err = p.limitRecords(endpoints)
+	if err != nil {
+		return nil, err
+	}
 
 	// Log unmanaged records (records in NextDNS that external-dns doesn't know about)
-	if p.discoveredNames != nil {
+	if discovered := p.discoveredNames.Load(); discovered != nil {
 		for _, ep := range endpoints {
-			if !p.discoveredNames[ep.DNSName] {
-				slog.Warn("Unmanaged DNS record found in NextDNS (no matching k8s resource)",
+			if !(*discovered)[ep.DNSName] {
+				slog.WarnContext(ctx, "Unmanaged DNS record found in NextDNS (no matching k8s resource)",
 					"dns_name", ep.DNSName,
 					"record_type", ep.RecordType,
 					"target", ep.Targets)
@@ -100,87 +288,745 @@ func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 		}
 	}
 
+	// external-dns has now seen the current state, so applies are safe
+	p.warm.Store(true)
+
 	return endpoints, nil
 }
 
+// limitRecords enforces MaxRecordsReturned, either failing or truncating
+// according to RecordsLimitPolicy so an oversized profile is visible
+func (p *Provider) limitRecords(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	limit := p.config.MaxRecordsReturned
+	if limit <= 0 || len(endpoints) <= limit {
+		return endpoints, nil
+	}
+
+	if p.config.RecordsLimitPolicy == RecordsLimitTruncate {
+		slog.Warn("Record count exceeds MAX_RECORDS_RETURNED, truncating response - external-dns will not see the remaining records",
+			"count", len(endpoints),
+			"max_records_returned", limit,
+			"dropped", len(endpoints)-limit)
+		return endpoints[:limit], nil
+	}
+
+	return nil, fmt.Errorf("profile has %d records, exceeds MAX_RECORDS_RETURNED %d; raise the limit or set RECORDS_LIMIT_POLICY=truncate",
+		len(endpoints), limit)
+}
+
 // ApplyChanges applies the given changes to NextDNS
-func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
-	slog.Info("Applying changes to NextDNS",
+func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) (err error) {
+	ctx, span := startSpan(ctx, "nextdns.ApplyChanges",
+		attrProfileID.String(p.config.ProfileID),
+		attribute.Int("nextdns.changes.create", len(changes.Create)),
+		attribute.Int("nextdns.changes.update", len(changes.UpdateOld)),
+		attribute.Int("nextdns.changes.delete", len(changes.Delete)),
+		attribute.Bool("nextdns.dry_run", p.config.DryRun))
+	defer func() { endSpan(span, err) }()
+
+	// Time the sync cycle that started with the preceding Records call
+	syncID, started, timed := p.sync.finish()
+	if timed {
+		defer func() {
+			elapsed := time.Since(started)
+			metrics.SyncDuration.Observe(elapsed.Seconds())
+			p.logger().InfoContext(ctx, "Sync cycle completed", "sync_id", syncID, "duration", elapsed)
+		}()
+	}
+
+	p.logger().InfoContext(ctx, "Applying changes to NextDNS",
 		"create", len(changes.Create),
 		"update", len(changes.UpdateOld),
-		"delete", len(changes.Delete))
+		"delete", len(changes.Delete),
+		"sync_id", syncID)
 
 	if p.config.DryRun {
-		slog.Info("Dry run mode enabled, changes will not be applied")
-		p.logChanges(ctx, changes)
+		p.logger().InfoContext(ctx, "Dry run mode enabled, changes will not be applied")
+		summary := p.logChanges(ctx, changes)
+		metrics.RecordOperations.WithLabelValues(metrics.OperationCreate, metrics.ModeDryRun).Add(float64(len(summary.Create)))
+		metrics.RecordOperations.WithLabelValues(metrics.OperationUpdate, metrics.ModeDryRun).Add(float64(len(summary.Update)))
+		metrics.RecordOperations.WithLabelValues(metrics.OperationDelete, metrics.ModeDryRun).Add(float64(len(summary.Delete)))
+		if p.config.DryRunOutputFile != "" {
+			if err := writeChangeSummary(p.config.DryRunOutputFile, summary); err != nil {
+				return fmt.Errorf("failed to write dry-run output: %w", err)
+			}
+			p.logger().InfoContext(ctx, "Wrote dry-run change summary", "path", p.config.DryRunOutputFile)
+		}
+		return nil
+	}
+
+	// Refuse to write before the current records have been read once
+	if !p.warm.Load() {
+		p.logger().WarnContext(ctx, "Rejecting changes until the first successful Records call")
+		return ErrProviderNotReady
+	}
+
+	// With batching enabled, accept the changes now and apply them together
+	// with anything else that arrives within the window
+	if p.batcher != nil {
+		p.logger().InfoContext(ctx, "Buffering changes for batched apply", "window", p.config.ApplyBatchWindow)
+		p.batcher.add(changes)
+		return nil
+	}
+
+	return p.applyChanges(ctx, changes)
+}
+
+// Flush applies any changes still buffered by the batch window. It is a
+// no-op when batching is disabled.
+func (p *Provider) Flush(ctx context.Context) error {
+	if p.batcher == nil {
+		return nil
+	}
+	return p.batcher.flush(ctx)
+}
+
+// applyChanges writes the changes to NextDNS. A failed change doesn't stop
+// the others: every change is attempted and the failures are returned
+// together, so one bad record can't hold back the rest of a reconcile.
+// Only a full rewrite quota under QuotaExceededFail stops the batch early.
+func (p *Provider) applyChanges(ctx context.Context, changes *plan.Changes) error {
+	changes = p.withoutUpdatedCreates(ctx, changes)
+	changes = p.withoutProtectedDeletes(ctx, changes)
+
+	// Refuse batches that would delete an unexpectedly large share of records
+	if err := p.checkDeleteThreshold(ctx, changes); err != nil {
+		return err
+	}
+
+	// Optionally finish every operation for one record type before starting
+	// the next, e.g. so A records at a name are gone before a CNAME is created
+	var errs []error
+	if len(p.config.ApplyTypeOrder) > 0 {
+		for _, group := range groupChangesByType(changes, p.config.ApplyTypeOrder) {
+			err := p.applyChangeSet(ctx, group)
+			if err == nil {
+				continue
+			}
+			errs = append(errs, err)
+			if errors.Is(err, ErrQuotaExceeded) && p.config.QuotaExceededPolicy != QuotaExceededSkipCreates {
+				break
+			}
+		}
+	} else if err := p.applyChangeSet(ctx, changes); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	p.applyErrors.clear()
+	p.logger().InfoContext(ctx, "Successfully applied changes to NextDNS")
+	return nil
+}
+
+// applyChangeSet processes creates, then updates, then deletes, and returns
+// the failures of all of them joined
+func (p *Provider) applyChangeSet(ctx context.Context, changes *plan.Changes) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	// Process creates. Once the profile's rewrite quota is full every further
+	// create would fail the same way, so the rest are skipped.
+	var (
+		created  atomic.Int64
+		quotaErr atomic.Pointer[error]
+	)
+	_ = forEachEndpoint(ctx, p.client.createLimit, p.config.ApplyConcurrencyCreate, changes.Create, func(ctx context.Context, ep *endpoint.Endpoint) error {
+		if quotaErr.Load() != nil {
+			return nil
+		}
+		ctx, span := startSpan(ctx, "nextdns.createRecord", recordAttributes(p.config.ProfileID, ep)...)
+		err := p.createRecord(ctx, ep)
+		endSpan(span, err)
+		p.recordOutcome(metrics.OperationCreate, ep, err)
+		if errors.Is(err, ErrQuotaExceeded) {
+			quotaErr.CompareAndSwap(nil, &err)
+			return nil
+		}
+		if err != nil {
+			metrics.CreateFailures.WithLabelValues(failureClass(err)).Inc()
+			fail(fmt.Errorf("failed to create record %s in profile %s: %w", ep.DNSName, p.config.ProfileID, err))
+			return nil
+		}
+		created.Add(1)
+		metrics.RecordOperations.WithLabelValues(metrics.OperationCreate, metrics.ModeLive).Inc()
 		return nil
+	})
+
+	if errp := quotaErr.Load(); errp != nil {
+		quotaExceeded := fmt.Errorf("created %d of %d records in profile %s before NextDNS refused further creates: %w",
+			created.Load(), len(changes.Create), p.config.ProfileID, *errp)
+		p.logger().WarnContext(ctx, "Rewrite quota exceeded, skipping remaining creates",
+			"created", created.Load(),
+			"planned", len(changes.Create),
+			"policy", p.config.QuotaExceededPolicy)
+		fail(quotaExceeded)
+		if p.config.QuotaExceededPolicy != QuotaExceededSkipCreates {
+			return errors.Join(errs...)
+		}
 	}
 
-	// Process creates
+	// Process updates. Updates to different names may run concurrently,
+	// but each name's updates are applied one after another, in order.
+	_ = forEachLimit(ctx, p.config.ApplyConcurrency, groupUpdatesByName(changes), func(ctx context.Context, updates []int) error {
+		for _, i := range updates {
+			oldEp := changes.UpdateOld[i]
+			newEp := changes.UpdateNew[i]
+			// Delete+create of an unchanged record is pure churn
+			if p.identicalUpdate(oldEp, newEp) {
+				p.logger().DebugContext(ctx, "Skipping update with identical old and new record",
+					"dns_name", newEp.DNSName,
+					"record_type", newEp.RecordType,
+					"target", newEp.Targets)
+				continue
+			}
+			spanCtx, span := startSpan(ctx, "nextdns.updateRecord", recordAttributes(p.config.ProfileID, newEp)...)
+			err := p.updateRecord(spanCtx, oldEp, newEp)
+			endSpan(span, err)
+			p.recordOutcome(metrics.OperationUpdate, newEp, err)
+			if err != nil {
+				fail(fmt.Errorf("failed to update record %s in profile %s: %w", oldEp.DNSName, p.config.ProfileID, err))
+				continue
+			}
+			metrics.RecordOperations.WithLabelValues(metrics.OperationUpdate, metrics.ModeLive).Inc()
+		}
+		return nil
+	})
+
+	// Process deletes
+	_ = forEachEndpoint(ctx, p.client.deleteLimit, p.config.ApplyConcurrencyDelete, changes.Delete, func(ctx context.Context, ep *endpoint.Endpoint) error {
+		ctx, span := startSpan(ctx, "nextdns.deleteRecord", recordAttributes(p.config.ProfileID, ep)...)
+		err := p.deleteRecord(ctx, ep)
+		endSpan(span, err)
+		p.recordOutcome(metrics.OperationDelete, ep, err)
+		if err != nil {
+			fail(fmt.Errorf("failed to delete record %s in profile %s: %w", ep.DNSName, p.config.ProfileID, err))
+			return nil
+		}
+		metrics.RecordOperations.WithLabelValues(metrics.OperationDelete, metrics.ModeLive).Inc()
+		return nil
+	})
+
+	return errors.Join(errs...)
+}
+
+// withoutUpdatedCreates returns changes without creates whose name and type
+// are also updated in the same plan. external-dns shouldn't plan both, but
+// applying both would write the record twice, so the update wins.
+func (p *Provider) withoutUpdatedCreates(ctx context.Context, changes *plan.Changes) *plan.Changes {
+	if len(changes.Create) == 0 || len(changes.UpdateNew) == 0 {
+		return changes
+	}
+
+	updated := make(map[string]bool, len(changes.UpdateNew))
+	for _, ep := range changes.UpdateNew {
+		updated[indexKey(p.normalizeName(ep.DNSName), ep.RecordType)] = true
+	}
+
+	filtered := *changes
+	filtered.Create = make([]*endpoint.Endpoint, 0, len(changes.Create))
 	for _, ep := range changes.Create {
-		if err := p.createRecord(ctx, ep); err != nil {
-			return fmt.Errorf("failed to create record %s: %w", ep.DNSName, err)
+		if updated[indexKey(p.normalizeName(ep.DNSName), ep.RecordType)] {
+			p.logger().WarnContext(ctx, "Plan both creates and updates a record, applying the update only",
+				"dns_name", ep.DNSName,
+				"record_type", ep.RecordType,
+				"create_target", ep.Targets)
+			continue
+		}
+		filtered.Create = append(filtered.Create, ep)
+	}
+	return &filtered
+}
+
+// withoutProtectedDeletes returns changes with deletes of NoDeleteRecordTypes
+// removed. Each skipped delete is logged as a warning so it isn't missed.
+func (p *Provider) withoutProtectedDeletes(ctx context.Context, changes *plan.Changes) *plan.Changes {
+	if len(p.config.NoDeleteRecordTypes) == 0 || len(changes.Delete) == 0 {
+		return changes
+	}
+
+	filtered := *changes
+	filtered.Delete = make([]*endpoint.Endpoint, 0, len(changes.Delete))
+	for _, ep := range changes.Delete {
+		if slices.ContainsFunc(p.config.NoDeleteRecordTypes, func(recordType string) bool {
+			return strings.EqualFold(recordType, ep.RecordType)
+		}) {
+			p.logger().WarnContext(ctx, "SKIPPING DELETE: record type is protected by NO_DELETE_RECORD_TYPES",
+				"dns_name", ep.DNSName,
+				"record_type", ep.RecordType,
+				"target", ep.Targets)
+			continue
+		}
+		filtered.Delete = append(filtered.Delete, ep)
+	}
+	return &filtered
+}
+
+// recordOutcome adds the outcome of a single record change to the history
+// and, if it failed, to the apply errors
+func (p *Provider) recordOutcome(action string, ep *endpoint.Endpoint, err error) {
+	entry := HistoryEntry{
+		DNSName:    ep.DNSName,
+		RecordType: ep.RecordType,
+		Action:     action,
+		Timestamp:  time.Now().UTC(),
+		Outcome:    OutcomeSuccess,
+	}
+	if err != nil {
+		entry.Outcome = OutcomeError
+		entry.Error = err.Error()
+		p.applyErrors.record(ApplyError{
+			DNSName:    entry.DNSName,
+			RecordType: entry.RecordType,
+			Action:     entry.Action,
+			Timestamp:  entry.Timestamp,
+			Error:      entry.Error,
+		})
+	}
+	p.history.record(entry)
+}
+
+// TestConnection checks that the NextDNS API is reachable with the
+// configured key and profile, using CONNECTION_TEST_MODE
+func (p *Provider) TestConnection(ctx context.Context) error {
+	return p.client.TestConnection(ctx, p.config.ConnectionTestMode)
+}
+
+// Ready reports whether Records has succeeded at least once, so external-dns
+// has synced against the current state of the profile
+func (p *Provider) Ready() bool {
+	return p.warm.Load()
+}
+
+// History returns the most recently applied record changes, oldest first
+func (p *Provider) History() []HistoryEntry {
+	return p.history.list()
+}
+
+// ApplyErrors returns the record changes that failed since the last
+// successful apply
+func (p *Provider) ApplyErrors() []ApplyError {
+	return p.applyErrors.list()
+}
+
+// groupUpdatesByName returns the indexes of changes' updates grouped by DNS
+// name, in the order each name first appears. Names compare
+// case-insensitively.
+func groupUpdatesByName(changes *plan.Changes) [][]int {
+	positions := make(map[string]int)
+	var groups [][]int
+	for i, ep := range changes.UpdateNew {
+		name := strings.ToLower(strings.TrimSuffix(ep.DNSName, "."))
+		pos, ok := positions[name]
+		if !ok {
+			pos = len(groups)
+			positions[name] = pos
+			groups = append(groups, nil)
+		}
+		groups[pos] = append(groups[pos], i)
+	}
+	return groups
+}
+
+// groupChangesByType splits changes into one change set per record type,
+// ordered by typeOrder. Types not listed follow in the order they first
+// appear. Updates are grouped by the type of the record being replaced.
+func groupChangesByType(changes *plan.Changes, typeOrder []string) []*plan.Changes {
+	groups := make(map[string]*plan.Changes)
+	var order []string
+	for _, recordType := range typeOrder {
+		recordType = strings.ToUpper(recordType)
+		if _, ok := groups[recordType]; !ok {
+			groups[recordType] = &plan.Changes{}
+			order = append(order, recordType)
+		}
+	}
+
+	group := func(recordType string) *plan.Changes {
+		recordType = strings.ToUpper(recordType)
+		if _, ok := groups[recordType]; !ok {
+			groups[recordType] = &plan.Changes{}
+			order = append(order, recordType)
 		}
+		return groups[recordType]
 	}
 
-	// Process updates
+	for _, ep := range changes.Create {
+		g := group(ep.RecordType)
+		g.Create = append(g.Create, ep)
+	}
 	for i := range changes.UpdateOld {
-		oldEp := changes.UpdateOld[i]
-		newEp := changes.UpdateNew[i]
-		if err := p.updateRecord(ctx, oldEp, newEp); err != nil {
-			return fmt.Errorf("failed to update record %s: %w", oldEp.DNSName, err)
+		g := group(changes.UpdateOld[i].RecordType)
+		g.UpdateOld = append(g.UpdateOld, changes.UpdateOld[i])
+		g.UpdateNew = append(g.UpdateNew, changes.UpdateNew[i])
+	}
+	for _, ep := range changes.Delete {
+		g := group(ep.RecordType)
+		g.Delete = append(g.Delete, ep)
+	}
+
+	result := make([]*plan.Changes, 0, len(order))
+	for _, recordType := range order {
+		g := groups[recordType]
+		if len(g.Create)+len(g.UpdateOld)+len(g.Delete) > 0 {
+			result = append(result, g)
 		}
 	}
+	return result
+}
 
-	// Process deletes
+// checkDeleteThreshold returns an error if the batch would delete more than
+// MaxDeleteFraction of the records currently managed by this provider.
+// The check is skipped when MaxDeleteFraction is 0, and only logs a warning
+// when AllowMassDelete is set.
+func (p *Provider) checkDeleteThreshold(ctx context.Context, changes *plan.Changes) error {
+	if p.config.MaxDeleteFraction <= 0 || len(changes.Delete) == 0 {
+		return nil
+	}
+
+	// Each target of a delete endpoint maps to one rewrite. Ownership TXT
+	// records aren't a supported type, so they count on neither side.
+	deletes := 0
 	for _, ep := range changes.Delete {
-		if err := p.deleteRecord(ctx, ep); err != nil {
-			return fmt.Errorf("failed to delete record %s: %w", ep.DNSName, err)
+		if p.isSupportedRecordType(ep.RecordType) {
+			deletes += len(ep.Targets)
 		}
 	}
+	if deletes == 0 {
+		return nil
+	}
 
-	slog.Info("Successfully applied changes to NextDNS")
-	return nil
+	rewrites, err := p.client.IndexedRewrites(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count managed records: %w", err)
+	}
+
+	managed := 0
+	for _, rewrite := range rewrites {
+		if !p.isSupportedRecordType(rewrite.Type) {
+			continue
+		}
+		if _, _, ok := decodeOwnership(rewrite); ok {
+			continue
+		}
+		if !p.matchesDomainFilter(rewrite.Name) {
+			continue
+		}
+		managed++
+	}
+	if managed == 0 {
+		return nil
+	}
+
+	fraction := float64(deletes) / float64(managed)
+	if fraction <= p.config.MaxDeleteFraction {
+		return nil
+	}
+
+	if p.config.AllowMassDelete {
+		p.logger().WarnContext(ctx, "Batch exceeds delete threshold but ALLOW_MASS_DELETE is set, proceeding",
+			"deletes", deletes,
+			"managed", managed,
+			"max_delete_fraction", p.config.MaxDeleteFraction)
+		return nil
+	}
+
+	return fmt.Errorf("refusing to delete %d of %d managed records in profile %s (%.0f%%), exceeds MAX_DELETE_FRACTION %v; set ALLOW_MASS_DELETE=true to override",
+		deletes, managed, p.config.ProfileID, fraction*100, p.config.MaxDeleteFraction)
 }
 
 // AdjustEndpoints modifies endpoints before they are processed
 func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
 	slog.Debug("Adjusting endpoints", "count", len(endpoints))
 
+	// Apex CNAMEs become A/AAAA endpoints before the usual filtering
+	endpoints = p.flattenApexCNAMEs(endpoints)
+
 	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
 
 	// Track all discovered DNS names from k8s resources
 	discovered := make(map[string]bool)
+	requestedTTLs := make(map[string]string)
 
 	for _, ep := range endpoints {
-		// Filter by supported record types
-		if !p.isSupportedRecordType(ep.RecordType) {
+		// Fill in a missing record type before filtering on it
+		if ep.RecordType == "" {
+			ep.RecordType = p.inferRecordType(ep)
+			slog.Debug("Endpoint has no record type, using inferred or default type",
+				"dns_name", ep.DNSName,
+				"targets", ep.Targets,
+				"record_type", ep.RecordType)
+		}
+
+		// Filter by supported record types. Registry TXT records are kept
+		// when TXT_REGISTRY_ENABLED stores them as ownership rewrites.
+		if !p.isSupportedRecordType(ep.RecordType) && !p.isOwnershipRecord(ep) {
 			slog.Warn("Skipping unsupported record type", "record_type", ep.RecordType, "dns_name", ep.DNSName)
+			metrics.EndpointsSkipped.WithLabelValues(metrics.SkipReasonUnsupportedType).Inc()
 			continue
 		}
 
 		// Apply domain filtering if configured
-		if len(p.config.DomainFilter) > 0 && !p.matchesDomainFilter(ep.DNSName) {
+		if !p.matchesDomainFilter(ep.DNSName) {
 			slog.Debug("Skipping endpoint - doesn't match domain filter", "dns_name", ep.DNSName)
+			metrics.EndpointsSkipped.WithLabelValues(metrics.SkipReasonDomainFilter).Inc()
+			continue
+		}
+
+		// Never publish a known-bad target
+		if blocked, ok := p.blockedTarget(ep.Targets); ok {
+			slog.Warn("Skipping endpoint with a blocked target (BLOCKED_TARGETS)",
+				"dns_name", ep.DNSName,
+				"record_type", ep.RecordType,
+				"target", blocked)
+			metrics.EndpointsSkipped.WithLabelValues(metrics.SkipReasonBlockedTarget).Inc()
 			continue
 		}
 
-		discovered[ep.DNSName] = true
+		// Compare CNAME targets in the same form Records reports them
+		if strings.EqualFold(ep.RecordType, endpoint.RecordTypeCNAME) {
+			for i, target := range ep.Targets {
+				ep.Targets[i] = p.canonicalCNAMETarget(ep.RecordType, p.relativeCNAMETarget(ep.RecordType, target))
+			}
+		}
+
+		// Sort targets the same way Records does
+		slices.Sort(ep.Targets)
+
+		// NextDNS serves every rewrite at DefaultTTL. TTL 0 means "provider
+		// default"; an explicit TTL is kept in provider-specific data and the
+		// endpoint reported at DefaultTTL, matching Records, so it doesn't
+		// plan an update on every sync
+		if ep.RecordTTL.IsConfigured() {
+			ttl := strconv.FormatInt(int64(ep.RecordTTL), 10)
+			ep.SetProviderSpecificProperty(requestedTTLProperty, ttl)
+			requestedTTLs[ttlKey(p.normalizeName(ep.DNSName), ep.RecordType)] = ttl
+		}
+		ep.RecordTTL = DefaultTTL
+
+		discovered[p.normalizeName(ep.DNSName)] = true
 		adjusted = append(adjusted, ep)
 	}
 
-	p.discoveredNames = discovered
+	// Records reads both maps from other requests, so they're swapped
+	// rather than written in place
+	p.discoveredNames.Store(&discovered)
+	p.requestedTTLs.Store(&requestedTTLs)
 
 	slog.Debug("Adjusted endpoints", "count", len(adjusted))
 	return adjusted, nil
 }
 
+// inferRecordType derives a record type from an endpoint's targets: A for
+// IPv4 addresses, AAAA for IPv6, CNAME for host names. If the targets are
+// missing or of mixed kinds, DefaultRecordType is returned (possibly empty).
+func (p *Provider) inferRecordType(ep *endpoint.Endpoint) string {
+	inferred := ""
+	for _, target := range ep.Targets {
+		recordType := endpoint.RecordTypeCNAME
+		if ip := net.ParseIP(target); ip != nil {
+			recordType = endpoint.RecordTypeAAAA
+			if ip.To4() != nil {
+				recordType = endpoint.RecordTypeA
+			}
+		}
+		if inferred != "" && inferred != recordType {
+			return p.config.DefaultRecordType
+		}
+		inferred = recordType
+	}
+	if inferred == "" {
+		return p.config.DefaultRecordType
+	}
+	return inferred
+}
+
 // GetDomainFilter returns the domain filter for this provider
 func (p *Provider) GetDomainFilter() endpoint.DomainFilter {
-	if len(p.config.DomainFilter) == 0 {
+	if p.domainRegex != nil {
+		return endpoint.NewRegexDomainFilter(p.domainRegex, nil)
+	}
+	if len(p.config.DomainFilter) == 0 && len(p.config.ExcludeDomainFilter) == 0 {
 		return endpoint.NewDomainFilter([]string{})
 	}
-	return endpoint.NewDomainFilter(p.config.DomainFilter)
+	return endpoint.NewDomainFilterWithExclusions(p.config.DomainFilter, p.config.ExcludeDomainFilter)
+}
+
+// logger returns the default logger with the target profile attached, so
+// every entry in the apply path can be traced to the profile it changed
+func (p *Provider) logger() *slog.Logger {
+	return slog.Default().With("profile_id", p.config.ProfileID)
+}
+
+// requestedTTL returns the explicit TTL the last AdjustEndpoints saw for the
+// record, if any
+func (p *Provider) requestedTTL(dnsName, recordType string) (string, bool) {
+	ttls := p.requestedTTLs.Load()
+	if ttls == nil {
+		return "", false
+	}
+	ttl, ok := (*ttls)[ttlKey(dnsName, recordType)]
+	return ttl, ok
+}
+
+// ttlKey identifies a record in Provider.requestedTTLs
+func ttlKey(dnsName, recordType string) string {
+	return dnsName + "/" + recordType
+}
+
+// normalizeName applies the configured NameCase policy to a DNS name
+func (p *Provider) normalizeName(dnsName string) string {
+	if p.config.NameCase == NameCasePreserve {
+		return dnsName
+	}
+	return strings.ToLower(dnsName)
+}
+
+// qualifyCNAMETarget turns a relative (single-label) CNAME target into an
+// FQDN under CNAMETargetQualify. Other targets and record types are returned
+// unchanged.
+func (p *Provider) qualifyCNAMETarget(recordType, target string) string {
+	base := p.config.CNAMETargetQualify
+	if base == "" || !strings.EqualFold(recordType, endpoint.RecordTypeCNAME) {
+		return target
+	}
+	if target == "" || strings.Contains(target, ".") {
+		return target
+	}
+	return target + "." + base
+}
+
+// verifyCNAMETarget checks that a CNAME target resolves, according to
+// VerifyCNAMETarget. In warn mode an unresolvable target is only logged.
+func (p *Provider) verifyCNAMETarget(ctx context.Context, ep *endpoint.Endpoint, target string) error {
+	mode := p.config.VerifyCNAMETarget
+	if mode == "" || mode == VerifyCNAMETargetOff || !strings.EqualFold(ep.RecordType, endpoint.RecordTypeCNAME) {
+		return nil
+	}
+
+	var resolver hostResolver = net.DefaultResolver
+	if p.resolver != nil {
+		resolver = p.resolver
+	}
+
+	_, err := resolver.LookupHost(ctx, target)
+	if err == nil {
+		return nil
+	}
+	if mode == VerifyCNAMETargetError {
+		return fmt.Errorf("CNAME target %s of %s does not resolve: %w", target, ep.DNSName, err)
+	}
+	p.logger().WarnContext(ctx, "CNAME target does not resolve",
+		"dns_name", ep.DNSName,
+		"target", target,
+		"error", err)
+	return nil
+}
+
+// blockedTarget returns the first of targets listed in BLOCKED_TARGETS. Host
+// names match case-insensitively and regardless of a trailing dot.
+func (p *Provider) blockedTarget(targets []string) (string, bool) {
+	for _, target := range targets {
+		for _, blocked := range p.config.BlockedTargets {
+			if blocked != "" && strings.EqualFold(strings.TrimSuffix(target, "."), strings.TrimSuffix(blocked, ".")) {
+				return target, true
+			}
+		}
+	}
+	return "", false
+}
+
+// relativeCNAMETarget reverses qualifyCNAMETarget: a CNAME target that is a
+// single label under CNAMETargetQualify is returned as that label. Only
+// single labels are stripped so the two stay inverses of each other.
+func (p *Provider) relativeCNAMETarget(recordType, target string) string {
+	base := p.config.CNAMETargetQualify
+	if base == "" || !strings.EqualFold(recordType, endpoint.RecordTypeCNAME) {
+		return target
+	}
+	trimmed := strings.TrimSuffix(target, ".")
+	suffix := "." + base
+	if len(trimmed) <= len(suffix) || !strings.EqualFold(trimmed[len(trimmed)-len(suffix):], suffix) {
+		return target
+	}
+	label := trimmed[:len(trimmed)-len(suffix)]
+	if strings.Contains(label, ".") {
+		return target
+	}
+	return label
+}
+
+// canonicalCNAMETarget returns a CNAME target in CNAMETargetForm, so targets
+// compare equal whether or not NextDNS or external-dns added a trailing
+// dot. Single labels left relative by CNAMETargetQualify stay bare.
+func (p *Provider) canonicalCNAMETarget(recordType, target string) string {
+	if !strings.EqualFold(recordType, endpoint.RecordTypeCNAME) {
+		return target
+	}
+	trimmed := strings.TrimSuffix(target, ".")
+	if trimmed == "" || p.config.CNAMETargetForm != CNAMETargetFormAbsolute {
+		return trimmed
+	}
+	if p.config.CNAMETargetQualify != "" && !strings.Contains(trimmed, ".") {
+		return trimmed
+	}
+	return trimmed + "."
+}
+
+// reservedTestDomains are names reserved for testing and documentation
+// (RFC 2606, RFC 6761)
+var reservedTestDomains = []string{"test", "example", "invalid", "localhost", "example.com", "example.net", "example.org"}
+
+// looksLikeProduction reports whether a dry-run configuration shows signs
+// of production intent: the live NextDNS API, a domain filter with no test
+// domains, and no DRY_RUN_OUTPUT_FILE (which signals a deliberate preview).
+// It errs towards false so the warning stays meaningful.
+func looksLikeProduction(config *Config) bool {
+	if config.DryRunOutputFile != "" || len(config.DomainFilter) == 0 {
+		return false
+	}
+	if config.BaseURL != "" {
+		normalized, err := normalizeBaseURL(config.BaseURL)
+		if err != nil || normalized != defaultBaseURL {
+			return false
+		}
+	}
+
+	for _, domain := range config.DomainFilter {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		for _, reserved := range reservedTestDomains {
+			if domain == reserved || strings.HasSuffix(domain, "."+reserved) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkRecordTypes returns an error naming any configured record types
+// that have no rewrite encoding
+func checkRecordTypes(recordTypes []string) error {
+	var unimplemented []string
+	for _, recordType := range recordTypes {
+		if !slices.ContainsFunc(implementedRecordTypes, func(implemented string) bool {
+			return strings.EqualFold(recordType, implemented)
+		}) {
+			unimplemented = append(unimplemented, recordType)
+		}
+	}
+	if len(unimplemented) > 0 {
+		return fmt.Errorf("record types %s are not supported by NextDNS rewrites (implemented: %s); remove them from SUPPORTED_RECORDS or RECORD_PROFILE",
+			strings.Join(unimplemented, ", "), strings.Join(implementedRecordTypes, ", "))
+	}
+	return nil
 }
 
 // isSupportedRecordType checks if the record type is supported
@@ -193,25 +1039,60 @@ func (p *Provider) isSupportedRecordType(recordType string) bool {
 	return false
 }
 
-// matchesDomainFilter checks if a DNS name matches the domain filter
+// matchesDomainFilter checks if a DNS name matches the domain filter, or
+// the regular expression when REGEX_DOMAIN_FILTER is set. An empty filter
+// matches every name. A name under an excluded domain never matches, even
+// when it is also under an included one.
 func (p *Provider) matchesDomainFilter(dnsName string) bool {
-	for _, domain := range p.config.DomainFilter {
-		if strings.HasSuffix(dnsName, domain) || dnsName == strings.TrimPrefix(domain, ".") {
-			return true
-		}
+	if p.isExcludedDomain(dnsName) {
+		return false
 	}
-	return false
+	if p.domainRegex != nil {
+		return p.domainRegex.MatchString(strings.TrimSuffix(dnsName, "."))
+	}
+	if len(p.config.DomainFilter) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.config.DomainFilter, func(domain string) bool {
+		return isUnderDomain(dnsName, domain)
+	})
+}
+
+// isExcludedDomain reports whether dnsName is an ExcludeDomainFilter domain
+// or a name below one
+func (p *Provider) isExcludedDomain(dnsName string) bool {
+	return slices.ContainsFunc(p.config.ExcludeDomainFilter, func(domain string) bool {
+		return isUnderDomain(dnsName, domain)
+	})
+}
+
+// isUnderDomain reports whether dnsName is domain itself or a name below
+// it, matching whole labels only: example.com covers www.example.com but
+// not notexample.com. Case and leading or trailing dots are ignored.
+func isUnderDomain(dnsName, domain string) bool {
+	name := strings.ToLower(strings.TrimSuffix(dnsName, "."))
+	domain = strings.ToLower(strings.Trim(domain, "."))
+	return name == domain || strings.HasSuffix(name, "."+domain)
 }
 
-// parseOverwriteAnnotation checks the endpoint's ProviderSpecific annotations
-// for the overwrite permission annotation. Returns true if the annotation
-// is present and set to "true" (case-insensitive), false otherwise.
-// Default behavior when annotation is absent: block overwrite (return false).
+// parseOverwriteAnnotation checks the endpoint's ProviderSpecific properties
+// for overwrite permission. The overwritePropertyKey property wins when it is
+// "true" or "false" (case-insensitive); otherwise the overwrite annotation
+// decides. Default behavior when neither is set: block overwrite (return false).
 func parseOverwriteAnnotation(ep *endpoint.Endpoint) bool {
 	if ep == nil {
 		return false
 	}
 
+	if value, ok := ep.GetProviderSpecificProperty(overwritePropertyKey); ok {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+	}
+
 	for _, prop := range ep.ProviderSpecific {
 		if prop.Name == overwriteAnnotationKey {
 			return strings.EqualFold(prop.Value, "true")
@@ -221,23 +1102,184 @@ func parseOverwriteAnnotation(ep *endpoint.Endpoint) bool {
 	return false
 }
 
+// uniqueTargets returns the targets with duplicates removed, preserving the
+// order in which each value first appears.
+func uniqueTargets(targets []string) []string {
+	seen := make(map[string]bool, len(targets))
+	unique := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		unique = append(unique, target)
+	}
+	return unique
+}
+
+// sameRecord reports whether two endpoints name the same record: the same
+// name after normalization and the same type
+func (p *Provider) sameRecord(a, b *endpoint.Endpoint) bool {
+	return p.normalizeName(a.DNSName) == p.normalizeName(b.DNSName) && strings.EqualFold(a.RecordType, b.RecordType)
+}
+
+// updateTargets applies an update within one record as a diff of its
+// targets: rewrites for removed targets are deleted, rewrites for added
+// targets created, and those for unchanged targets left alone
+func (p *Provider) updateTargets(ctx context.Context, oldEp, newEp *endpoint.Endpoint) error {
+	qualified := func(ep *endpoint.Endpoint) []string {
+		targets := make([]string, 0, len(ep.Targets))
+		for _, target := range uniqueTargets(ep.Targets) {
+			targets = append(targets, p.canonicalCNAMETarget(ep.RecordType, p.qualifyCNAMETarget(ep.RecordType, target)))
+		}
+		return targets
+	}
+	oldTargets, newTargets := qualified(oldEp), qualified(newEp)
+
+	var removed, added []string
+	for _, target := range oldTargets {
+		if !slices.ContainsFunc(newTargets, func(t string) bool { return strings.EqualFold(t, target) }) {
+			removed = append(removed, target)
+		}
+	}
+	for _, target := range newTargets {
+		if !slices.ContainsFunc(oldTargets, func(t string) bool { return strings.EqualFold(t, target) }) {
+			added = append(added, target)
+		}
+	}
+
+	p.logger().DebugContext(ctx, "Updating changed targets only",
+		"dns_name", newEp.DNSName,
+		"record_type", newEp.RecordType,
+		"removed", removed,
+		"added", added)
+
+	if len(removed) > 0 {
+		// A nextdns-id property may belong to a kept target, so look each up
+		if err := p.deleteRecord(ctx, &endpoint.Endpoint{DNSName: oldEp.DNSName, RecordType: oldEp.RecordType, Targets: removed}); err != nil {
+			return fmt.Errorf("failed to delete old record during update: %w", err)
+		}
+	}
+
+	for _, target := range added {
+		content, err := encodeTarget(newEp.RecordType, target)
+		if err == nil {
+			err = p.verifyCNAMETarget(ctx, newEp, content)
+		}
+		if err == nil {
+			var id string
+			id, err = p.client.CreateRewrite(ctx, p.normalizeName(newEp.DNSName), newEp.RecordType, content)
+			if err == nil {
+				err = p.verifyWrite(ctx, id, newEp.DNSName)
+			}
+		}
+		if err != nil {
+			p.logger().WarnContext(ctx, "DNS record is in inconsistent state - old targets deleted but new target not created",
+				"dns_name", newEp.DNSName,
+				"removed", removed,
+				"target", target)
+			return fmt.Errorf("failed to create new record during update: %w", err)
+		}
+	}
+
+	p.logger().InfoContext(ctx, "Successfully updated record",
+		"operation", "update",
+		"dns_name", newEp.DNSName,
+		"record_type", newEp.RecordType,
+		"old_target", oldEp.Targets,
+		"new_target", newEp.Targets)
+
+	return nil
+}
+
+// identicalUpdate reports whether an update would write exactly the rewrites
+// that already exist: same name and type after normalization and the same
+// set of targets. Provider-specific properties and TTLs aren't stored in
+// NextDNS, so differences in them are ignored.
+func (p *Provider) identicalUpdate(oldEp, newEp *endpoint.Endpoint) bool {
+	if !p.sameRecord(oldEp, newEp) {
+		return false
+	}
+
+	normalize := func(ep *endpoint.Endpoint) []string {
+		targets := make([]string, 0, len(ep.Targets))
+		for _, target := range uniqueTargets(ep.Targets) {
+			targets = append(targets, p.canonicalCNAMETarget(ep.RecordType, p.qualifyCNAMETarget(ep.RecordType, target)))
+		}
+		slices.Sort(targets)
+		return slices.Compact(targets)
+	}
+	return slices.Equal(normalize(oldEp), normalize(newEp))
+}
+
 // createRecord creates a new DNS record in NextDNS
 func (p *Provider) createRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	if p.isOwnershipRecord(ep) {
+		return p.createOwnershipRecord(ctx, ep)
+	}
+
 	// Skip unsupported record types (e.g., TXT records used by external-dns registry)
 	if !p.isSupportedRecordType(ep.RecordType) {
-		slog.Debug("Skipping unsupported record type",
+		p.logger().DebugContext(ctx, "Skipping unsupported record type",
 			"name", ep.DNSName,
 			"type", ep.RecordType)
 		return nil
 	}
 
-	slog.Info("Creating record",
+	p.logger().InfoContext(ctx, "Creating record",
 		"name", ep.DNSName,
 		"type", ep.RecordType,
 		"target", ep.Targets)
 
+	// Collapse duplicate targets so each content value maps to a single rewrite
+	targets := uniqueTargets(ep.Targets)
+	if len(targets) != len(ep.Targets) {
+		p.logger().InfoContext(ctx, "Collapsed duplicate targets",
+			"dns_name", ep.DNSName,
+			"record_type", ep.RecordType,
+			"original_count", len(ep.Targets),
+			"unique_count", len(targets))
+	}
+
+	// Malformed targets (an empty string, a host name on an A record) are
+	// never sent to NextDNS; the valid ones are still created
+	var invalid []error
+	contents := make([]string, 0, len(targets))
+	for _, target := range targets {
+		content, err := encodeTarget(ep.RecordType, p.canonicalCNAMETarget(ep.RecordType, p.qualifyCNAMETarget(ep.RecordType, target)))
+		if err != nil {
+			p.logger().WarnContext(ctx, "Skipping invalid target",
+				"dns_name", ep.DNSName,
+				"record_type", ep.RecordType,
+				"target", target,
+				"error", err)
+			invalid = append(invalid, err)
+			continue
+		}
+		contents = append(contents, content)
+	}
+
 	// Handle multiple targets (create one rewrite per target)
-	for _, target := range ep.Targets {
+	for _, target := range contents {
+		if err := p.verifyCNAMETarget(ctx, ep, target); err != nil {
+			return err
+		}
+
+		// A rewrite with this exact target may exist even though Records
+		// didn't report it (a stale listing, a domain filter change).
+		// Creating it again would only add a duplicate.
+		_, identical, err := p.client.FindRewriteByContent(ctx, ep.DNSName, ep.RecordType, target)
+		if err != nil {
+			return fmt.Errorf("failed to check for existing record: %w", err)
+		}
+		if identical {
+			p.logger().InfoContext(ctx, "Record already exists with the same target, skipping create",
+				"dns_name", ep.DNSName,
+				"record_type", ep.RecordType,
+				"target", target)
+			continue
+		}
+
 		// Check if record already exists
 		existing, found, err := p.client.FindRewriteByName(ctx, ep.DNSName, ep.RecordType)
 		if err != nil {
@@ -248,7 +1290,7 @@ func (p *Provider) createRecord(ctx context.Context, ep *endpoint.Endpoint) erro
 			// Record exists - check overwrite policy via annotation
 			if !parseOverwriteAnnotation(ep) {
 				// Emit warning and skip
-				slog.Warn("Record already exists and will NOT be overwritten. To allow overwrite, add annotation: "+overwriteAnnotationKey+": \"true\"",
+				p.logger().WarnContext(ctx, "Record already exists and will NOT be overwritten. To allow overwrite, add annotation: "+overwriteAnnotationKey+": \"true\"",
 					"dns_name", ep.DNSName,
 					"record_type", ep.RecordType,
 					"current_value", existing.Content,
@@ -257,44 +1299,71 @@ func (p *Provider) createRecord(ctx context.Context, ep *endpoint.Endpoint) erro
 			}
 
 			// Overwrite is allowed via annotation - update the record
-			slog.Info("Overwriting existing record (annotation allows overwrite)",
+			p.logger().InfoContext(ctx, "Overwriting existing record (annotation allows overwrite)",
 				"dns_name", ep.DNSName,
 				"record_type", ep.RecordType,
 				"old_value", existing.Content,
 				"new_value", target)
 
-			_, err = p.client.UpdateRewrite(ctx, existing.ID, ep.DNSName, ep.RecordType, target)
+			id, err := p.client.UpdateRewriteAtomic(ctx, existing.ID, p.normalizeName(ep.DNSName), ep.RecordType, target)
 			if err != nil {
 				return fmt.Errorf("failed to update existing record: %w", err)
 			}
+			if err := p.verifyWrite(ctx, id, ep.DNSName); err != nil {
+				return err
+			}
 		} else {
 			// Record doesn't exist - create it
-			_, err = p.client.CreateRewrite(ctx, ep.DNSName, ep.RecordType, target)
+			id, err := p.client.CreateRewrite(ctx, p.normalizeName(ep.DNSName), ep.RecordType, target)
 			if err != nil {
 				return fmt.Errorf("failed to create record: %w", err)
 			}
+			if err := p.verifyWrite(ctx, id, ep.DNSName); err != nil {
+				return err
+			}
 		}
 	}
 
+	if len(invalid) > 0 {
+		return fmt.Errorf("skipped %d invalid target(s) of %s %s: %w", len(invalid), ep.RecordType, ep.DNSName, errors.Join(invalid...))
+	}
+	return nil
+}
+
+// verifyWrite checks that a created rewrite is listed when
+// VERIFY_WRITES_ATTEMPTS is set
+func (p *Provider) verifyWrite(ctx context.Context, id, dnsName string) error {
+	if p.config.VerifyWritesAttempts <= 0 {
+		return nil
+	}
+	if err := p.client.VerifyRewrite(ctx, id, p.normalizeName(dnsName), p.config.VerifyWritesAttempts, p.config.VerifyWritesInterval); err != nil {
+		return fmt.Errorf("failed to verify created record: %w", err)
+	}
 	return nil
 }
 
 // updateRecord updates an existing DNS record in NextDNS
 func (p *Provider) updateRecord(ctx context.Context, oldEp, newEp *endpoint.Endpoint) error {
 	// Skip unsupported record types
-	if !p.isSupportedRecordType(oldEp.RecordType) {
-		slog.Debug("Skipping update for unsupported record type",
+	if !p.isSupportedRecordType(oldEp.RecordType) && !p.isOwnershipRecord(oldEp) {
+		p.logger().DebugContext(ctx, "Skipping update for unsupported record type",
 			"name", oldEp.DNSName,
 			"type", oldEp.RecordType)
 		return nil
 	}
 
-	slog.Info("Updating record",
+	p.logger().InfoContext(ctx, "Updating record",
 		"operation", "update",
 		"dns_name", oldEp.DNSName,
 		"old_target", oldEp.Targets,
 		"new_target", newEp.Targets)
 
+	// Within one record only the changed targets are touched, so targets in
+	// both the old and new endpoint keep resolving throughout the update
+	if p.sameRecord(oldEp, newEp) && !p.isOwnershipRecord(newEp) {
+		return p.updateTargets(ctx, oldEp, newEp)
+	}
+
 	// NextDNS doesn't have a native update API - we use delete + create pattern
 	// First, delete the old record
 	if err := p.deleteRecord(ctx, oldEp); err != nil {
@@ -303,14 +1372,14 @@ func (p *Provider) updateRecord(ctx context.Context, oldEp, newEp *endpoint.Endp
 
 	// Then create the new record
 	if err := p.createRecord(ctx, newEp); err != nil {
-		slog.Warn("DNS record is in inconsistent state - old record deleted but new record not created",
+		p.logger().WarnContext(ctx, "DNS record is in inconsistent state - old record deleted but new record not created",
 			"dns_name", newEp.DNSName,
 			"old_target", oldEp.Targets,
 			"new_target", newEp.Targets)
 		return fmt.Errorf("failed to create new record during update: %w", err)
 	}
 
-	slog.Info("Successfully updated record",
+	p.logger().InfoContext(ctx, "Successfully updated record",
 		"operation", "update",
 		"dns_name", newEp.DNSName,
 		"record_type", newEp.RecordType,
@@ -322,113 +1391,168 @@ func (p *Provider) updateRecord(ctx context.Context, oldEp, newEp *endpoint.Endp
 
 // deleteRecord deletes a DNS record from NextDNS
 func (p *Provider) deleteRecord(ctx context.Context, ep *endpoint.Endpoint) error {
+	if p.isOwnershipRecord(ep) {
+		return p.deleteOwnershipRecord(ctx, ep)
+	}
+
 	// Skip unsupported record types
 	if !p.isSupportedRecordType(ep.RecordType) {
-		slog.Debug("Skipping delete for unsupported record type",
+		p.logger().DebugContext(ctx, "Skipping delete for unsupported record type",
 			"name", ep.DNSName,
 			"type", ep.RecordType)
 		return nil
 	}
 
-	slog.Info("Deleting record",
+	p.logger().InfoContext(ctx, "Deleting record",
 		"name", ep.DNSName,
 		"type", ep.RecordType,
 		"target", ep.Targets)
 
-	// Handle multiple targets (delete each matching rewrite)
+	// A single-target endpoint carrying its rewrite ID can be deleted without
+	// a lookup; deleteRewrite re-resolves the target if the ID is stale
+	if id, ok := ep.GetProviderSpecificProperty(rewriteIDProperty); ok && id != "" && len(ep.Targets) == 1 {
+		if err := p.deleteRewrite(ctx, id, ep.DNSName, ep.RecordType, p.rewriteContent(ep.RecordType, ep.Targets[0])); err != nil {
+			return fmt.Errorf("failed to delete record: %w", err)
+		}
+		return nil
+	}
+
+	// Handle multiple targets (delete the rewrite holding each one)
 	for _, target := range ep.Targets {
-		// Find the record by name and type
-		existing, found, err := p.client.FindRewriteByName(ctx, ep.DNSName, ep.RecordType)
+		content := p.rewriteContent(ep.RecordType, target)
+		existing, found, err := p.client.FindRewriteByContent(ctx, ep.DNSName, ep.RecordType, content)
 		if err != nil {
 			return fmt.Errorf("failed to find record for deletion: %w", err)
 		}
 
 		if !found {
-			// Record doesn't exist - log warning but don't fail (idempotency)
-			slog.Warn("Record not found for deletion, may have already been deleted",
+			// Record doesn't exist - nothing to do (idempotency)
+			p.logger().DebugContext(ctx, "Record not found for deletion, may have already been deleted",
 				"dns_name", ep.DNSName,
 				"record_type", ep.RecordType,
 				"target", target)
+			metrics.DeleteOutcomes.WithLabelValues(metrics.DeleteOutcomeAbsent).Inc()
 			continue
 		}
 
 		// Delete the record
-		err = p.client.DeleteRewrite(ctx, existing.ID)
-		if err != nil {
+		if err := p.deleteRewrite(ctx, existing.ID, ep.DNSName, ep.RecordType, content); err != nil {
 			return fmt.Errorf("failed to delete record: %w", err)
 		}
-
-		slog.Info("Successfully deleted record",
-			"id", existing.ID,
-			"dns_name", ep.DNSName,
-			"record_type", ep.RecordType)
 	}
 
 	return nil
 }
 
-// logChanges logs the changes that would be applied (for dry-run mode)
-func (p *Provider) logChanges(ctx context.Context, changes *plan.Changes) {
-	// Fetch current records for comparison (skip if client is unavailable)
-	var currentRecords []*endpoint.Endpoint
-	if p.client != nil {
-		var err error
-		currentRecords, err = p.Records(ctx)
-		if err != nil {
-			slog.Warn("Failed to fetch current records for dry-run comparison", "error", err)
-			currentRecords = []*endpoint.Endpoint{}
-		}
+// rewriteContent returns the rewrite content a target of recordType is
+// stored as. A target that can't be encoded is returned as is, so it simply
+// matches no rewrite.
+func (p *Provider) rewriteContent(recordType, target string) string {
+	content := p.canonicalCNAMETarget(recordType, p.qualifyCNAMETarget(recordType, target))
+	if encoded, err := encodeTarget(recordType, content); err == nil {
+		content = encoded
 	}
+	return content
+}
 
-	// Build lookup map for current records
-	currentByName := make(map[string]*endpoint.Endpoint)
-	for _, ep := range currentRecords {
-		key := fmt.Sprintf("%s/%s", ep.DNSName, ep.RecordType)
-		currentByName[key] = ep
+// deleteRewrite deletes a rewrite by ID. If NextDNS reports the ID as not
+// found (e.g. the record was recreated out-of-band, leaving our ID stale),
+// the rewrite is re-resolved by name, type and content and the delete
+// retried once. Matching the content keeps the other targets of the same
+// record safe. A rewrite that no longer exists at all is treated as
+// already deleted.
+func (p *Provider) deleteRewrite(ctx context.Context, id, dnsName, recordType, content string) error {
+	err := p.client.DeleteRewrite(ctx, id)
+	if err != nil && isNotFoundError(err) {
+		p.logger().InfoContext(ctx, "Rewrite ID not found, re-resolving by target",
+			"stale_id", id,
+			"dns_name", dnsName,
+			"record_type", recordType,
+			"content", content)
+
+		refreshed, found, findErr := p.client.FindRewriteByContent(ctx, dnsName, recordType, content)
+		if findErr != nil {
+			return fmt.Errorf("failed to re-resolve record after stale ID %s: %w", id, findErr)
+		}
+		if !found {
+			p.logger().InfoContext(ctx, "Record no longer exists, treating delete as complete",
+				"dns_name", dnsName,
+				"record_type", recordType,
+				"content", content)
+			metrics.DeleteOutcomes.WithLabelValues(metrics.DeleteOutcomeAbsent).Inc()
+			return nil
+		}
+
+		id = refreshed.ID
+		err = p.client.DeleteRewrite(ctx, id)
 	}
+	if err != nil {
+		return err
+	}
+	metrics.DeleteOutcomes.WithLabelValues(metrics.DeleteOutcomeDeleted).Inc()
 
-	slog.Info("=== DRY RUN PREVIEW ===")
+	p.logger().InfoContext(ctx, "Successfully deleted record",
+		"id", id,
+		"dns_name", dnsName,
+		"record_type", recordType)
 
-	for _, ep := range changes.Create {
-		key := fmt.Sprintf("%s/%s", ep.DNSName, ep.RecordType)
-		current, exists := currentByName[key]
+	return nil
+}
 
+// PreviewChanges logs and summarizes changes the way DRY_RUN does, without
+// applying them, whether or not DRY_RUN is set
+func (p *Provider) PreviewChanges(ctx context.Context, changes *plan.Changes) ChangeSummary {
+	p.logger().InfoContext(ctx, "Previewing changes, they will not be applied",
+		"create", len(changes.Create),
+		"update", len(changes.UpdateOld),
+		"delete", len(changes.Delete))
+	return p.logChanges(ctx, changes)
+}
+
+// logChanges logs the changes that would be applied (for dry-run mode) and
+// returns the summary it logged
+func (p *Provider) logChanges(ctx context.Context, changes *plan.Changes) ChangeSummary {
+	summary := p.SummarizeChanges(ctx, changes)
+
+	slog.InfoContext(ctx, "=== DRY RUN PREVIEW ===")
+
+	for _, entry := range summary.Create {
 		args := []any{
 			"action", "CREATE",
-			"dns_name", ep.DNSName,
-			"record_type", ep.RecordType,
-			"target", ep.Targets,
+			"dns_name", entry.DNSName,
+			"record_type", entry.RecordType,
+			"target", entry.Targets,
 		}
 
-		if exists {
-			args = append(args, "current_value", current.Targets, "conflict", true)
-			if parseOverwriteAnnotation(ep) {
+		if entry.Conflict {
+			args = append(args, "current_value", entry.Current, "conflict", true)
+			if entry.Overwrite == overwriteAllowed {
 				args = append(args, "overwrite", "allowed (annotation present)")
 			} else {
 				args = append(args, "overwrite", "blocked (annotation not present)")
 			}
 		}
-		slog.Info("Would create record", args...)
+		slog.InfoContext(ctx, "Would create record", args...)
 	}
 
-	for i := range changes.UpdateOld {
-		oldEp := changes.UpdateOld[i]
-		newEp := changes.UpdateNew[i]
-		slog.Info("Would update record",
+	for _, entry := range summary.Update {
+		slog.InfoContext(ctx, "Would update record",
 			"action", "UPDATE",
-			"dns_name", oldEp.DNSName,
-			"record_type", oldEp.RecordType,
-			"current", oldEp.Targets,
-			"planned", newEp.Targets)
+			"dns_name", entry.DNSName,
+			"record_type", entry.RecordType,
+			"current", entry.Current,
+			"planned", entry.Targets)
 	}
 
-	for _, ep := range changes.Delete {
-		slog.Info("Would delete record",
+	for _, entry := range summary.Delete {
+		slog.InfoContext(ctx, "Would delete record",
 			"action", "DELETE",
-			"dns_name", ep.DNSName,
-			"record_type", ep.RecordType,
-			"target", ep.Targets)
+			"dns_name", entry.DNSName,
+			"record_type", entry.RecordType,
+			"target", entry.Targets)
 	}
 
-	slog.Info("=== END DRY RUN PREVIEW ===")
+	slog.InfoContext(ctx, "=== END DRY RUN PREVIEW ===")
+
+	return summary
 }
@@ -1,12 +1,30 @@
 package nextdns
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/amalucelli/nextdns-go/nextdns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 )
 
 func TestNewProvider(t *testing.T) {
@@ -26,6 +44,40 @@ func TestNewProvider(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "supported types are case-insensitive",
+			config: &Config{
+				APIKey:           "test-api-key",
+				ProfileID:        "test-profile",
+				BaseURL:          "https://api.nextdns.io",
+				DryRun:           true,
+				SupportedRecords: []string{"a", "cname"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unimplemented record type",
+			config: &Config{
+				APIKey:           "test-api-key",
+				ProfileID:        "test-profile",
+				BaseURL:          "https://api.nextdns.io",
+				DryRun:           true,
+				SupportedRecords: []string{"A", "AAAA", "CNAME", "TXT", "MX", "SRV"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid regex domain filter",
+			config: &Config{
+				APIKey:            "test-api-key",
+				ProfileID:         "test-profile",
+				BaseURL:           "https://api.nextdns.io",
+				DryRun:            true,
+				SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+				RegexDomainFilter: "(example\\.com",
+			},
+			wantErr: true,
+		},
 		{
 			name:    "nil config",
 			config:  nil,
@@ -66,6 +118,59 @@ func TestNewProvider(t *testing.T) {
 	}
 }
 
+// TestNewProvider_RetryAttempts verifies that RETRY_MAX_ATTEMPTS counts the
+// first attempt, so the client retries one time fewer.
+func TestNewProvider_RetryAttempts(t *testing.T) {
+	tests := []struct {
+		attempts    int
+		wantRetries int
+	}{
+		{attempts: 4, wantRetries: 3},
+		{attempts: 1, wantRetries: 0},
+		{attempts: 0, wantRetries: 0},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			provider, err := NewProvider(&Config{
+				APIKey:           "test-api-key",
+				ProfileID:        "test-profile",
+				DryRun:           true,
+				SupportedRecords: []string{"A", "AAAA", "CNAME"},
+				RetryMaxAttempts: tt.attempts,
+			})
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			if got := provider.client.retryPolicy().maxRetries; got != tt.wantRetries {
+				t.Errorf("retries = %d, want %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
+
+// TestNewProvider_UnimplementedRecordTypes verifies that startup fails with
+// an error naming every configured type that has no rewrite encoding, and
+// leaves the config alone.
+func TestNewProvider_UnimplementedRecordTypes(t *testing.T) {
+	config := &Config{
+		APIKey:           "test-api-key",
+		ProfileID:        "test-profile",
+		DryRun:           true,
+		SupportedRecords: []string{"A", "AAAA", "cname", "TXT", "MX"},
+	}
+
+	_, err := NewProvider(config)
+	if err == nil {
+		t.Fatal("NewProvider() expected error for unimplemented record types")
+	}
+	if !strings.Contains(err.Error(), "TXT, MX") {
+		t.Errorf("error %q should name the unimplemented types", err)
+	}
+	if want := []string{"A", "AAAA", "cname", "TXT", "MX"}; !reflect.DeepEqual(config.SupportedRecords, want) {
+		t.Errorf("SupportedRecords = %v, want %v unchanged", config.SupportedRecords, want)
+	}
+}
+
 func TestIsSupportedRecordType(t *testing.T) {
 	provider := &Provider{
 		config: &Config{
@@ -150,6 +255,30 @@ func TestMatchesDomainFilter(t *testing.T) {
 			dnsName:      "other.com",
 			want:         false,
 		},
+		{
+			name:         "suffix within a label does not match",
+			domainFilter: []string{"example.com"},
+			dnsName:      "fooexample.com",
+			want:         false,
+		},
+		{
+			name:         "suffix within a label of a subdomain does not match",
+			domainFilter: []string{"example.com"},
+			dnsName:      "app.notexample.com",
+			want:         false,
+		},
+		{
+			name:         "exact apex match with leading-dot filter",
+			domainFilter: []string{".example.com"},
+			dnsName:      "example.com",
+			want:         true,
+		},
+		{
+			name:         "subdomain match with leading-dot filter",
+			domainFilter: []string{".example.com"},
+			dnsName:      "app.example.com",
+			want:         true,
+		},
 		{
 			name:         "multiple filters - first match",
 			domainFilter: []string{"example.com", "test.com"},
@@ -169,10 +298,16 @@ func TestMatchesDomainFilter(t *testing.T) {
 			want:         false,
 		},
 		{
-			name:         "empty filter list",
+			name:         "empty filter list matches all",
 			domainFilter: []string{},
 			dnsName:      "example.com",
-			want:         false,
+			want:         true,
+		},
+		{
+			name:         "nil filter list matches all",
+			domainFilter: nil,
+			dnsName:      "other.org",
+			want:         true,
 		},
 	}
 
@@ -192,6 +327,164 @@ func TestMatchesDomainFilter(t *testing.T) {
 	}
 }
 
+func TestMatchesDomainFilter_Exclusions(t *testing.T) {
+	tests := []struct {
+		name          string
+		domainFilter  []string
+		excludeFilter []string
+		dnsName       string
+		want          bool
+	}{
+		{
+			name:          "included name outside the exclusion",
+			domainFilter:  []string{"example.com"},
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "app.example.com",
+			want:          true,
+		},
+		{
+			name:          "excluded domain itself",
+			domainFilter:  []string{"example.com"},
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "internal.example.com",
+			want:          false,
+		},
+		{
+			name:          "exclusion wins over inclusion for subdomains",
+			domainFilter:  []string{"example.com"},
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "db.internal.example.com",
+			want:          false,
+		},
+		{
+			name:          "exclusion wins over an identical inclusion",
+			domainFilter:  []string{"internal.example.com"},
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "app.internal.example.com",
+			want:          false,
+		},
+		{
+			name:          "exclusion matches whole labels only",
+			domainFilter:  []string{"example.com"},
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "notinternal.example.com",
+			want:          true,
+		},
+		{
+			name:          "exclusion is case-insensitive and ignores trailing dots",
+			domainFilter:  []string{"example.com"},
+			excludeFilter: []string{"Internal.Example.com."},
+			dnsName:       "db.internal.example.com.",
+			want:          false,
+		},
+		{
+			name:          "exclusion with an empty inclusion filter",
+			excludeFilter: []string{"internal.example.com"},
+			dnsName:       "db.internal.example.com",
+			want:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:    []string{"A", "AAAA", "CNAME"},
+					DomainFilter:        tt.domainFilter,
+					ExcludeDomainFilter: tt.excludeFilter,
+				},
+			}
+
+			if got := provider.matchesDomainFilter(tt.dnsName); got != tt.want {
+				t.Errorf("matchesDomainFilter() = %v, want %v", got, tt.want)
+			}
+
+			adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+				{DNSName: tt.dnsName, RecordType: "A", Targets: []string{"10.0.0.1"}},
+			})
+			if err != nil {
+				t.Fatalf("AdjustEndpoints() error = %v", err)
+			}
+			if kept := len(adjusted) == 1; kept != tt.want {
+				t.Errorf("AdjustEndpoints() kept endpoint = %v, want %v", kept, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesDomainFilter_Regex(t *testing.T) {
+	provider, err := NewProvider(&Config{
+		APIKey:              "test-api-key",
+		ProfileID:           "test-profile",
+		BaseURL:             "https://api.nextdns.io",
+		DryRun:              true,
+		SupportedRecords:    []string{"A", "AAAA", "CNAME"},
+		RegexDomainFilter:   `^(app|api)\.example\.(com|org)$`,
+		ExcludeDomainFilter: []string{"api.example.org"},
+	})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+
+	tests := []struct {
+		dnsName string
+		want    bool
+	}{
+		{dnsName: "app.example.com", want: true},
+		{dnsName: "api.example.com.", want: true},
+		{dnsName: "web.example.com", want: false},
+		{dnsName: "app.example.net", want: false},
+		{dnsName: "api.example.org", want: false}, // excluded
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dnsName, func(t *testing.T) {
+			if got := provider.matchesDomainFilter(tt.dnsName); got != tt.want {
+				t.Errorf("matchesDomainFilter(%q) = %v, want %v", tt.dnsName, got, tt.want)
+			}
+		})
+	}
+
+	if !provider.GetDomainFilter().IsConfigured() {
+		t.Error("GetDomainFilter() should report the regex filter as configured")
+	}
+}
+
+// TestEmptyDomainFilter_MatchesAll verifies that an empty DOMAIN_FILTER
+// matches every name on both the adjust path and the read path that counts
+// managed records.
+func TestEmptyDomainFilter_MatchesAll(t *testing.T) {
+	rewrites := []*nextdns.Rewrites{
+		{ID: "1", Name: "a.example.com", Type: "A", Content: "10.0.0.1"},
+		{ID: "2", Name: "b.other.org", Type: "A", Content: "10.0.0.2"},
+	}
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+			MaxDeleteFraction: 0.5,
+		},
+		client: newTestClient(&mockRewritesService{rewrites: rewrites}),
+	}
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "a.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "b.other.org", RecordType: "A", Targets: []string{"10.0.0.2"}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if len(adjusted) != 2 {
+		t.Errorf("AdjustEndpoints() kept %d endpoints, want 2", len(adjusted))
+	}
+
+	// Both rewrites count as managed, so deleting both exceeds the threshold
+	changes := &plan.Changes{Delete: adjusted}
+	err = provider.checkDeleteThreshold(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "2 of 2 managed records") {
+		t.Errorf("checkDeleteThreshold() error = %v, want 2 of 2 managed records refused", err)
+	}
+}
+
 func TestAdjustEndpoints(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -210,7 +503,7 @@ func TestAdjustEndpoints(t *testing.T) {
 				{DNSName: "test.example.com", RecordType: "TXT", Targets: []string{"txt-value"}},
 			},
 			want: []*endpoint.Endpoint{
-				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}},
+				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}, RecordTTL: DefaultTTL},
 			},
 		},
 		{
@@ -224,7 +517,7 @@ func TestAdjustEndpoints(t *testing.T) {
 				{DNSName: "test.other.com", RecordType: "A", Targets: []string{"192.168.1.2"}},
 			},
 			want: []*endpoint.Endpoint{
-				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}},
+				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}, RecordTTL: DefaultTTL},
 			},
 		},
 		{
@@ -239,7 +532,7 @@ func TestAdjustEndpoints(t *testing.T) {
 				{DNSName: "test.other.com", RecordType: "A", Targets: []string{"192.168.1.2"}},
 			},
 			want: []*endpoint.Endpoint{
-				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}},
+				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}, RecordTTL: DefaultTTL},
 			},
 		},
 		{
@@ -253,8 +546,8 @@ func TestAdjustEndpoints(t *testing.T) {
 				{DNSName: "test.other.com", RecordType: "A", Targets: []string{"192.168.1.2"}},
 			},
 			want: []*endpoint.Endpoint{
-				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}},
-				{DNSName: "test.other.com", RecordType: "A", Targets: []string{"192.168.1.2"}},
+				{DNSName: "test.example.com", RecordType: "A", Targets: []string{"192.168.1.1"}, RecordTTL: DefaultTTL},
+				{DNSName: "test.other.com", RecordType: "A", Targets: []string{"192.168.1.2"}, RecordTTL: DefaultTTL},
 			},
 		},
 		{
@@ -786,3 +1079,2105 @@ func TestAdjustEndpointsMethod_BackwardCompatibility(t *testing.T) {
 		t.Errorf("AdjustEndpoints() kept wrong endpoint: %s", adjusted[0].DNSName)
 	}
 }
+
+// TestCreateRecord_DuplicateTargets verifies that duplicate targets within a
+// single endpoint result in a single rewrite being created.
+func TestCreateRecord_DuplicateTargets(t *testing.T) {
+	mock := &mockRewritesService{}
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+		},
+		client: newTestClient(mock),
+	}
+
+	ep := &endpoint.Endpoint{
+		DNSName:    "dup.example.com",
+		RecordType: "A",
+		Targets:    []string{"1.1.1.1", "1.1.1.1"},
+	}
+
+	if err := provider.createRecord(context.Background(), ep); err != nil {
+		t.Fatalf("createRecord() error = %v", err)
+	}
+
+	if len(mock.created) != 1 {
+		t.Fatalf("createRecord() created %d rewrites, want 1", len(mock.created))
+	}
+	if mock.created[0].Content != "1.1.1.1" {
+		t.Errorf("createRecord() content = %v, want 1.1.1.1", mock.created[0].Content)
+	}
+}
+
+// TestCreateRecord_AlreadyExists verifies that creating a record that
+// already exists with the same target, e.g. one Records missed, issues no
+// create, even when overwrites are allowed.
+func TestCreateRecord_AlreadyExists(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+	}{
+		{name: "default"},
+		{name: "overwrite allowed", overwrite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.add("web.example.com", "10.0.0.1")
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: fake.client(),
+			}
+
+			ep := &endpoint.Endpoint{DNSName: "WEB.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+			if tt.overwrite {
+				ep.SetProviderSpecificProperty(overwriteAnnotationKey, "true")
+			}
+			if err := provider.createRecord(context.Background(), ep); err != nil {
+				t.Fatalf("createRecord() error = %v", err)
+			}
+
+			if fake.createCalls != 0 || fake.deleteCalls != 0 {
+				t.Errorf("creates = %d, deletes = %d, want none", fake.createCalls, fake.deleteCalls)
+			}
+			if got := len(fake.records()); got != 1 {
+				t.Errorf("records = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestUniqueTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{
+			name:    "no duplicates",
+			targets: []string{"1.1.1.1", "2.2.2.2"},
+			want:    []string{"1.1.1.1", "2.2.2.2"},
+		},
+		{
+			name:    "adjacent duplicates",
+			targets: []string{"1.1.1.1", "1.1.1.1"},
+			want:    []string{"1.1.1.1"},
+		},
+		{
+			name:    "non-adjacent duplicates keep first occurrence order",
+			targets: []string{"2.2.2.2", "1.1.1.1", "2.2.2.2"},
+			want:    []string{"2.2.2.2", "1.1.1.1"},
+		},
+		{
+			name:    "empty",
+			targets: []string{},
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueTargets(tt.targets)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApplyChanges_DeleteThreshold verifies that batches deleting more than
+// MaxDeleteFraction of managed records are refused unless overridden.
+func TestApplyChanges_DeleteThreshold(t *testing.T) {
+	managed := []*nextdns.Rewrites{
+		{ID: "1", Name: "a.example.com", Type: "A", Content: "10.0.0.1"},
+		{ID: "2", Name: "b.example.com", Type: "A", Content: "10.0.0.2"},
+		{ID: "3", Name: "c.example.com", Type: "A", Content: "10.0.0.3"},
+		{ID: "4", Name: "d.example.com", Type: "A", Content: "10.0.0.4"},
+	}
+
+	deleteOf := func(names ...string) *plan.Changes {
+		changes := &plan.Changes{}
+		for _, name := range names {
+			for _, rewrite := range managed {
+				if rewrite.Name == name {
+					changes.Delete = append(changes.Delete, &endpoint.Endpoint{
+						DNSName: name, RecordType: "A", Targets: []string{rewrite.Content},
+					})
+				}
+			}
+		}
+		return changes
+	}
+
+	tests := []struct {
+		name        string
+		allowMass   bool
+		changes     *plan.Changes
+		wantErr     bool
+		wantDeleted int
+	}{
+		{
+			name:        "under threshold",
+			changes:     deleteOf("a.example.com"),
+			wantDeleted: 1,
+		},
+		{
+			name:        "at threshold",
+			changes:     deleteOf("a.example.com", "b.example.com"),
+			wantDeleted: 2,
+		},
+		{
+			name:        "over threshold",
+			changes:     deleteOf("a.example.com", "b.example.com", "c.example.com"),
+			wantErr:     true,
+			wantDeleted: 0,
+		},
+		{
+			name:        "over threshold with override",
+			allowMass:   true,
+			changes:     deleteOf("a.example.com", "b.example.com", "c.example.com"),
+			wantDeleted: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockRewritesService{rewrites: managed}
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+					MaxDeleteFraction: 0.5,
+					AllowMassDelete:   tt.allowMass,
+				},
+				client: newTestClient(mock),
+			}
+			provider.warm.Store(true)
+
+			err := provider.ApplyChanges(context.Background(), tt.changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(mock.deleted) != tt.wantDeleted {
+				t.Errorf("ApplyChanges() issued %d deletes, want %d", len(mock.deleted), tt.wantDeleted)
+			}
+		})
+	}
+}
+
+// captureLogs redirects the default slog logger into a buffer for the
+// duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+// TestRecords_SkipsRewritesWithoutID verifies that rewrites returned without
+// an ID are skipped with a warning instead of being reported as endpoints.
+// TestRecords_DryRunListsRewrites verifies that dry-run mode still reports
+// the profile's real records, so external-dns previews an accurate plan
+// instead of one that recreates everything.
+func TestRecords_DryRunListsRewrites(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, DryRun: true},
+		client: fake.client(),
+	}
+
+	endpoints, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].DNSName != "web.example.com" {
+		t.Errorf("Records() in dry-run = %v, want the existing record", endpoints)
+	}
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if fake.createCalls != 0 {
+		t.Errorf("create calls in dry-run = %d, want 0", fake.createCalls)
+	}
+}
+
+// TestRecords_SkipsMalformedRewrites verifies that a rewrite whose content
+// can't be converted is skipped and counted while the rest are returned.
+func TestRecords_SkipsMalformedRewrites(t *testing.T) {
+	logs := captureLogs(t)
+	skipped := metrics.RecordsSkipped.WithLabelValues(metrics.SkipReasonUndecodable)
+	before := testutil.ToFloat64(skipped)
+
+	mock := &mockRewritesService{
+		rewrites: []*nextdns.Rewrites{
+			{ID: "1", Name: "a.example.com", Type: "A", Content: "10.0.0.1"},
+			{ID: "2", Name: "bad.example.com", Type: "A", Content: "not-an-address"},
+			{ID: "3", Name: "c.example.com", Type: "CNAME", Content: "target.example.com"},
+			{ID: "4", Name: "d.example.com", Type: "AAAA", Content: "fd00::1"},
+		},
+	}
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: newTestClient(mock),
+	}
+
+	endpoints, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+
+	var names []string
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName)
+	}
+	if want := []string{"a.example.com", "c.example.com", "d.example.com"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Records() returned %v, want %v", names, want)
+	}
+	if got := testutil.ToFloat64(skipped) - before; got != 1 {
+		t.Errorf("skipped rewrites counted = %v, want 1", got)
+	}
+	if !strings.Contains(logs.String(), "dns_name=bad.example.com") {
+		t.Errorf("expected warning for malformed rewrite, got logs:\n%s", logs)
+	}
+}
+
+func TestRecords_SkipsRewritesWithoutID(t *testing.T) {
+	logs := captureLogs(t)
+
+	mock := &mockRewritesService{
+		rewrites: []*nextdns.Rewrites{
+			{ID: "1", Name: "good.example.com", Type: "A", Content: "10.0.0.1"},
+			{ID: "", Name: "noid.example.com", Type: "A", Content: "10.0.0.2"},
+		},
+	}
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: newTestClient(mock),
+	}
+
+	endpoints, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+
+	if len(endpoints) != 1 {
+		t.Fatalf("Records() returned %d endpoints, want 1", len(endpoints))
+	}
+	if endpoints[0].DNSName != "good.example.com" {
+		t.Errorf("Records() kept %s, want good.example.com", endpoints[0].DNSName)
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "Skipping rewrite returned without an ID") ||
+		!strings.Contains(output, "dns_name=noid.example.com") {
+		t.Errorf("expected warning for ID-less rewrite, got logs:\n%s", output)
+	}
+}
+
+// TestNameCasePolicy verifies that the NameCase policy is applied to names on
+// create and to names reported by Records.
+func TestNameCasePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		nameCase    string
+		wantCreated string
+		wantRecord  string
+	}{
+		{
+			name:        "lower",
+			nameCase:    NameCaseLower,
+			wantCreated: "app.example.com",
+			wantRecord:  "stored.example.com",
+		},
+		{
+			name:        "preserve",
+			nameCase:    NameCasePreserve,
+			wantCreated: "App.Example.com",
+			wantRecord:  "Stored.Example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockRewritesService{
+				rewrites: []*nextdns.Rewrites{
+					{ID: "1", Name: "Stored.Example.com", Type: "A", Content: "10.0.0.1"},
+				},
+			}
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+					NameCase:         tt.nameCase,
+				},
+				client: newTestClient(mock),
+			}
+
+			ep := &endpoint.Endpoint{DNSName: "App.Example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}
+			if err := provider.createRecord(context.Background(), ep); err != nil {
+				t.Fatalf("createRecord() error = %v", err)
+			}
+			if len(mock.created) != 1 || mock.created[0].Name != tt.wantCreated {
+				t.Errorf("createRecord() stored %v, want name %s", mock.created, tt.wantCreated)
+			}
+
+			endpoints, err := provider.Records(context.Background())
+			if err != nil {
+				t.Fatalf("Records() error = %v", err)
+			}
+			if len(endpoints) != 1 || endpoints[0].DNSName != tt.wantRecord {
+				t.Errorf("Records() = %v, want name %s", endpoints, tt.wantRecord)
+			}
+		})
+	}
+}
+
+// TestDeleteRecord_StaleIDReresolves verifies that a delete whose rewrite ID
+// went stale (record recreated out-of-band) succeeds after re-resolving the
+// record by name.
+func TestDeleteRecord_StaleIDReresolves(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	staleID := fake.add("stale.example.com", "10.0.0.1")
+
+	// Simulate the record being recreated between lookup and delete
+	fake.beforeDelete = func(f *fakeNextDNS, id string) {
+		if id == staleID {
+			f.removeLocked(staleID)
+			f.addLocked("stale.example.com", "10.0.0.1")
+		}
+	}
+
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	ep := &endpoint.Endpoint{DNSName: "stale.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+	if err := provider.deleteRecord(context.Background(), ep); err != nil {
+		t.Fatalf("deleteRecord() error = %v", err)
+	}
+
+	if remaining := fake.records(); len(remaining) != 0 {
+		t.Errorf("deleteRecord() left records %v, want none", remaining)
+	}
+	if fake.deleteCalls != 2 {
+		t.Errorf("deleteRecord() made %d delete calls, want 2 (stale + re-resolved)", fake.deleteCalls)
+	}
+}
+
+// TestDeleteRecord_StaleIDAlreadyGone verifies that a stale ID whose record
+// no longer exists at all is treated as a successful delete.
+// TestDeleteRecord_StaleIDMultiTarget verifies that re-resolving a stale ID
+// deletes the rewrite holding the endpoint's own target, not another target
+// of the same record.
+func TestDeleteRecord_StaleIDMultiTarget(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	keep := fake.add("web.example.com", "10.0.0.1")
+	fake.add("web.example.com", "10.0.0.2")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	ep := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}
+	ep.SetProviderSpecificProperty(rewriteIDProperty, "stale-id")
+	if err := provider.deleteRecord(context.Background(), ep); err != nil {
+		t.Fatalf("deleteRecord() error = %v", err)
+	}
+
+	remaining := fake.records()
+	if len(remaining) != 1 || remaining[0].ID != keep || remaining[0].Content != "10.0.0.1" {
+		t.Errorf("records after delete = %+v, want only %s (10.0.0.1)", remaining, keep)
+	}
+}
+
+func TestDeleteRecord_StaleIDAlreadyGone(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	staleID := fake.add("gone.example.com", "10.0.0.1")
+
+	fake.beforeDelete = func(f *fakeNextDNS, id string) {
+		f.removeLocked(staleID)
+	}
+
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	ep := &endpoint.Endpoint{DNSName: "gone.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+	if err := provider.deleteRecord(context.Background(), ep); err != nil {
+		t.Fatalf("deleteRecord() error = %v", err)
+	}
+}
+
+// TestDeleteRecord_NotFoundVsListError verifies that deleting an absent
+// record is a no-op while a failed lookup is surfaced, for deletes and for
+// the delete half of updates.
+func TestDeleteRecord_NotFoundVsListError(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     bool
+		listStatus int
+		wantErr    bool
+	}{
+		{name: "delete of absent record succeeds", wantErr: false},
+		{name: "delete when list fails", listStatus: http.StatusUnauthorized, wantErr: true},
+		{name: "update of absent record creates", update: true, wantErr: false},
+		{name: "update when list fails", update: true, listStatus: http.StatusUnauthorized, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.listStatus = tt.listStatus
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: fake.client(),
+			}
+
+			oldEp := &endpoint.Endpoint{DNSName: "absent.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+			var err error
+			if tt.update {
+				newEp := &endpoint.Endpoint{DNSName: "absent.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}
+				err = provider.updateRecord(context.Background(), oldEp, newEp)
+			} else {
+				err = provider.deleteRecord(context.Background(), oldEp)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fake.deleteCalls != 0 {
+				t.Errorf("delete calls = %d, want 0 for an absent record", fake.deleteCalls)
+			}
+			if tt.update && !tt.wantErr {
+				if records := fake.records(); len(records) != 1 || records[0].Content != "10.0.0.2" {
+					t.Errorf("records = %+v, want the new record only", records)
+				}
+			}
+		})
+	}
+}
+
+// TestApplyChanges_LogsProfileID verifies that apply-path log entries and
+// errors name the profile the change was sent to.
+func TestApplyChanges_LogsProfileID(t *testing.T) {
+	logs := captureLogs(t)
+
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{
+			ProfileID:        fake.profileID,
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+		},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(line, "Creating record") || strings.Contains(line, "Successfully applied changes") {
+			if !strings.Contains(line, "profile_id="+fake.profileID) {
+				t.Errorf("log entry missing profile_id: %s", line)
+			}
+		}
+	}
+	if !strings.Contains(logs.String(), "Creating record") {
+		t.Fatalf("expected create log entry, got logs:\n%s", logs.String())
+	}
+
+	// Errors carry the profile too
+	provider.config.ProfileID = "other-profile"
+	provider.client = newTestClient(&mockRewritesService{listErr: fmt.Errorf("boom")})
+	err := provider.ApplyChanges(context.Background(), changes)
+	if err == nil || !strings.Contains(err.Error(), "in profile other-profile") {
+		t.Errorf("ApplyChanges() error = %v, want it to name the profile", err)
+	}
+}
+
+func TestRecords_MaxRecordsReturned(t *testing.T) {
+	rewrites := []*nextdns.Rewrites{
+		{ID: "1", Name: "a.example.com", Type: "A", Content: "10.0.0.1"},
+		{ID: "2", Name: "b.example.com", Type: "A", Content: "10.0.0.2"},
+		{ID: "3", Name: "c.example.com", Type: "A", Content: "10.0.0.3"},
+	}
+
+	tests := []struct {
+		name      string
+		limit     int
+		policy    string
+		wantCount int
+		wantErr   bool
+		wantWarn  bool
+	}{
+		{name: "limit disabled", limit: 0, policy: RecordsLimitError, wantCount: 3},
+		{name: "under limit", limit: 5, policy: RecordsLimitError, wantCount: 3},
+		{name: "at limit", limit: 3, policy: RecordsLimitError, wantCount: 3},
+		{name: "over limit with error policy", limit: 2, policy: RecordsLimitError, wantErr: true},
+		{name: "over limit with truncate policy", limit: 2, policy: RecordsLimitTruncate, wantCount: 2, wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:   []string{"A", "AAAA", "CNAME"},
+					MaxRecordsReturned: tt.limit,
+					RecordsLimitPolicy: tt.policy,
+				},
+				client: newTestClient(&mockRewritesService{rewrites: rewrites}),
+			}
+
+			endpoints, err := provider.Records(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Records() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "MAX_RECORDS_RETURNED") {
+					t.Errorf("Records() error = %v, want it to mention MAX_RECORDS_RETURNED", err)
+				}
+				return
+			}
+
+			if len(endpoints) != tt.wantCount {
+				t.Errorf("Records() returned %d endpoints, want %d", len(endpoints), tt.wantCount)
+			}
+			if got := strings.Contains(logs.String(), "truncating response"); got != tt.wantWarn {
+				t.Errorf("truncation warning logged = %v, want %v", got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+// TestApplyChanges_DryRunOutputFile verifies that a dry-run apply writes the
+// change summary as JSON when DryRunOutputFile is set.
+func TestApplyChanges_DryRunOutputFile(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("conflict.example.com", "10.0.0.9")
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	provider := &Provider{
+		config: &Config{
+			ProfileID:        fake.profileID,
+			DryRun:           true,
+			DryRunOutputFile: path,
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+		},
+		client: fake.client(),
+	}
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			{DNSName: "conflict.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		},
+		UpdateOld: []*endpoint.Endpoint{
+			{DNSName: "update.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			{DNSName: "update.example.com", RecordType: "A", Targets: []string{"10.0.0.4"}},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.5"}},
+		},
+	}
+
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("dry-run output not written: %v", err)
+	}
+
+	var got ChangeSummary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("dry-run output is not valid JSON: %v\n%s", err, data)
+	}
+
+	want := ChangeSummary{
+		ProfileID: fake.profileID,
+		Create: []ChangeEntry{
+			{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			{
+				DNSName: "conflict.example.com", RecordType: "A", Targets: []string{"10.0.0.2"},
+				Current: []string{"10.0.0.9"}, Conflict: true, Overwrite: "blocked",
+			},
+		},
+		Update: []ChangeEntry{
+			{DNSName: "update.example.com", RecordType: "A", Targets: []string{"10.0.0.4"}, Current: []string{"10.0.0.3"}},
+		},
+		Delete: []ChangeEntry{
+			{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.5"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dry-run output = %+v, want %+v", got, want)
+	}
+
+	// Nothing was written to NextDNS
+	if fake.createCalls != 0 || fake.deleteCalls != 0 {
+		t.Errorf("dry-run made write calls: create=%d delete=%d", fake.createCalls, fake.deleteCalls)
+	}
+}
+
+// TestAdjustEndpoints_TTL verifies that TTL 0 is given the provider default
+// while an explicit TTL is preserved in provider-specific data.
+func TestAdjustEndpoints_TTL(t *testing.T) {
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+	}
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "default.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}, RecordTTL: 0},
+		{DNSName: "explicit.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}, RecordTTL: 300},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if len(adjusted) != 2 {
+		t.Fatalf("AdjustEndpoints() returned %d endpoints, want 2", len(adjusted))
+	}
+
+	defaulted, explicit := adjusted[0], adjusted[1]
+
+	if defaulted.RecordTTL != DefaultTTL {
+		t.Errorf("TTL 0 endpoint RecordTTL = %d, want DefaultTTL %d", defaulted.RecordTTL, DefaultTTL)
+	}
+	if _, ok := defaulted.GetProviderSpecificProperty(requestedTTLProperty); ok {
+		t.Error("TTL 0 endpoint should not carry a requested TTL property")
+	}
+
+	if explicit.RecordTTL != DefaultTTL {
+		t.Errorf("explicit TTL endpoint RecordTTL = %d, want DefaultTTL %d", explicit.RecordTTL, DefaultTTL)
+	}
+	if ttl, ok := explicit.GetProviderSpecificProperty(requestedTTLProperty); !ok || ttl != "300" {
+		t.Errorf("explicit TTL endpoint %s = %q (present %v), want \"300\"", requestedTTLProperty, ttl, ok)
+	}
+}
+
+// TestTTLHandling_NoPerpetualUpdates verifies that endpoints with default and
+// explicit TTLs plan no changes once their records exist in NextDNS.
+func TestTTLHandling_NoPerpetualUpdates(t *testing.T) {
+	mock := &mockRewritesService{
+		rewrites: []*nextdns.Rewrites{
+			{ID: "1", Name: "default.example.com", Type: "A", Content: "10.0.0.1"},
+			{ID: "2", Name: "explicit.example.com", Type: "A", Content: "10.0.0.2"},
+		},
+	}
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: newTestClient(mock),
+	}
+
+	desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "default.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "explicit.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}, RecordTTL: 60},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+
+	current, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	for _, ep := range current {
+		if ep.RecordTTL != DefaultTTL {
+			t.Errorf("Records() %s RecordTTL = %d, want DefaultTTL %d", ep.DNSName, ep.RecordTTL, DefaultTTL)
+		}
+	}
+
+	changes := (&plan.Plan{
+		Current:        current,
+		Desired:        desired,
+		ManagedRecords: []string{endpoint.RecordTypeA},
+	}).Calculate().Changes
+
+	if len(changes.Create)+len(changes.UpdateNew)+len(changes.Delete) != 0 {
+		t.Errorf("plan has changes for records already in sync: create=%v update=%v delete=%v",
+			changes.Create, changes.UpdateNew, changes.Delete)
+	}
+}
+
+// TestAdjustEndpoints_ConcurrentRecords verifies that AdjustEndpoints can
+// replace the requested TTLs while Records reads them; run with -race.
+func TestAdjustEndpoints_ConcurrentRecords(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for ttl := range 20 {
+			if _, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+				{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}, RecordTTL: endpoint.TTL(60 + ttl)},
+			}); err != nil {
+				t.Errorf("AdjustEndpoints() error = %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if _, err := provider.Records(context.Background()); err != nil {
+				t.Errorf("Records() error = %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	current, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if ttl, _ := current[0].GetProviderSpecificProperty(requestedTTLProperty); ttl != "79" {
+		t.Errorf("Records() requested TTL = %q, want the last adjusted value 79", ttl)
+	}
+}
+
+func TestCreateRecord_InvalidTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoint    *endpoint.Endpoint
+		wantCreated []string
+		wantSkipped []string
+	}{
+		{
+			name:        "hostname and empty string on an A record",
+			endpoint:    &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "lb.example.net", ""}},
+			wantCreated: []string{"10.0.0.1"},
+			wantSkipped: []string{`"lb.example.net"`, `""`},
+		},
+		{
+			name:        "IPv4 address on an AAAA record",
+			endpoint:    &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "AAAA", Targets: []string{"2001:db8::1", "10.0.0.1"}},
+			wantCreated: []string{"2001:db8::1"},
+			wantSkipped: []string{`"10.0.0.1"`},
+		},
+		{
+			name:        "malformed CNAME target",
+			endpoint:    &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "CNAME", Targets: []string{"lb..example.net"}},
+			wantSkipped: []string{`"lb..example.net"`},
+		},
+		{
+			name:        "valid target",
+			endpoint:    &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}},
+			wantCreated: []string{"lb.example.net"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockRewritesService{}
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: newTestClient(mock),
+			}
+
+			err := provider.createRecord(context.Background(), tt.endpoint)
+
+			var created []string
+			for _, rewrite := range mock.created {
+				created = append(created, rewrite.Content)
+			}
+			if !reflect.DeepEqual(created, tt.wantCreated) {
+				t.Errorf("created = %v, want %v", created, tt.wantCreated)
+			}
+			if len(tt.wantSkipped) == 0 {
+				if err != nil {
+					t.Errorf("createRecord() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("createRecord() error = nil, want the skipped targets reported")
+			}
+			for _, skipped := range tt.wantSkipped {
+				if !strings.Contains(err.Error(), skipped) {
+					t.Errorf("createRecord() error = %q, want it to mention %s", err, skipped)
+				}
+			}
+		})
+	}
+}
+
+// TestCNAMETargetForm verifies that CNAME targets stored with and without a
+// trailing dot plan no changes against desired targets in either form, and
+// that new targets are written in the configured form.
+func TestCNAMETargetForm(t *testing.T) {
+	tests := []struct {
+		form string
+		want string
+	}{
+		{form: CNAMETargetFormRelative, want: "lb.example.net"},
+		{form: CNAMETargetFormAbsolute, want: "lb.example.net."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.form, func(t *testing.T) {
+			mock := &mockRewritesService{
+				rewrites: []*nextdns.Rewrites{
+					{ID: "1", Name: "dotted.example.com", Type: "CNAME", Content: "lb.example.net."},
+					{ID: "2", Name: "bare.example.com", Type: "CNAME", Content: "lb.example.net"},
+				},
+			}
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+					CNAMETargetForm:  tt.form,
+				},
+				client: newTestClient(mock),
+			}
+
+			current, err := provider.Records(context.Background())
+			if err != nil {
+				t.Fatalf("Records() error = %v", err)
+			}
+			for _, ep := range current {
+				if !reflect.DeepEqual([]string(ep.Targets), []string{tt.want}) {
+					t.Errorf("Records() %s targets = %v, want [%s]", ep.DNSName, ep.Targets, tt.want)
+				}
+			}
+
+			// Desired targets arrive in the opposite form to what is stored
+			desired, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+				{DNSName: "dotted.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}},
+				{DNSName: "bare.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net."}},
+			})
+			if err != nil {
+				t.Fatalf("AdjustEndpoints() error = %v", err)
+			}
+
+			changes := (&plan.Plan{
+				Current:        current,
+				Desired:        desired,
+				ManagedRecords: []string{endpoint.RecordTypeCNAME},
+			}).Calculate().Changes
+			if len(changes.Create)+len(changes.UpdateNew)+len(changes.Delete) != 0 {
+				t.Errorf("plan has changes for records already in sync: create=%v update=%v delete=%v",
+					changes.Create, changes.UpdateNew, changes.Delete)
+			}
+
+			ep := &endpoint.Endpoint{DNSName: "new.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}}
+			if err := provider.createRecord(context.Background(), ep); err != nil {
+				t.Fatalf("createRecord() error = %v", err)
+			}
+			if len(mock.created) != 1 || mock.created[0].Content != tt.want {
+				t.Errorf("created rewrites = %+v, want content %q", mock.created, tt.want)
+			}
+		})
+	}
+}
+
+func TestCNAMETargetQualify(t *testing.T) {
+	provider := &Provider{config: &Config{CNAMETargetQualify: "example.com"}}
+
+	tests := []struct {
+		name       string
+		recordType string
+		stored     string // form written to NextDNS
+		reported   string // form reported to external-dns
+	}{
+		{name: "relative target", recordType: "CNAME", stored: "web.example.com", reported: "web"},
+		{name: "FQDN outside base", recordType: "CNAME", stored: "lb.other.net", reported: "lb.other.net"},
+		{name: "multi-label under base", recordType: "CNAME", stored: "a.b.example.com", reported: "a.b.example.com"},
+		{name: "A record untouched", recordType: "A", stored: "10.0.0.1", reported: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := provider.qualifyCNAMETarget(tt.recordType, tt.reported); got != tt.stored {
+				t.Errorf("qualifyCNAMETarget(%q) = %q, want %q", tt.reported, got, tt.stored)
+			}
+			if got := provider.relativeCNAMETarget(tt.recordType, tt.stored); got != tt.reported {
+				t.Errorf("relativeCNAMETarget(%q) = %q, want %q", tt.stored, got, tt.reported)
+			}
+		})
+	}
+
+	disabled := &Provider{config: &Config{}}
+	if got := disabled.qualifyCNAMETarget("CNAME", "web"); got != "web" {
+		t.Errorf("qualifyCNAMETarget() without base = %q, want unchanged", got)
+	}
+}
+
+func TestCNAMETargetQualify_CreateAndRead(t *testing.T) {
+	mock := &mockRewritesService{
+		rewrites: []*nextdns.Rewrites{
+			{ID: "1", Name: "alias.example.com", Type: "CNAME", Content: "web.example.com"},
+			{ID: "2", Name: "ext.example.com", Type: "CNAME", Content: "lb.other.net"},
+		},
+	}
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords:   []string{"A", "AAAA", "CNAME"},
+			CNAMETargetQualify: "example.com",
+		},
+		client: newTestClient(mock),
+	}
+
+	// Create qualifies the relative target
+	ep := &endpoint.Endpoint{DNSName: "new.example.com", RecordType: "CNAME", Targets: []string{"api"}}
+	if err := provider.createRecord(context.Background(), ep); err != nil {
+		t.Fatalf("createRecord() error = %v", err)
+	}
+	if len(mock.created) != 1 || mock.created[0].Content != "api.example.com" {
+		t.Fatalf("created = %+v, want content api.example.com", mock.created)
+	}
+
+	// Read strips the base domain back off
+	endpoints, err := provider.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	got := map[string]string{}
+	for _, ep := range endpoints {
+		got[ep.DNSName] = ep.Targets[0]
+	}
+	if got["alias.example.com"] != "web" {
+		t.Errorf("alias.example.com target = %q, want %q", got["alias.example.com"], "web")
+	}
+	if got["ext.example.com"] != "lb.other.net" {
+		t.Errorf("ext.example.com target = %q, want %q", got["ext.example.com"], "lb.other.net")
+	}
+}
+
+// TestApplyChanges_RejectedUntilWarm verifies that live applies are refused
+// until Records has succeeded once, and proceed afterwards.
+func TestApplyChanges_RejectedUntilWarm(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{
+			ProfileID:        fake.profileID,
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+		},
+		client: fake.client(),
+	}
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+
+	err := provider.ApplyChanges(context.Background(), changes)
+	if !errors.Is(err, ErrProviderNotReady) {
+		t.Fatalf("ApplyChanges() before warmup error = %v, want ErrProviderNotReady", err)
+	}
+	if fake.createCalls != 0 {
+		t.Fatalf("ApplyChanges() before warmup made %d create calls, want 0", fake.createCalls)
+	}
+
+	if _, err := provider.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() after warmup error = %v", err)
+	}
+	if fake.createCalls != 1 {
+		t.Errorf("ApplyChanges() after warmup made %d create calls, want 1", fake.createCalls)
+	}
+}
+
+// TestRecords_FailureDoesNotWarm verifies that a failed Records call leaves
+// the provider cold.
+func TestRecords_FailureDoesNotWarm(t *testing.T) {
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: newTestClient(&mockRewritesService{listErr: fmt.Errorf("boom")}),
+	}
+
+	if _, err := provider.Records(context.Background()); err == nil {
+		t.Fatal("Records() error = nil, want failure")
+	}
+	if provider.warm.Load() {
+		t.Error("provider is warm after a failed Records call")
+	}
+}
+
+// TestRecordOperationMetrics_Mode verifies that dry-run applies count under
+// mode="dryrun" and live applies under mode="live".
+func TestRecordOperationMetrics_Mode(t *testing.T) {
+	counter := func(operation, mode string) float64 {
+		return testutil.ToFloat64(metrics.RecordOperations.WithLabelValues(operation, mode))
+	}
+	operations := []string{metrics.OperationCreate, metrics.OperationUpdate, metrics.OperationDelete}
+
+	changes := func() *plan.Changes {
+		return &plan.Changes{
+			Create:    []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+			UpdateOld: []*endpoint.Endpoint{{DNSName: "upd.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+			UpdateNew: []*endpoint.Endpoint{{DNSName: "upd.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}}},
+			Delete:    []*endpoint.Endpoint{{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.4"}}},
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		dryRun bool
+		mode   string
+		other  string
+	}{
+		{name: "dry-run", dryRun: true, mode: metrics.ModeDryRun, other: metrics.ModeLive},
+		{name: "live", dryRun: false, mode: metrics.ModeLive, other: metrics.ModeDryRun},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.add("upd.example.com", "10.0.0.2")
+			fake.add("old.example.com", "10.0.0.4")
+
+			provider := &Provider{
+				config: &Config{
+					ProfileID:        fake.profileID,
+					DryRun:           tt.dryRun,
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+				},
+				client: fake.client(),
+			}
+			provider.warm.Store(true)
+
+			before := map[string][2]float64{}
+			for _, op := range operations {
+				before[op] = [2]float64{counter(op, tt.mode), counter(op, tt.other)}
+			}
+
+			if err := provider.ApplyChanges(context.Background(), changes()); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+
+			for _, op := range operations {
+				if got := counter(op, tt.mode) - before[op][0]; got != 1 {
+					t.Errorf("%s{mode=%q} increased by %v, want 1", op, tt.mode, got)
+				}
+				if got := counter(op, tt.other) - before[op][1]; got != 0 {
+					t.Errorf("%s{mode=%q} increased by %v, want 0", op, tt.other, got)
+				}
+			}
+		})
+	}
+}
+
+// TestCreateFailureMetrics_Class verifies that a create rejected with a 4xx
+// counts as permanent and one that exhausts its retries on 5xx as transient.
+func TestCreateFailureMetrics_Class(t *testing.T) {
+	counter := func(class string) float64 {
+		return testutil.ToFloat64(metrics.CreateFailures.WithLabelValues(class))
+	}
+
+	for _, tt := range []struct {
+		name        string
+		setup       func(f *fakeNextDNS)
+		class       string
+		other       string
+		wantCreates int
+	}{
+		{
+			name:        "4xx is permanent",
+			setup:       func(f *fakeNextDNS) { f.createErrorCode = "invalid" },
+			class:       metrics.FailureClassPermanent,
+			other:       metrics.FailureClassTransient,
+			wantCreates: 1,
+		},
+		{
+			name:        "5xx after retries is transient",
+			setup:       func(f *fakeNextDNS) { f.createStatus = http.StatusServiceUnavailable },
+			class:       metrics.FailureClassTransient,
+			other:       metrics.FailureClassPermanent,
+			wantCreates: 4,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			tt.setup(fake)
+
+			provider := &Provider{
+				config: &Config{
+					ProfileID:        fake.profileID,
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+				},
+				client: fake.client(),
+			}
+			provider.client.retry = &retryPolicy{maxRetries: 3, baseDelay: time.Millisecond}
+			provider.warm.Store(true)
+
+			before, beforeOther := counter(tt.class), counter(tt.other)
+			changes := &plan.Changes{
+				Create: []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+			}
+			if err := provider.ApplyChanges(context.Background(), changes); err == nil {
+				t.Fatal("ApplyChanges() error = nil, want create failure")
+			}
+
+			if fake.createCalls != tt.wantCreates {
+				t.Errorf("create calls = %d, want %d", fake.createCalls, tt.wantCreates)
+			}
+			if got := counter(tt.class) - before; got != 1 {
+				t.Errorf("%s create failures increased by %v, want 1", tt.class, got)
+			}
+			if got := counter(tt.other) - beforeOther; got != 0 {
+				t.Errorf("%s create failures increased by %v, want 0", tt.other, got)
+			}
+		})
+	}
+}
+
+// opLogRewritesService is a RewritesService that records creates and deletes
+// in a single log, so tests can assert ordering across operation types.
+type opLogRewritesService struct {
+	rewrites []*nextdns.Rewrites
+	ops      []string
+}
+
+func (m *opLogRewritesService) List(_ context.Context, _ *nextdns.ListRewritesRequest) ([]*nextdns.Rewrites, error) {
+	return m.rewrites, nil
+}
+
+func (m *opLogRewritesService) Create(_ context.Context, request *nextdns.CreateRewritesRequest) (string, error) {
+	m.ops = append(m.ops, "create "+request.Rewrites.Name)
+	return fmt.Sprintf("created-%d", len(m.ops)), nil
+}
+
+func (m *opLogRewritesService) Delete(_ context.Context, request *nextdns.DeleteRewritesRequest) error {
+	for _, rewrite := range m.rewrites {
+		if rewrite.ID == request.ID {
+			m.ops = append(m.ops, "delete "+rewrite.Name)
+		}
+	}
+	return nil
+}
+
+func TestApplyChanges_TypeOrder(t *testing.T) {
+	existing := []*nextdns.Rewrites{
+		{ID: "a1", Name: "switch.example.com", Type: "A", Content: "10.0.0.1"},
+		{ID: "q1", Name: "v6.example.com", Type: "AAAA", Content: "fd00::1"},
+	}
+	changes := func() *plan.Changes {
+		return &plan.Changes{
+			Create: []*endpoint.Endpoint{
+				{DNSName: "switch-alias.example.com", RecordType: "CNAME", Targets: []string{"web.example.com"}},
+				{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+			},
+			Delete: []*endpoint.Endpoint{
+				{DNSName: "switch.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+				{DNSName: "v6.example.com", RecordType: "AAAA", Targets: []string{"fd00::1"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{
+			name:  "no grouping",
+			order: nil,
+			want: []string{
+				"create switch-alias.example.com", "create new.example.com",
+				"delete switch.example.com", "delete v6.example.com",
+			},
+		},
+		{
+			name:  "A before CNAME, unlisted AAAA last",
+			order: []string{"a", "CNAME"},
+			want: []string{
+				"create new.example.com", "delete switch.example.com",
+				"create switch-alias.example.com",
+				"delete v6.example.com",
+			},
+		},
+		{
+			name:  "AAAA first",
+			order: []string{"AAAA", "CNAME", "A"},
+			want: []string{
+				"delete v6.example.com",
+				"create switch-alias.example.com",
+				"create new.example.com", "delete switch.example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &opLogRewritesService{rewrites: existing}
+			api, _ := nextdns.New(nextdns.WithAPIKey("test-key"))
+			api.Rewrites = mock
+
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords: []string{"A", "AAAA", "CNAME"},
+					ApplyTypeOrder:   tt.order,
+				},
+				client: &Client{api: api, profileID: "test-profile"},
+			}
+			provider.warm.Store(true)
+
+			if err := provider.ApplyChanges(context.Background(), changes()); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			if !reflect.DeepEqual(mock.ops, tt.want) {
+				t.Errorf("operations = %v, want %v", mock.ops, tt.want)
+			}
+		})
+	}
+}
+
+// stubResolver resolves only the hosts it knows about
+type stubResolver struct {
+	hosts   map[string][]string
+	lookups []string
+}
+
+func (r *stubResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.lookups = append(r.lookups, host)
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestVerifyCNAMETarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		target      string
+		wantErr     bool
+		wantCreated bool
+		wantLookup  bool
+	}{
+		{name: "off skips lookup", mode: VerifyCNAMETargetOff, target: "missing.example.com", wantCreated: true},
+		{name: "warn resolvable", mode: VerifyCNAMETargetWarn, target: "web.example.com", wantCreated: true, wantLookup: true},
+		{name: "warn unresolvable still creates", mode: VerifyCNAMETargetWarn, target: "missing.example.com", wantCreated: true, wantLookup: true},
+		{name: "error resolvable", mode: VerifyCNAMETargetError, target: "web.example.com", wantCreated: true, wantLookup: true},
+		{name: "error unresolvable fails", mode: VerifyCNAMETargetError, target: "missing.example.com", wantErr: true, wantLookup: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			resolver := &stubResolver{hosts: map[string][]string{"web.example.com": {"10.0.0.1"}}}
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+					VerifyCNAMETarget: tt.mode,
+				},
+				client:   fake.client(),
+				resolver: resolver,
+			}
+			provider.warm.Store(true)
+
+			changes := &plan.Changes{
+				Create: []*endpoint.Endpoint{
+					{DNSName: "alias.example.com", RecordType: "CNAME", Targets: []string{tt.target}},
+					// A records are never looked up
+					{DNSName: "host.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+				},
+			}
+			err := provider.ApplyChanges(context.Background(), changes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyChanges() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := len(resolver.lookups) > 0; got != tt.wantLookup {
+				t.Errorf("lookups = %v, want lookup %v", resolver.lookups, tt.wantLookup)
+			}
+			if tt.wantLookup && (len(resolver.lookups) != 1 || resolver.lookups[0] != tt.target) {
+				t.Errorf("lookups = %v, want only %s", resolver.lookups, tt.target)
+			}
+
+			created := false
+			for _, r := range fake.records() {
+				if r.Name == "alias.example.com" {
+					created = true
+				}
+			}
+			if created != tt.wantCreated {
+				t.Errorf("CNAME created = %v, want %v", created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestApplyChanges_SkipsIdenticalUpdates(t *testing.T) {
+	tests := []struct {
+		name      string
+		oldEp     *endpoint.Endpoint
+		newEp     *endpoint.Endpoint
+		wantCalls bool
+	}{
+		{
+			name:  "identical",
+			oldEp: &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			newEp: &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+		{
+			name:  "identical after normalization",
+			oldEp: &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2", "10.0.0.1"}},
+			newEp: &endpoint.Endpoint{
+				DNSName: "Web.Example.com", RecordType: "a", Targets: []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"},
+				ProviderSpecific: endpoint.ProviderSpecific{{Name: requestedTTLProperty, Value: "60"}},
+			},
+		},
+		{
+			name:      "different target",
+			oldEp:     &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			newEp:     &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.9"}},
+			wantCalls: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: fake.client(),
+			}
+			provider.warm.Store(true)
+
+			changes := &plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{tt.oldEp},
+				UpdateNew: []*endpoint.Endpoint{tt.newEp},
+			}
+			if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+
+			calls := fake.listCalls + fake.createCalls + fake.deleteCalls
+			if (calls > 0) != tt.wantCalls {
+				t.Errorf("API calls = %d (list=%d create=%d delete=%d), want calls %v",
+					calls, fake.listCalls, fake.createCalls, fake.deleteCalls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCreateRecord_OverwriteProperty(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties endpoint.ProviderSpecific
+		wantTarget string
+	}{
+		{
+			name:       "property true overwrites despite blocked default",
+			properties: endpoint.ProviderSpecific{{Name: overwritePropertyKey, Value: "true"}},
+			wantTarget: "10.0.0.2",
+		},
+		{
+			name: "property false blocks despite annotation",
+			properties: endpoint.ProviderSpecific{
+				{Name: overwriteAnnotationKey, Value: "true"},
+				{Name: overwritePropertyKey, Value: "false"},
+			},
+			wantTarget: "10.0.0.1",
+		},
+		{
+			name: "invalid property falls back to annotation",
+			properties: endpoint.ProviderSpecific{
+				{Name: overwritePropertyKey, Value: "maybe"},
+				{Name: overwriteAnnotationKey, Value: "true"},
+			},
+			wantTarget: "10.0.0.2",
+		},
+		{
+			name:       "neither set blocks",
+			wantTarget: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.add("web.example.com", "10.0.0.1")
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+				client: fake.client(),
+			}
+			provider.warm.Store(true)
+
+			changes := &plan.Changes{
+				Create: []*endpoint.Endpoint{{
+					DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2"},
+					ProviderSpecific: tt.properties,
+				}},
+			}
+			if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+
+			records := fake.records()
+			if len(records) != 1 || records[0].Content != tt.wantTarget {
+				t.Errorf("records = %+v, want a single record with %s", records, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestLooksLikeProduction(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		want   bool
+	}{
+		{
+			name:   "live API with real domains",
+			config: &Config{BaseURL: "https://api.nextdns.io", DomainFilter: []string{"home.lan", "mycompany.io"}},
+			want:   true,
+		},
+		{
+			name:   "default base URL",
+			config: &Config{DomainFilter: []string{"mycompany.io"}},
+			want:   true,
+		},
+		{
+			name:   "no domain filter",
+			config: &Config{BaseURL: "https://api.nextdns.io"},
+		},
+		{
+			name:   "custom base URL",
+			config: &Config{BaseURL: "http://localhost:8080", DomainFilter: []string{"mycompany.io"}},
+		},
+		{
+			name:   "reserved test domain",
+			config: &Config{BaseURL: "https://api.nextdns.io", DomainFilter: []string{"mycompany.io", "staging.example.com"}},
+		},
+		{
+			name:   "test TLD",
+			config: &Config{BaseURL: "https://api.nextdns.io", DomainFilter: []string{"cluster.test"}},
+		},
+		{
+			name:   "deliberate preview with output file",
+			config: &Config{BaseURL: "https://api.nextdns.io", DomainFilter: []string{"mycompany.io"}, DryRunOutputFile: "/tmp/plan.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeProduction(tt.config); got != tt.want {
+				t.Errorf("looksLikeProduction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProvider_DryRunProductionWarning(t *testing.T) {
+	tests := []struct {
+		name         string
+		domainFilter []string
+		wantWarning  bool
+	}{
+		{name: "production-like", domainFilter: []string{"mycompany.io"}, wantWarning: true},
+		{name: "test config", domainFilter: []string{"example.com"}, wantWarning: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			_, err := NewProvider(&Config{
+				APIKey:           "test-api-key",
+				ProfileID:        "test-profile",
+				BaseURL:          "https://api.nextdns.io",
+				DryRun:           true,
+				DomainFilter:     tt.domainFilter,
+				SupportedRecords: []string{"A", "AAAA", "CNAME"},
+			})
+			if err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+
+			if got := strings.Contains(logs.String(), "configuration looks like production"); got != tt.wantWarning {
+				t.Errorf("production warning logged = %v, want %v; logs:\n%s", got, tt.wantWarning, logs)
+			}
+		})
+	}
+}
+
+// TestApplyChanges_RepeatedDeleteIsIdempotent verifies that re-applying a
+// delete for a record that is already gone succeeds, and that the two
+// applies are counted as deleted and already-absent respectively.
+func TestApplyChanges_RepeatedDeleteIsIdempotent(t *testing.T) {
+	counter := func(outcome string) float64 {
+		return testutil.ToFloat64(metrics.DeleteOutcomes.WithLabelValues(outcome))
+	}
+	deletedBefore := counter(metrics.DeleteOutcomeDeleted)
+	absentBefore := counter(metrics.DeleteOutcomeAbsent)
+
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	changes := func() *plan.Changes {
+		return &plan.Changes{
+			Delete: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+		}
+	}
+
+	if err := provider.ApplyChanges(context.Background(), changes()); err != nil {
+		t.Fatalf("first ApplyChanges() error = %v", err)
+	}
+	if remaining := fake.records(); len(remaining) != 0 {
+		t.Fatalf("records after delete = %v, want none", remaining)
+	}
+	if err := provider.ApplyChanges(context.Background(), changes()); err != nil {
+		t.Fatalf("repeated ApplyChanges() error = %v, want nil", err)
+	}
+
+	if fake.deleteCalls != 1 {
+		t.Errorf("delete calls = %d, want 1 (the repeat finds nothing to delete)", fake.deleteCalls)
+	}
+	if got := counter(metrics.DeleteOutcomeDeleted) - deletedBefore; got != 1 {
+		t.Errorf("deleted outcomes = %v, want 1", got)
+	}
+	if got := counter(metrics.DeleteOutcomeAbsent) - absentBefore; got != 1 {
+		t.Errorf("already_absent outcomes = %v, want 1", got)
+	}
+}
+
+// TestTargetOrder_NotTreatedAsChanged verifies that an endpoint whose
+// targets only differ in order is neither adjusted differently nor updated.
+func TestTargetOrder_NotTreatedAsChanged(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	current := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}
+	desired := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}}
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{desired})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+	if !reflect.DeepEqual(adjusted[0].Targets, current.Targets) {
+		t.Errorf("adjusted targets = %v, want sorted %v", adjusted[0].Targets, current.Targets)
+	}
+
+	// Even unsorted, the update path sees the same record
+	reordered := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2", "10.0.0.3", "10.0.0.1"}}
+	changes := &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{current},
+		UpdateNew: []*endpoint.Endpoint{reordered},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if calls := fake.listCalls + fake.createCalls + fake.deleteCalls; calls != 0 {
+		t.Errorf("API calls = %d, want 0 for reordered targets", calls)
+	}
+}
+
+func TestAdjustEndpoints_MissingRecordType(t *testing.T) {
+	tests := []struct {
+		name        string
+		targets     []string
+		defaultType string
+		wantType    string // empty: endpoint dropped
+	}{
+		{name: "IPv4 infers A", targets: []string{"10.0.0.1"}, wantType: "A"},
+		{name: "IPv6 infers AAAA", targets: []string{"fd00::1"}, wantType: "AAAA"},
+		{name: "hostname infers CNAME", targets: []string{"web.example.com"}, wantType: "CNAME"},
+		{name: "inference wins over default", targets: []string{"10.0.0.1"}, defaultType: "CNAME", wantType: "A"},
+		{name: "mixed targets use default", targets: []string{"10.0.0.1", "fd00::1"}, defaultType: "A", wantType: "A"},
+		{name: "no targets use default", targets: nil, defaultType: "CNAME", wantType: "CNAME"},
+		{name: "mixed targets without default are dropped", targets: []string{"10.0.0.1", "web.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &Provider{
+				config: &Config{
+					SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+					DefaultRecordType: tt.defaultType,
+				},
+			}
+
+			adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+				{DNSName: "host.example.com", Targets: tt.targets},
+			})
+			if err != nil {
+				t.Fatalf("AdjustEndpoints() error = %v", err)
+			}
+
+			if tt.wantType == "" {
+				if len(adjusted) != 0 {
+					t.Errorf("AdjustEndpoints() = %v, want the endpoint dropped", adjusted)
+				}
+				return
+			}
+			if len(adjusted) != 1 || adjusted[0].RecordType != tt.wantType {
+				t.Errorf("AdjustEndpoints() = %v, want one %s endpoint", adjusted, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestNewProvider_WriteCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		wantErr  error
+	}{
+		{name: "write-capable key", readOnly: false},
+		{name: "read-only key", readOnly: true, wantErr: ErrProfileUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeNextDNS(t)
+			fake.readOnly = tt.readOnly
+
+			_, err := NewProvider(&Config{
+				APIKey:            "test-key",
+				ProfileID:         fake.profileID,
+				BaseURL:           fake.server.URL,
+				SupportedRecords:  []string{"A", "AAAA", "CNAME"},
+				WriteCheckEnabled: true,
+				WriteCheckName:    "canary.example.com",
+			})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("NewProvider() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewProvider() error = %v, want errors.Is %v", err, tt.wantErr)
+			}
+
+			if fake.createCalls != 1 {
+				t.Errorf("create calls = %d, want 1", fake.createCalls)
+			}
+			if remaining := fake.records(); len(remaining) != 0 {
+				t.Errorf("records after write check = %v, want the canary removed", remaining)
+			}
+		})
+	}
+}
+
+func TestDeleteRecord_Targets(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	fake.add("web.example.com", "10.0.0.2")
+	keep := fake.add("web.example.com", "10.0.0.3")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	ep := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2", "10.0.0.1"}}
+	if err := provider.deleteRecord(context.Background(), ep); err != nil {
+		t.Fatalf("deleteRecord() error = %v", err)
+	}
+
+	remaining := fake.records()
+	if len(remaining) != 1 || remaining[0].ID != keep {
+		t.Errorf("records after delete = %v, want only the 10.0.0.3 rewrite", remaining)
+	}
+}
+
+func TestUpdateRecord_TargetDiff(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	kept := fake.add("web.example.com", "10.0.0.2")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	oldEp := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1", "10.0.0.2"}}
+	newEp := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2", "10.0.0.3"}}
+	if err := provider.updateRecord(context.Background(), oldEp, newEp); err != nil {
+		t.Fatalf("updateRecord() error = %v", err)
+	}
+
+	contents := map[string]string{}
+	for _, record := range fake.records() {
+		contents[record.Content] = record.ID
+	}
+	if len(contents) != 2 || contents["10.0.0.3"] == "" {
+		t.Errorf("records after update = %v, want 10.0.0.2 and 10.0.0.3", contents)
+	}
+	if contents["10.0.0.2"] != kept {
+		t.Errorf("unchanged target was recreated: ID %q, want %q", contents["10.0.0.2"], kept)
+	}
+	if fake.deleteCalls != 1 || fake.createCalls != 1 {
+		t.Errorf("deletes = %d, creates = %d, want 1 each", fake.deleteCalls, fake.createCalls)
+	}
+}
+
+func TestDeleteRecord_IDProperty(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	id := fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	ep := &endpoint.Endpoint{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}
+	ep.SetProviderSpecificProperty(rewriteIDProperty, id)
+	if err := provider.deleteRecord(context.Background(), ep); err != nil {
+		t.Fatalf("deleteRecord() error = %v", err)
+	}
+
+	if remaining := fake.records(); len(remaining) != 0 {
+		t.Errorf("records after delete = %v, want none", remaining)
+	}
+	if fake.listCalls != 0 {
+		t.Errorf("list calls = %d, want 0 when the rewrite ID is known", fake.listCalls)
+	}
+}
+
+func TestAdjustEndpoints_SkippedMetric(t *testing.T) {
+	reasons := []string{metrics.SkipReasonUnsupportedType, metrics.SkipReasonDomainFilter, metrics.SkipReasonBlockedTarget}
+	before := make(map[string]float64)
+	for _, reason := range reasons {
+		before[reason] = testutil.ToFloat64(metrics.EndpointsSkipped.WithLabelValues(reason))
+	}
+
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+			DomainFilter:     []string{"example.com"},
+			BlockedTargets:   []string{"0.0.0.0"},
+		},
+	}
+	_, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "mail.example.com", RecordType: "MX", Targets: []string{"10 mx.example.com"}},
+		{DNSName: "srv.example.com", RecordType: "SRV", Targets: []string{"0 5 443 web.example.com"}},
+		{DNSName: "web.other.org", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		{DNSName: "sinkhole.example.com", RecordType: "A", Targets: []string{"0.0.0.0"}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+
+	want := map[string]float64{
+		metrics.SkipReasonUnsupportedType: 2,
+		metrics.SkipReasonDomainFilter:    1,
+		metrics.SkipReasonBlockedTarget:   1,
+	}
+	for _, reason := range reasons {
+		if got := testutil.ToFloat64(metrics.EndpointsSkipped.WithLabelValues(reason)) - before[reason]; got != want[reason] {
+			t.Errorf("skipped endpoints (%s) = %v, want %v", reason, got, want[reason])
+		}
+	}
+}
+
+func TestAdjustEndpoints_BlockedTargets(t *testing.T) {
+	logs := captureLogs(t)
+
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords: []string{"A", "AAAA", "CNAME"},
+			BlockedTargets:   []string{"0.0.0.0", "old-lb.example.com."},
+		},
+	}
+
+	adjusted, err := provider.AdjustEndpoints([]*endpoint.Endpoint{
+		{DNSName: "clean.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		{DNSName: "sinkhole.example.com", RecordType: "A", Targets: []string{"10.0.0.2", "0.0.0.0"}},
+		{DNSName: "alias.example.com", RecordType: "CNAME", Targets: []string{"OLD-LB.example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("AdjustEndpoints() error = %v", err)
+	}
+
+	if len(adjusted) != 1 || adjusted[0].DNSName != "clean.example.com" {
+		t.Errorf("AdjustEndpoints() = %v, want only clean.example.com", adjusted)
+	}
+	for _, name := range []string{"sinkhole.example.com", "alias.example.com"} {
+		if !strings.Contains(logs.String(), name) {
+			t.Errorf("dropped endpoint %s was not logged; logs:\n%s", name, logs)
+		}
+	}
+}
+
+func TestApplyChanges_NoDeleteRecordTypes(t *testing.T) {
+	logs := captureLogs(t)
+
+	mock := &opLogRewritesService{rewrites: []*nextdns.Rewrites{
+		{ID: "t1", Name: "owner.example.com", Type: "TXT", Content: "heritage=external-dns"},
+		{ID: "a1", Name: "web.example.com", Type: "A", Content: "10.0.0.1"},
+	}}
+	api, _ := nextdns.New(nextdns.WithAPIKey("test-key"))
+	api.Rewrites = mock
+
+	provider := &Provider{
+		config: &Config{
+			// TXT is listed so the skip comes from the protection alone
+			SupportedRecords:    []string{"A", "AAAA", "CNAME", "TXT"},
+			NoDeleteRecordTypes: []string{"txt"},
+		},
+		client: &Client{api: api, profileID: "test-profile"},
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "owner.example.com", RecordType: "TXT", Targets: []string{"heritage=external-dns"}},
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+		},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	if want := []string{"delete web.example.com"}; !reflect.DeepEqual(mock.ops, want) {
+		t.Errorf("operations = %v, want %v", mock.ops, want)
+	}
+	if len(changes.Delete) != 2 {
+		t.Errorf("ApplyChanges() modified the caller's changes: %d deletes left", len(changes.Delete))
+	}
+	if !strings.Contains(logs.String(), "NO_DELETE_RECORD_TYPES") || !strings.Contains(logs.String(), "owner.example.com") {
+		t.Errorf("skipped delete was not logged; logs:\n%s", logs)
+	}
+}
+
+func TestApplyChanges_CreateOverlapsUpdate(t *testing.T) {
+	logs := captureLogs(t)
+
+	mock := &opLogRewritesService{rewrites: []*nextdns.Rewrites{
+		{ID: "a1", Name: "web.example.com", Type: "A", Content: "10.0.0.1"},
+	}}
+	api, _ := nextdns.New(nextdns.WithAPIKey("test-key"))
+	api.Rewrites = mock
+
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: &Client{api: api, profileID: "test-profile"},
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{{DNSName: "WEB.example.com", RecordType: "A", Targets: []string{"10.0.0.9"}}},
+		UpdateOld: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+		UpdateNew: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// Only the update's target swap, not a second create of the record
+	if want := []string{"delete web.example.com", "create web.example.com"}; !reflect.DeepEqual(mock.ops, want) {
+		t.Errorf("operations = %v, want %v", mock.ops, want)
+	}
+	if len(changes.Create) != 1 {
+		t.Errorf("ApplyChanges() modified the caller's changes: %d creates left", len(changes.Create))
+	}
+	if !strings.Contains(logs.String(), "applying the update only") {
+		t.Errorf("overlapping create was not logged; logs:\n%s", logs)
+	}
+}
+
+func TestApplyChanges_VerifiesWrites(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.hideCreatedLists = 1
+	provider := &Provider{
+		config: &Config{
+			SupportedRecords:     []string{"A", "AAAA", "CNAME"},
+			VerifyWritesAttempts: 3,
+			VerifyWritesInterval: time.Millisecond,
+		},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	// One list to look for an existing record, then two verification checks
+	if fake.listCalls != 3 {
+		t.Errorf("list calls = %d, want 3", fake.listCalls)
+	}
+}
+
+func TestApplyChanges_ContinuesAfterFailure(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.rejectDeleteID = fake.add("bad.example.com", "10.0.0.1")
+	fake.add("old.example.com", "10.0.0.2")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}}},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "bad.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}},
+			{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+		},
+	}
+	err := provider.ApplyChanges(context.Background(), changes)
+	if err == nil {
+		t.Fatal("ApplyChanges() error = nil, want the failed delete")
+	}
+	if !strings.Contains(err.Error(), "bad.example.com") {
+		t.Errorf("ApplyChanges() error = %v, want it to name bad.example.com", err)
+	}
+
+	names := make([]string, 0, 2)
+	for _, rewrite := range fake.records() {
+		names = append(names, rewrite.Name)
+	}
+	slices.Sort(names)
+	if want := []string{"bad.example.com", "new.example.com"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("records after apply = %v, want %v", names, want)
+	}
+}
+
+func TestGroupUpdatesByName(t *testing.T) {
+	update := func(name string) *endpoint.Endpoint {
+		return &endpoint.Endpoint{DNSName: name, RecordType: "A", Targets: []string{"10.0.0.1"}}
+	}
+	changes := &plan.Changes{
+		UpdateNew: []*endpoint.Endpoint{
+			update("a.example.com"),
+			update("b.example.com"),
+			update("A.example.com."),
+			update("c.example.com"),
+			update("b.example.com"),
+		},
+	}
+
+	want := [][]int{{0, 2}, {1, 4}, {3}}
+	if got := groupUpdatesByName(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("groupUpdatesByName() = %v, want %v", got, want)
+	}
+}
+
+func TestApplyChanges_ConcurrentUpdates(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"} {
+		fake.add(name, "10.0.0.1")
+	}
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, ApplyConcurrency: 4},
+		client: fake.client(),
+	}
+	provider.warm.Store(true)
+
+	record := func(name, target string) *endpoint.Endpoint {
+		return &endpoint.Endpoint{DNSName: name, RecordType: "A", Targets: []string{target}}
+	}
+	// The two updates of a.example.com only end at 10.0.0.3 if they are
+	// applied in order
+	changes := &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{
+			record("a.example.com", "10.0.0.1"),
+			record("b.example.com", "10.0.0.1"),
+			record("c.example.com", "10.0.0.1"),
+			record("a.example.com", "10.0.0.2"),
+			record("d.example.com", "10.0.0.1"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			record("a.example.com", "10.0.0.2"),
+			record("b.example.com", "10.0.0.2"),
+			record("c.example.com", "10.0.0.2"),
+			record("a.example.com", "10.0.0.3"),
+			record("d.example.com", "10.0.0.2"),
+		},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, rewrite := range fake.records() {
+		got[rewrite.Name] = append(got[rewrite.Name], rewrite.Content)
+	}
+	want := map[string][]string{
+		"a.example.com": {"10.0.0.3"},
+		"b.example.com": {"10.0.0.2"},
+		"c.example.com": {"10.0.0.2"},
+		"d.example.com": {"10.0.0.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records after apply = %v, want %v", got, want)
+	}
+}
+
+// TestPreviewChanges_LiveMode verifies that a preview (POST /dryrun) reports
+// conflicts against the live records without writing, and without the side
+// effects of Records: no sync is started, the readiness gate stays closed,
+// no metrics are counted and unmanaged records aren't logged again.
+func TestPreviewChanges_LiveMode(t *testing.T) {
+	logs := captureLogs(t)
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	fake.add("unmanaged.example.com", "10.0.0.9")
+	provider := &Provider{
+		config: &Config{ProfileID: "test-profile", SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+	provider.discoveredNames.Store(&map[string]bool{"web.example.com": true})
+	counter := func(operation string) float64 {
+		return testutil.ToFloat64(metrics.RecordOperations.WithLabelValues(operation, metrics.ModeDryRun))
+	}
+	createsBefore, deletesBefore := counter(metrics.OperationCreate), counter(metrics.OperationDelete)
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+			{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.3"}},
+		},
+		Delete: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+	}
+	summary := provider.PreviewChanges(context.Background(), changes)
+
+	if fake.createCalls != 0 || fake.deleteCalls != 0 {
+		t.Errorf("creates = %d, deletes = %d, want none", fake.createCalls, fake.deleteCalls)
+	}
+	if len(summary.Create) != 2 || len(summary.Delete) != 1 {
+		t.Fatalf("summary = %+v, want 2 creates and 1 delete", summary)
+	}
+	if conflict := summary.Create[1]; !conflict.Conflict || !reflect.DeepEqual(conflict.Current, []string{"10.0.0.1"}) {
+		t.Errorf("create of existing record = %+v, want a conflict with current [10.0.0.1]", conflict)
+	}
+
+	if _, _, ok := provider.sync.finish(); ok {
+		t.Error("PreviewChanges() started a sync cycle")
+	}
+	if provider.warm.Load() {
+		t.Error("PreviewChanges() opened the readiness gate")
+	}
+	if counter(metrics.OperationCreate) != createsBefore || counter(metrics.OperationDelete) != deletesBefore {
+		t.Error("PreviewChanges() counted dry-run record operations")
+	}
+	if strings.Contains(logs.String(), "Unmanaged DNS record") {
+		t.Errorf("PreviewChanges() logged unmanaged records; logs:\n%s", logs)
+	}
+}
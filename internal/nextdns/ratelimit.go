@@ -0,0 +1,60 @@
+package nextdns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces outbound API requests evenly at a fixed rate, a token
+// bucket holding a single token. Waiting before each request keeps a large
+// apply under NextDNS's rate limit instead of tripping it and backing off
+// after 429s. A nil *rateLimiter doesn't limit.
+type rateLimiter struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+	// next is when the next request may start
+	next time.Time
+}
+
+// newRateLimiter returns a limiter allowing perSecond requests a second,
+// or nil, which doesn't limit, if perSecond isn't positive
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond), now: time.Now}
+}
+
+// wait blocks until the next request may start or ctx is done. Each call
+// reserves its own slot, so concurrent callers are released one interval
+// apart.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
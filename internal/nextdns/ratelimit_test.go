@@ -0,0 +1,92 @@
+package nextdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Reservations(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(10)
+	limiter.now = func() time.Time { return now }
+	// Keep the calls from sleeping: each reservation lands before now
+	limiter.next = now.Add(-time.Hour)
+
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if want := now.Add(100 * time.Millisecond); !limiter.next.Equal(want) {
+		t.Errorf("next slot = %v, want %v (one interval after an idle start)", limiter.next, want)
+	}
+
+	// An idle limiter doesn't bank slots for a later burst
+	now = now.Add(time.Minute)
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	if want := now.Add(100 * time.Millisecond); !limiter.next.Equal(want) {
+		t.Errorf("next slot after idling = %v, want %v", limiter.next, want)
+	}
+}
+
+func TestRateLimiter_SpacesRequests(t *testing.T) {
+	limiter := newRateLimiter(100)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.wait(ctx); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	// The first request goes at once, the other four 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests at 100/s took %v, want at least 40ms", elapsed)
+	}
+}
+
+func TestRateLimiter_ContextCanceled(t *testing.T) {
+	limiter := newRateLimiter(0.001)
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatalf("first wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	if limiter := newRateLimiter(0); limiter != nil {
+		t.Fatalf("newRateLimiter(0) = %+v, want nil", limiter)
+	}
+	var limiter *rateLimiter
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Errorf("nil limiter wait() error = %v", err)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	client := fake.client()
+	client.rate = newRateLimiter(50)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.CreateRewrite(ctx, "a.example.com", "A", "10.0.0.1"); err != nil {
+			t.Fatalf("CreateRewrite() error = %v", err)
+		}
+	}
+	if _, err := client.ListRewrites(ctx); err != nil {
+		t.Fatalf("ListRewrites() error = %v", err)
+	}
+	// Four requests at 50/s: the last starts 60ms after the first
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 API requests at 50/s took %v, want at least 60ms", elapsed)
+	}
+}
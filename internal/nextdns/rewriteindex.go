@@ -0,0 +1,97 @@
+package nextdns
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/amalucelli/nextdns-go/nextdns"
+)
+
+// rewriteIndex maps name and type to the profile's rewrites, so lookups
+// during an apply don't each list and scan every rewrite. It is rebuilt
+// from every full listing (so once per sync, by Records) and kept current
+// by the client's own creates and deletes. The zero value is an invalid
+// index; lookups on it force a listing.
+type rewriteIndex struct {
+	mu     sync.Mutex
+	valid  bool
+	byName map[string][]*nextdns.Rewrites
+}
+
+// indexKey identifies a name and type in the index. Names compare
+// case-insensitively, as DNS names do.
+func indexKey(name, recordType string) string {
+	return strings.ToLower(name) + "/" + recordType
+}
+
+// rebuild replaces the index with the given listing
+func (x *rewriteIndex) rebuild(rewrites []*nextdns.Rewrites) {
+	byName := make(map[string][]*nextdns.Rewrites, len(rewrites))
+	for _, rewrite := range rewrites {
+		key := indexKey(rewrite.Name, rewrite.Type)
+		byName[key] = append(byName[key], rewrite)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.byName = byName
+	x.valid = true
+}
+
+// invalidate forces the next lookup to list the rewrites again
+func (x *rewriteIndex) invalidate() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.valid = false
+	x.byName = nil
+}
+
+// lookup returns the rewrites with the given name and type. ok is false
+// when the index is invalid and must be rebuilt first.
+func (x *rewriteIndex) lookup(name, recordType string) (rewrites []*nextdns.Rewrites, ok bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.valid {
+		return nil, false
+	}
+	return x.byName[indexKey(name, recordType)], true
+}
+
+// all returns every rewrite in the index. ok is false when the index is
+// invalid and must be rebuilt first.
+func (x *rewriteIndex) all() (rewrites []*nextdns.Rewrites, ok bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.valid {
+		return nil, false
+	}
+	for _, named := range x.byName {
+		rewrites = append(rewrites, named...)
+	}
+	return rewrites, true
+}
+
+// add records a rewrite the client created
+func (x *rewriteIndex) add(rewrite *nextdns.Rewrites) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.valid {
+		return
+	}
+	key := indexKey(rewrite.Name, rewrite.Type)
+	x.byName[key] = append(x.byName[key], rewrite)
+}
+
+// remove drops the rewrite with the given ID
+func (x *rewriteIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key, rewrites := range x.byName {
+		for i, rewrite := range rewrites {
+			if rewrite.ID == id {
+				x.byName[key] = append(rewrites[:i:i], rewrites[i+1:]...)
+				return
+			}
+		}
+	}
+}
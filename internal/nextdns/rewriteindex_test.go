@@ -0,0 +1,130 @@
+package nextdns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// TestFindRewriteByName_UsesIndex verifies that lookups after a listing are
+// served from the index, that the client's own writes keep it current, and
+// that invalidation forces a new listing.
+func TestFindRewriteByName_UsesIndex(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	client := fake.client()
+
+	if _, err := client.ListRewrites(ctx); err != nil {
+		t.Fatalf("ListRewrites() error = %v", err)
+	}
+
+	for _, name := range []string{"web.example.com", "WEB.example.com", "missing.example.com"} {
+		if _, _, err := client.FindRewriteByName(ctx, name, "A"); err != nil {
+			t.Fatalf("FindRewriteByName(%s) error = %v", name, err)
+		}
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("list calls = %d, want 1 (lookups served by the index)", fake.listCalls)
+	}
+
+	// The client's own writes are reflected without relisting
+	id, err := client.CreateRewrite(ctx, "api.example.com", "A", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("CreateRewrite() error = %v", err)
+	}
+	if rewrite, found, _ := client.FindRewriteByName(ctx, "api.example.com", "A"); !found || rewrite.ID != id {
+		t.Errorf("created rewrite not found in index: %v, %v", rewrite, found)
+	}
+	if err := client.DeleteRewrite(ctx, id); err != nil {
+		t.Fatalf("DeleteRewrite() error = %v", err)
+	}
+	if _, found, _ := client.FindRewriteByName(ctx, "api.example.com", "A"); found {
+		t.Error("deleted rewrite still found in index")
+	}
+	if fake.listCalls != 1 {
+		t.Errorf("list calls = %d, want 1 after own writes", fake.listCalls)
+	}
+
+	// Changes made elsewhere show up once the index is invalidated
+	fake.add("other.example.com", "10.0.0.3")
+	if _, found, _ := client.FindRewriteByName(ctx, "other.example.com", "A"); found {
+		t.Error("external change visible before invalidation; lookup should use the index")
+	}
+	client.index.invalidate()
+	if _, found, err := client.FindRewriteByName(ctx, "other.example.com", "A"); err != nil || !found {
+		t.Errorf("FindRewriteByName() after invalidation = %v, %v, want found", found, err)
+	}
+	if fake.listCalls != 2 {
+		t.Errorf("list calls = %d, want 2 (rebuilt after invalidation)", fake.listCalls)
+	}
+}
+
+// TestDeleteRewrite_NotFoundInvalidatesIndex verifies that a delete of an
+// ID that no longer exists forces the next lookup to list again.
+func TestDeleteRewrite_NotFoundInvalidatesIndex(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeNextDNS(t)
+	client := fake.client()
+
+	if _, err := client.ListRewrites(ctx); err != nil {
+		t.Fatalf("ListRewrites() error = %v", err)
+	}
+	if err := client.DeleteRewrite(ctx, "gone"); err == nil {
+		t.Fatal("DeleteRewrite() of a missing ID expected error")
+	}
+	if _, _, err := client.FindRewriteByName(ctx, "web.example.com", "A"); err != nil {
+		t.Fatalf("FindRewriteByName() error = %v", err)
+	}
+	if fake.listCalls != 2 {
+		t.Errorf("list calls = %d, want 2 (index rebuilt after a stale ID)", fake.listCalls)
+	}
+}
+
+// TestApplyChanges_ListsOnce verifies that the overwrite checks and lookups
+// of a whole apply share one listing, however many records it touches
+func TestApplyChanges_ListsOnce(t *testing.T) {
+	for _, afterRecords := range []bool{false, true} {
+		t.Run(fmt.Sprintf("after Records %v", afterRecords), func(t *testing.T) {
+			ctx := context.Background()
+			fake := newFakeNextDNS(t)
+			changes := &plan.Changes{}
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("old%d.example.com", i)
+				fake.add(name, fmt.Sprintf("10.0.1.%d", i))
+				if i%2 == 0 {
+					changes.Delete = append(changes.Delete, &endpoint.Endpoint{DNSName: name, RecordType: "A", Targets: []string{fmt.Sprintf("10.0.1.%d", i)}})
+				} else {
+					changes.UpdateOld = append(changes.UpdateOld, &endpoint.Endpoint{DNSName: name, RecordType: "A", Targets: []string{fmt.Sprintf("10.0.1.%d", i)}})
+					changes.UpdateNew = append(changes.UpdateNew, &endpoint.Endpoint{DNSName: name, RecordType: "A", Targets: []string{fmt.Sprintf("10.0.2.%d", i)}})
+				}
+				changes.Create = append(changes.Create, &endpoint.Endpoint{DNSName: fmt.Sprintf("new%d.example.com", i), RecordType: "A", Targets: []string{fmt.Sprintf("10.0.3.%d", i)}})
+			}
+
+			provider := &Provider{
+				config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, MaxDeleteFraction: 1},
+				client: fake.client(),
+			}
+			provider.warm.Store(true)
+			if afterRecords {
+				if _, err := provider.Records(ctx); err != nil {
+					t.Fatalf("Records() error = %v", err)
+				}
+			}
+
+			if err := provider.ApplyChanges(ctx, changes); err != nil {
+				t.Fatalf("ApplyChanges() error = %v", err)
+			}
+			// Records' listing is reused; a cold apply lists once
+			if fake.listCalls != 1 {
+				t.Errorf("list calls = %d, want 1 for 20 creates, 10 updates and 10 deletes", fake.listCalls)
+			}
+			if got := len(fake.records()); got != 30 {
+				t.Errorf("stored records = %d, want 30", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package nextdns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// Values for ChangeEntry.Overwrite
+const (
+	overwriteAllowed = "allowed"
+	overwriteBlocked = "blocked"
+)
+
+// ChangeSummary is a structured description of a set of planned changes,
+// compared against the records currently in NextDNS
+type ChangeSummary struct {
+	ProfileID string        `json:"profile_id"`
+	Create    []ChangeEntry `json:"create"`
+	Update    []ChangeEntry `json:"update"`
+	Delete    []ChangeEntry `json:"delete"`
+}
+
+// ChangeEntry describes a single planned record change
+type ChangeEntry struct {
+	DNSName    string   `json:"dns_name"`
+	RecordType string   `json:"record_type"`
+	Targets    []string `json:"targets"`
+	// Current holds the existing targets for updates and conflicting creates
+	Current []string `json:"current,omitempty"`
+	// Conflict is set when a create targets a record that already exists;
+	// Overwrite then says whether the create would replace it
+	Conflict  bool   `json:"conflict,omitempty"`
+	Overwrite string `json:"overwrite,omitempty"`
+}
+
+// SummarizeChanges describes changes against the current NextDNS records.
+// If the current records can't be fetched, conflicts are not reported.
+// Summarizing has no side effects on the provider: unlike Records it
+// doesn't start a sync, open the readiness gate, or count metrics.
+func (p *Provider) SummarizeChanges(ctx context.Context, changes *plan.Changes) ChangeSummary {
+	// Fetch current records for comparison (skip if client is unavailable)
+	currentByName := map[string][]string{}
+	if p.client != nil {
+		var err error
+		currentByName, err = p.currentTargets(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to fetch current records for dry-run comparison", "error", err)
+		}
+	}
+
+	summary := ChangeSummary{
+		ProfileID: p.config.ProfileID,
+		Create:    []ChangeEntry{},
+		Update:    []ChangeEntry{},
+		Delete:    []ChangeEntry{},
+	}
+
+	for _, ep := range changes.Create {
+		entry := ChangeEntry{
+			DNSName:    ep.DNSName,
+			RecordType: ep.RecordType,
+			Targets:    ep.Targets,
+		}
+
+		if current, exists := currentByName[summaryKey(p.normalizeName(ep.DNSName), ep.RecordType)]; exists {
+			entry.Current = current
+			entry.Conflict = true
+			entry.Overwrite = overwriteBlocked
+			if parseOverwriteAnnotation(ep) {
+				entry.Overwrite = overwriteAllowed
+			}
+		}
+		summary.Create = append(summary.Create, entry)
+	}
+
+	for i := range changes.UpdateOld {
+		summary.Update = append(summary.Update, ChangeEntry{
+			DNSName:    changes.UpdateOld[i].DNSName,
+			RecordType: changes.UpdateOld[i].RecordType,
+			Targets:    changes.UpdateNew[i].Targets,
+			Current:    changes.UpdateOld[i].Targets,
+		})
+	}
+
+	for _, ep := range changes.Delete {
+		summary.Delete = append(summary.Delete, ChangeEntry{
+			DNSName:    ep.DNSName,
+			RecordType: ep.RecordType,
+			Targets:    ep.Targets,
+		})
+	}
+
+	return summary
+}
+
+// currentTargets returns the targets of the profile's records keyed by
+// summaryKey, converted the way Records reports them. The rewrites come
+// from the client's index, so within a sync no extra listing is made.
+func (p *Provider) currentTargets(ctx context.Context) (map[string][]string, error) {
+	rewrites, err := p.client.IndexedRewrites(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string][]string)
+	for _, rewrite := range rewrites {
+		if p.config.TXTRegistryEnabled {
+			if dnsName, target, ok := decodeOwnership(rewrite); ok {
+				key := summaryKey(p.normalizeName(dnsName), endpoint.RecordTypeTXT)
+				targets[key] = append(targets[key], target)
+				continue
+			}
+		}
+
+		target, err := decodeContent(rewrite.Type, rewrite.Content)
+		if err != nil {
+			continue
+		}
+		key := summaryKey(p.normalizeName(rewrite.Name), rewrite.Type)
+		targets[key] = append(targets[key], p.canonicalCNAMETarget(rewrite.Type, p.relativeCNAMETarget(rewrite.Type, target)))
+	}
+	for _, current := range targets {
+		slices.Sort(current)
+	}
+	return targets, nil
+}
+
+// summaryKey identifies a record by name and type in currentTargets
+func summaryKey(dnsName, recordType string) string {
+	return dnsName + "/" + strings.ToUpper(recordType)
+}
+
+// writeChangeSummary writes the summary to path as indented JSON
+func writeChangeSummary(path string, summary ChangeSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode change summary: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write change summary to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package nextdns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// syncTimer correlates a Records call with the ApplyChanges that follows
+// it, so a whole external-dns sync cycle can be timed and logged under one
+// ID. A later Records call replaces a sync that never reached ApplyChanges.
+type syncTimer struct {
+	mu      sync.Mutex
+	id      string
+	started time.Time
+}
+
+// begin starts a new sync and returns its ID
+func (s *syncTimer) begin() string {
+	id := newSyncID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.id = id
+	s.started = time.Now()
+	return id
+}
+
+// finish ends the current sync, returning its ID and start time. ok is false
+// when no sync is in progress, e.g. ApplyChanges without a prior Records.
+func (s *syncTimer) finish() (id string, started time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == "" {
+		return "", time.Time{}, false
+	}
+	id, started = s.id, s.started
+	s.id = ""
+	return id, started, true
+}
+
+// newSyncID returns a short random identifier for log correlation
+func newSyncID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
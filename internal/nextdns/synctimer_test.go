@@ -0,0 +1,105 @@
+package nextdns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
+)
+
+func syncDurationCount(t *testing.T) uint64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := metrics.SyncDuration.Write(m); err != nil {
+		t.Fatalf("failed to read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// TestSyncDuration_FullCycle verifies that a Records call followed by
+// ApplyChanges is observed once in the sync latency histogram and logged
+// under the same sync ID.
+func TestSyncDuration_FullCycle(t *testing.T) {
+	logs := captureLogs(t)
+
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	before := syncDurationCount(t)
+
+	if _, err := provider.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "api.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	if got := syncDurationCount(t) - before; got != 1 {
+		t.Errorf("sync duration observations = %d, want 1", got)
+	}
+
+	// A second ApplyChanges without a new Records call is not a new cycle
+	if err := provider.ApplyChanges(context.Background(), &plan.Changes{}); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if got := syncDurationCount(t) - before; got != 1 {
+		t.Errorf("sync duration observations after unpaired apply = %d, want 1", got)
+	}
+
+	var syncIDs []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if _, rest, ok := strings.Cut(line, "sync_id="); ok {
+			// The unpaired apply logs an empty sync_id
+			if id, _, _ := strings.Cut(rest, " "); id != "" && id != `""` {
+				syncIDs = append(syncIDs, id)
+			}
+		}
+	}
+	if len(syncIDs) < 2 || syncIDs[0] != syncIDs[len(syncIDs)-1] {
+		t.Errorf("Records and ApplyChanges logs should share one sync_id, got %v; logs:\n%s", syncIDs, logs)
+	}
+}
+
+// TestSyncDuration_DryRunCycle verifies that a dry-run apply closes the sync
+// its Records call started and doesn't leave a new one open, so the next
+// cycle is timed from its own Records call.
+func TestSyncDuration_DryRunCycle(t *testing.T) {
+	fake := newFakeNextDNS(t)
+	fake.add("web.example.com", "10.0.0.1")
+	provider := &Provider{
+		config: &Config{SupportedRecords: []string{"A", "AAAA", "CNAME"}, DryRun: true},
+		client: fake.client(),
+	}
+
+	before := syncDurationCount(t)
+
+	if _, err := provider.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "web.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+	}
+	if err := provider.ApplyChanges(context.Background(), changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	if got := syncDurationCount(t) - before; got != 1 {
+		t.Errorf("sync duration observations = %d, want 1", got)
+	}
+	if id, _, ok := provider.sync.finish(); ok {
+		t.Errorf("dry-run apply left sync %s open", id)
+	}
+}
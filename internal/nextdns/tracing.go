@@ -0,0 +1,47 @@
+package nextdns
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// tracerName identifies the spans this package creates
+const tracerName = "github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/nextdns"
+
+// Span attribute keys
+const (
+	attrProfileID  = attribute.Key("nextdns.profile_id")
+	attrRewriteID  = attribute.Key("nextdns.rewrite_id")
+	attrRecordName = attribute.Key("dns.record.name")
+	attrRecordType = attribute.Key("dns.record.type")
+)
+
+// startSpan starts a span from the global tracer provider, which stays a
+// no-op unless main installed an exporter. The provider is looked up on
+// every call so one installed after package init still takes effect.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// recordAttributes describes the record ep changes in profileID
+func recordAttributes(profileID string, ep *endpoint.Endpoint) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attrProfileID.String(profileID),
+		attrRecordName.String(ep.DNSName),
+		attrRecordType.String(ep.RecordType),
+	}
+}
@@ -0,0 +1,116 @@
+package nextdns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// recordSpans installs a tracer provider recording every span for the
+// duration of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx := context.Background()
+	fake := newFakeNextDNS(t)
+	fake.add("old.example.com", "10.0.0.1")
+
+	provider := &Provider{
+		config: &Config{ProfileID: "test-profile", SupportedRecords: []string{"A", "AAAA", "CNAME"}},
+		client: fake.client(),
+	}
+
+	if _, err := provider.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{{DNSName: "new.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}}},
+		Delete: []*endpoint.Endpoint{{DNSName: "old.example.com", RecordType: "A", Targets: []string{"10.0.0.1"}}},
+	}
+	if err := provider.ApplyChanges(ctx, changes); err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	tests := []struct {
+		span   string
+		parent string
+		attrs  []attribute.KeyValue
+	}{
+		{span: "nextdns.Records", attrs: []attribute.KeyValue{attrProfileID.String("test-profile"), attribute.Int("nextdns.records", 1)}},
+		{span: "nextdns.ListRewrites", parent: "nextdns.Records", attrs: []attribute.KeyValue{attrProfileID.String("test-profile")}},
+		{span: "nextdns.ApplyChanges", attrs: []attribute.KeyValue{attrProfileID.String("test-profile"), attribute.Int("nextdns.changes.create", 1)}},
+		{span: "nextdns.createRecord", parent: "nextdns.ApplyChanges", attrs: []attribute.KeyValue{
+			attrRecordName.String("new.example.com"),
+			attrRecordType.String("A"),
+		}},
+		{span: "nextdns.CreateRewrite", parent: "nextdns.createRecord", attrs: []attribute.KeyValue{
+			attrProfileID.String("test-profile"),
+			attrRecordName.String("new.example.com"),
+			attrRecordType.String("A"),
+		}},
+		{span: "nextdns.deleteRecord", parent: "nextdns.ApplyChanges", attrs: []attribute.KeyValue{
+			attrRecordName.String("old.example.com"),
+			attrRecordType.String("A"),
+		}},
+		{span: "nextdns.DeleteRewrite", parent: "nextdns.deleteRecord", attrs: []attribute.KeyValue{attrProfileID.String("test-profile")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.span, func(t *testing.T) {
+			span, ok := spans[tt.span]
+			if !ok {
+				t.Fatalf("no %s span recorded", tt.span)
+			}
+			if tt.parent != "" && span.Parent().SpanID() != spans[tt.parent].SpanContext().SpanID() {
+				t.Errorf("%s is not a child of %s", tt.span, tt.parent)
+			}
+			got := attribute.NewSet(span.Attributes()...)
+			for _, want := range tt.attrs {
+				if value, ok := got.Value(want.Key); !ok || value != want.Value {
+					t.Errorf("attribute %s = %v, want %v", want.Key, value.Emit(), want.Value.Emit())
+				}
+			}
+		})
+	}
+}
+
+func TestTracing_RecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+	mock := &mockRewritesService{listErr: fmt.Errorf("boom")}
+	provider := &Provider{config: &Config{}, client: newTestClient(mock)}
+
+	if _, err := provider.Records(context.Background()); err == nil {
+		t.Fatal("Records() error = nil, want the listing error")
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "nextdns.Records" {
+			continue
+		}
+		if span.Status().Code != codes.Error {
+			t.Errorf("Records span status = %v, want Error", span.Status().Code)
+		}
+		return
+	}
+	t.Error("no nextdns.Records span recorded")
+}
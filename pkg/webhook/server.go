@@ -2,27 +2,78 @@ package webhook
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 	"sigs.k8s.io/external-dns/provider/webhook/api"
 
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/metrics"
 	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/nextdns"
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/requestid"
 )
 
 const (
 	defaultTimeout = 30 * time.Second
 )
 
+// flusher is implemented by providers that buffer changes before applying them
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// historyProvider is implemented by providers that keep a history of
+// applied changes
+type historyProvider interface {
+	History() []nextdns.HistoryEntry
+}
+
+// applyErrorsProvider is implemented by providers that keep the record
+// changes that failed since the last successful apply
+type applyErrorsProvider interface {
+	ApplyErrors() []nextdns.ApplyError
+}
+
+// readinessProvider is implemented by providers that aren't ready to
+// serve until they have completed a first sync
+type readinessProvider interface {
+	Ready() bool
+}
+
+// previewProvider is implemented by providers that can preview changes
+// without applying them
+type previewProvider interface {
+	PreviewChanges(ctx context.Context, changes *plan.Changes) nextdns.ChangeSummary
+}
+
+// capabilitiesProvider is implemented by providers that describe what
+// they support
+type capabilitiesProvider interface {
+	Capabilities() nextdns.Capabilities
+}
+
 // Server represents the webhook HTTP server
 type Server struct {
 	config       *nextdns.Config
 	provider     provider.Provider
 	apiServer    *http.Server
 	healthServer *http.Server
+	started      time.Time
+	now          func() time.Time
+	// listening is set while the API server is accepting connections
+	listening atomic.Bool
 }
 
 // NewServer creates a new webhook server
@@ -37,46 +88,35 @@ func NewServer(config *nextdns.Config, provider provider.Provider) (*Server, err
 	return &Server{
 		config:   config,
 		provider: provider,
+		started:  time.Now(),
+		now:      time.Now,
 	}, nil
 }
 
 // Start starts the webhook server
 func (s *Server) Start(ctx context.Context) error {
-	// Create the webhook API handler using external-dns webhook API
-	webhookServer := &api.WebhookServer{
-		Provider: s.provider,
-	}
-
-	mux := http.NewServeMux()
-
-	// Setup webhook endpoints as per external-dns specification:
-	// GET / - Negotiate/Domain filter
-	// GET /records - Get records
-	// POST /records - Apply changes
-	// POST /adjustendpoints - Adjust endpoints
-	mux.HandleFunc("/", webhookServer.NegotiateHandler)
-	mux.HandleFunc("/records", webhookServer.RecordsHandler)
-	mux.HandleFunc("/adjustendpoints", webhookServer.AdjustEndpointsHandler)
-
 	// Setup API server (webhook endpoints)
-	s.apiServer = &http.Server{
-		Addr:         fmt.Sprintf("127.0.0.1:%d", s.config.ServerPort),
-		Handler:      mux,
-		ReadTimeout:  defaultTimeout,
-		WriteTimeout: defaultTimeout,
-	}
+	s.apiServer = s.newAPIServer()
 
 	// Setup health server
-	healthMux := http.NewServeMux()
-	healthMux.HandleFunc("/healthz", s.handleHealth)
-	healthMux.HandleFunc("/readyz", s.handleReady)
+	s.healthServer = s.newHealthServer()
 
-	s.healthServer = &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0:%d", s.config.HealthPort),
-		Handler:      healthMux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	slog.Info("Serving external-dns webhook API",
+		"media_type", api.MediaTypeFormatAndVersion,
+		"versions", webhookAPIVersions())
+
+	// Bind both ports before serving, the API port first, so a failed bind
+	// is returned before the health server ever answers a probe
+	apiListener, err := net.Listen("tcp", s.apiServer.Addr)
+	if err != nil {
+		return fmt.Errorf("API server error: %w", err)
+	}
+	healthListener, err := net.Listen("tcp", s.healthServer.Addr)
+	if err != nil {
+		_ = apiListener.Close()
+		return fmt.Errorf("health server error: %w", err)
 	}
+	s.listening.Store(true)
 
 	// Start servers in goroutines
 	apiErrChan := make(chan error, 1)
@@ -84,14 +124,15 @@ func (s *Server) Start(ctx context.Context) error {
 
 	go func() {
 		slog.Info("Starting API server", "addr", s.apiServer.Addr)
-		if err := s.apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.apiServer.Serve(apiListener); err != nil && err != http.ErrServerClosed {
+			s.listening.Store(false)
 			apiErrChan <- err
 		}
 	}()
 
 	go func() {
 		slog.Info("Starting health server", "addr", s.healthServer.Addr)
-		if err := s.healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.healthServer.Serve(healthListener); err != nil && err != http.ErrServerClosed {
 			healthErrChan <- err
 		}
 	}()
@@ -108,17 +149,317 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// newAPIServer creates the HTTP server for the webhook API. It binds
+// ServerHost, 127.0.0.1 unless configured otherwise, so only a sidecar in
+// the same pod can reach it.
+func (s *Server) newAPIServer() *http.Server {
+	host := s.config.ServerHost
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	apiServer := &http.Server{
+		Addr:         net.JoinHostPort(host, strconv.Itoa(s.config.ServerPort)),
+		Handler:      s.newAPIMux(),
+		ReadTimeout:  timeoutOrDefault(s.config.APIReadTimeout),
+		WriteTimeout: timeoutOrDefault(s.config.APIWriteTimeout),
+	}
+
+	// Some proxies between external-dns and the webhook mishandle reused
+	// connections; closing each one after its response avoids stale reuse
+	if s.config.DisableHTTPKeepAlives {
+		apiServer.SetKeepAlivesEnabled(false)
+	}
+
+	return apiServer
+}
+
+// newHealthServer creates the HTTP server for probes, metrics, and debug
+// endpoints. It binds HealthHost, 0.0.0.0 unless configured otherwise.
+func (s *Server) newHealthServer() *http.Server {
+	host := s.config.HealthHost
+	if host == "" {
+		host = "0.0.0.0"
+	}
+
+	return &http.Server{
+		Addr:         net.JoinHostPort(host, strconv.Itoa(s.config.HealthPort)),
+		Handler:      s.newHealthMux(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+// timeoutOrDefault returns timeout, or defaultTimeout when it is unset
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
+
+// newAPIMux builds the webhook routes served by the API server. Routes match
+// on path only, so query parameters (e.g. pagination hints added by newer
+// external-dns versions or proxies) are ignored rather than rejected.
+func (s *Server) newAPIMux() http.Handler {
+	// Create the webhook API handler using external-dns webhook API
+	webhookServer := &api.WebhookServer{
+		Provider: s.provider,
+	}
+
+	mux := http.NewServeMux()
+
+	// Setup webhook endpoints as per external-dns specification:
+	// GET / - Negotiate/Domain filter
+	// GET /records - Get records
+	// POST /records - Apply changes
+	// POST /adjustendpoints - Adjust endpoints
+	mux.HandleFunc("/", webhookServer.NegotiateHandler)
+	mux.HandleFunc("/records", s.recordsHandler(webhookServer))
+	mux.HandleFunc("/adjustendpoints", webhookServer.AdjustEndpointsHandler)
+
+	// POST /dryrun - Preview changes without applying them (our own addition)
+	if _, ok := s.provider.(previewProvider); ok {
+		mux.HandleFunc("POST /dryrun", s.handleDryRun)
+	}
+
+	return s.withRequestID(s.limitConcurrency(negotiateMediaType(mux)))
+}
+
+// limitConcurrency rejects requests with 503 while MaxConcurrentRequests
+// are already being served, so a flood of connections can't pile up work
+// on the provider. The health server isn't wrapped and stays reachable.
+func (s *Server) limitConcurrency(next http.Handler) http.Handler {
+	if s.config.MaxConcurrentRequests <= 0 {
+		return next
+	}
+
+	inFlight := make(chan struct{}, s.config.MaxConcurrentRequests)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			slog.WarnContext(r.Context(), "Too many concurrent webhook requests, rejecting",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"max_concurrent_requests", s.config.MaxConcurrentRequests)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// maxRequestIDLength bounds incoming request IDs; longer ones are replaced
+const maxRequestIDLength = 128
+
+// withRequestID tags each request with the ID from the RequestIDHeader
+// header, or a generated one, echoes it in the response, and carries it in
+// the request context so logs for the request include it
+func (s *Server) withRequestID(next http.Handler) http.Handler {
+	header := s.config.RequestIDHeader
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(header, id)
+
+		ctx := requestid.NewContext(r.Context(), id)
+		start := time.Now()
+		next.ServeHTTP(w, r.WithContext(ctx))
+		slog.DebugContext(ctx, "Handled webhook request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"duration", time.Since(start))
+	})
+}
+
+// validRequestID reports whether an incoming request ID is safe to reuse:
+// non-empty, bounded, and printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookMediaType is the webhook API media type without its version
+const webhookMediaType = "application/external.dns.webhook+json"
+
+// negotiateMediaType rejects with 406 Not Acceptable requests that only
+// accept webhook API versions this server doesn't speak, i.e. external-dns
+// and the webhook disagree on the API version. Without this the mismatch
+// surfaces as confusing decode errors in external-dns. Requests without an
+// Accept header, or that also accept other media types, are served as
+// before.
+func negotiateMediaType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := strings.Join(r.Header.Values("Accept"), ", ")
+		if accept == "" || acceptsWebhookVersion(accept) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slog.WarnContext(r.Context(), "Rejecting webhook request for an unsupported API version; external-dns and the webhook disagree on the webhook API version",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"accept", accept,
+			"supported_media_type", api.MediaTypeFormatAndVersion,
+			"supported_versions", webhookAPIVersions())
+		http.Error(w, fmt.Sprintf("unsupported webhook API version: the request accepts %q, but this webhook serves %q (versions %s). Use an external-dns release that speaks one of these webhook API versions.",
+			accept, api.MediaTypeFormatAndVersion, strings.Join(webhookAPIVersions(), ", ")), http.StatusNotAcceptable)
+	})
+}
+
+// acceptsWebhookVersion reports whether an Accept header admits a response
+// in a supported webhook API version. Only media ranges naming the webhook
+// media type with another version are refused; anything else, including
+// ranges that don't parse, is given the benefit of the doubt.
+func acceptsWebhookVersion(accept string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil || mediaType != webhookMediaType {
+			return true
+		}
+		version, ok := params["version"]
+		if !ok || slices.Contains(webhookAPIVersions(), version) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordsHandler serves /records. GET is handled by the external-dns webhook
+// handler; POST is handled here so that provider errors can be mapped to
+// status codes - in particular ErrProviderNotReady becomes 503 so
+// external-dns retries instead of treating the apply as failed.
+func (s *Server) recordsHandler(webhookServer *api.WebhookServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.handleGetRecords(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			webhookServer.RecordsHandler(w, r)
+			return
+		}
+
+		var changes plan.Changes
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to decode changes", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Like the upstream handler, don't tie the apply to the request's
+		// cancellation, but keep its values (the request ID) for logging
+		ctx := context.WithoutCancel(r.Context())
+		if err := s.provider.ApplyChanges(ctx, &changes); err != nil {
+			if errors.Is(err, nextdns.ErrProviderNotReady) {
+				slog.WarnContext(ctx, "Provider not ready, asking external-dns to retry", "error", err)
+				w.Header().Set("Retry-After", "5")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			slog.ErrorContext(ctx, "Failed to apply changes", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleGetRecords serves GET /records like the upstream handler, but
+// passes the request context so provider logs carry the request ID
+func (s *Server) handleGetRecords(w http.ResponseWriter, r *http.Request) {
+	records, err := s.provider.Records(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get records", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(api.ContentTypeHeader, api.MediaTypeFormatAndVersion)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode records", "error", err)
+	}
+}
+
+// handleDryRun previews the changes in a POST /records payload and returns
+// the planned diff, without applying anything regardless of DRY_RUN
+func (s *Server) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	var changes plan.Changes
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode changes", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	summary := s.provider.(previewProvider).PreviewChanges(r.Context(), &changes)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode change summary", "error", err)
+	}
+}
+
+// newHealthMux builds the routes served by the health server: probes,
+// metrics, and (when enabled) the token-protected debug endpoints
+func (s *Server) newHealthMux() *http.ServeMux {
+	healthMux := http.NewServeMux()
+	healthMux.HandleFunc("/healthz", s.handleHealth)
+	healthMux.HandleFunc("/readyz", s.handleReady)
+	healthMux.Handle("/metrics", metrics.Handler())
+	healthMux.HandleFunc("GET /version", s.handleVersion)
+	if _, ok := s.provider.(capabilitiesProvider); ok {
+		healthMux.HandleFunc("GET /capabilities", s.handleCapabilities)
+	}
+
+	if s.config.DebugEndpointsEnabled {
+		healthMux.Handle("GET /debug/domainfilter", s.requireDebugToken(http.HandlerFunc(s.handleDebugDomainFilter)))
+		if _, ok := s.provider.(historyProvider); ok {
+			healthMux.Handle("GET /debug/history", s.requireDebugToken(http.HandlerFunc(s.handleDebugHistory)))
+		}
+		if _, ok := s.provider.(applyErrorsProvider); ok {
+			healthMux.Handle("GET /debug/errors", s.requireDebugToken(http.HandlerFunc(s.handleDebugErrors)))
+		}
+	}
+
+	return healthMux
+}
+
 // shutdown gracefully shuts down the servers
 func (s *Server) shutdown() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutOrDefault(s.config.ShutdownTimeout))
 	defer cancel()
 
+	// Stop reporting ready so no new traffic is routed here while draining
+	s.listening.Store(false)
+
 	var apiErr, healthErr error
 
 	if s.apiServer != nil {
 		apiErr = s.apiServer.Shutdown(ctx)
 	}
 
+	// Apply anything the provider is still holding before exiting
+	if f, ok := s.provider.(flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			slog.Error("Failed to flush pending changes", "error", err)
+		}
+	}
+
 	if s.healthServer != nil {
 		healthErr = s.healthServer.Shutdown(ctx)
 	}
@@ -139,8 +480,98 @@ func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("OK"))
 }
 
-// handleReady handles readiness check requests
+// handleReady handles readiness check requests. The webhook is not ready
+// until the API server is accepting connections, READINESS_INITIAL_DELAY
+// has passed since startup and the provider has completed its first sync.
 func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	if !s.listening.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Not ready: API server not listening"))
+		return
+	}
+	if s.now().Sub(s.started) < s.config.ReadinessInitialDelay {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Not ready: initial delay"))
+		return
+	}
+	if rp, ok := s.provider.(readinessProvider); ok && !rp.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Not ready: waiting for first sync"))
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("Ready"))
 }
+
+// versionResponse is the body of GET /version
+type versionResponse struct {
+	MediaType          string   `json:"media_type"`
+	WebhookAPIVersions []string `json:"webhook_api_versions"`
+}
+
+// handleVersion reports the external-dns webhook API versions implemented
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	writeDebugJSON(w, versionResponse{
+		MediaType:          api.MediaTypeFormatAndVersion,
+		WebhookAPIVersions: webhookAPIVersions(),
+	})
+}
+
+// handleCapabilities reports the record types the provider manages and
+// whether updates and TTLs are native
+func (s *Server) handleCapabilities(w http.ResponseWriter, _ *http.Request) {
+	writeDebugJSON(w, s.provider.(capabilitiesProvider).Capabilities())
+}
+
+// webhookAPIVersions returns the webhook API versions this server speaks,
+// taken from the version parameter of the negotiated media type
+func webhookAPIVersions() []string {
+	_, version, found := strings.Cut(api.MediaTypeFormatAndVersion, "version=")
+	if !found {
+		return []string{}
+	}
+	return []string{version}
+}
+
+// requireDebugToken rejects requests that don't carry the configured debug
+// token as a bearer token
+func (s *Server) requireDebugToken(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.config.DebugToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if s.config.DebugToken == "" || subtle.ConstantTimeCompare(got, expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleDebugDomainFilter returns the provider's effective domain filter,
+// i.e. what external-dns will scope its sources to
+func (s *Server) handleDebugDomainFilter(w http.ResponseWriter, _ *http.Request) {
+	writeDebugJSON(w, s.provider.GetDomainFilter())
+}
+
+// handleDebugHistory returns the most recently applied record changes
+func (s *Server) handleDebugHistory(w http.ResponseWriter, _ *http.Request) {
+	writeDebugJSON(w, s.provider.(historyProvider).History())
+}
+
+// handleDebugErrors returns the record changes that failed since the last
+// successful apply
+func (s *Server) handleDebugErrors(w http.ResponseWriter, _ *http.Request) {
+	writeDebugJSON(w, s.provider.(applyErrorsProvider).ApplyErrors())
+}
+
+// writeDebugJSON writes v as an indented JSON response
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Error("Failed to encode debug response", "error", err)
+	}
+}
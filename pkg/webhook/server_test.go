@@ -1,18 +1,28 @@
 package webhook
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
 
 	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/nextdns"
+	"github.com/cullenmcdermott/external-dns-nextdns-webhook/internal/requestid"
 )
 
 // mockProvider implements the provider.Provider interface for testing
@@ -138,6 +148,8 @@ func TestReadyEndpoint(t *testing.T) {
 		t.Fatalf("NewServer() failed: %v", err)
 	}
 
+	server.listening.Store(true)
+
 	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
 	w := httptest.NewRecorder()
 
@@ -211,6 +223,42 @@ func TestServerShutdown(t *testing.T) {
 	}
 }
 
+func TestServerStart_APIBindFailure(t *testing.T) {
+	// Hold the API port so the server can't bind it
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer func() { _ = taken.Close() }()
+
+	config := &nextdns.Config{
+		ServerPort: taken.Addr().(*net.TCPAddr).Port,
+		HealthHost: "127.0.0.1",
+	}
+	server, err := NewServer(config, &mockProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- server.Start(context.Background()) }()
+
+	select {
+	case err := <-errChan:
+		if err == nil || !strings.Contains(err.Error(), "API server error") {
+			t.Errorf("Start() error = %v, want an API server error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after the API server failed to bind")
+	}
+
+	w := httptest.NewRecorder()
+	server.handleReady(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("handleReady() status = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
 func TestServerConfiguration(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -288,3 +336,876 @@ func TestServerFields(t *testing.T) {
 		t.Error("Server.healthServer should be nil before Start()")
 	}
 }
+
+// filterProvider is a mockProvider with a configurable domain filter
+type filterProvider struct {
+	mockProvider
+	filter endpoint.DomainFilter
+}
+
+func (f *filterProvider) GetDomainFilter() endpoint.DomainFilter {
+	return f.filter
+}
+
+func TestDebugDomainFilterEndpoint(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:                "test-key",
+		ProfileID:             "test-profile",
+		ServerPort:            8888,
+		HealthPort:            8080,
+		DebugEndpointsEnabled: true,
+		DebugToken:            "secret",
+	}
+
+	provider := &filterProvider{
+		filter: endpoint.NewDomainFilterWithExclusions(
+			[]string{"example.com", "test.com"},
+			[]string{"internal.example.com"},
+		),
+	}
+
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newHealthMux()
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantStatus int
+	}{
+		{name: "valid token", authHeader: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "wrong token", authHeader: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{name: "missing token", authHeader: "", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/domainfilter", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got struct {
+				Include []string `json:"include"`
+				Exclude []string `json:"exclude"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(got.Include, []string{"example.com", "test.com"}) {
+				t.Errorf("include = %v, want [example.com test.com]", got.Include)
+			}
+			if !reflect.DeepEqual(got.Exclude, []string{"internal.example.com"}) {
+				t.Errorf("exclude = %v, want [internal.example.com]", got.Exclude)
+			}
+		})
+	}
+}
+
+func TestDebugEndpointsDisabledByDefault(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:     "test-key",
+		ProfileID:  "test-profile",
+		ServerPort: 8888,
+		HealthPort: 8080,
+		DebugToken: "secret",
+	}
+
+	server, err := NewServer(config, &mockProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/domainfilter", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	server.newHealthMux().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %v, want %v when debug endpoints are disabled", w.Code, http.StatusNotFound)
+	}
+}
+
+// recordsProvider is a mockProvider that returns a fixed set of records
+type recordsProvider struct {
+	mockProvider
+	records []*endpoint.Endpoint
+}
+
+func (r *recordsProvider) Records(_ context.Context) ([]*endpoint.Endpoint, error) {
+	return r.records, nil
+}
+
+func TestRecordsHandler_IgnoresQueryParams(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:     "test-key",
+		ProfileID:  "test-profile",
+		ServerPort: 8888,
+		HealthPort: 8080,
+	}
+	provider := &recordsProvider{
+		records: []*endpoint.Endpoint{
+			{DNSName: "web.example.com", RecordType: "A", Targets: endpoint.Targets{"10.0.0.1"}},
+			{DNSName: "api.example.com", RecordType: "CNAME", Targets: endpoint.Targets{"web.example.com"}},
+		},
+	}
+
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newAPIMux()
+
+	get := func(target string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	wantStatus, wantBody := get("/records")
+	if wantStatus != http.StatusOK {
+		t.Fatalf("GET /records status = %v, want %v", wantStatus, http.StatusOK)
+	}
+
+	for _, target := range []string{"/records?foo=bar", "/records?page=2&limit=10", "/records?"} {
+		status, body := get(target)
+		if status != wantStatus {
+			t.Errorf("GET %s status = %v, want %v", target, status, wantStatus)
+		}
+		if body != wantBody {
+			t.Errorf("GET %s body = %s, want %s", target, body, wantBody)
+		}
+	}
+}
+
+func TestAPIServer_NegotiateMediaType(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     []string
+		wantStatus int
+	}{
+		{name: "no Accept header", wantStatus: http.StatusOK},
+		{name: "supported version", accept: []string{api.MediaTypeFormatAndVersion}, wantStatus: http.StatusOK},
+		{name: "supported version, spaced", accept: []string{"application/external.dns.webhook+json; version=1"}, wantStatus: http.StatusOK},
+		{name: "webhook type without version", accept: []string{"application/external.dns.webhook+json"}, wantStatus: http.StatusOK},
+		{name: "any type", accept: []string{"*/*"}, wantStatus: http.StatusOK},
+		{name: "other version or any type", accept: []string{"application/external.dns.webhook+json;version=2, */*;q=0.1"}, wantStatus: http.StatusOK},
+		{name: "other version", accept: []string{"application/external.dns.webhook+json;version=2"}, wantStatus: http.StatusNotAcceptable},
+		{name: "other versions in separate headers", accept: []string{"application/external.dns.webhook+json;version=2", "application/external.dns.webhook+json;version=3"}, wantStatus: http.StatusNotAcceptable},
+	}
+
+	config := &nextdns.Config{
+		APIKey:     "test-key",
+		ProfileID:  "test-profile",
+		ServerPort: 8888,
+		HealthPort: 8080,
+	}
+	server, err := NewServer(config, &mockProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newAPIMux()
+
+	for _, tt := range tests {
+		for _, path := range []string{"/", "/records"} {
+			t.Run(tt.name+" "+path, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				for _, accept := range tt.accept {
+					req.Header.Add("Accept", accept)
+				}
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Fatalf("GET %s status = %v, want %v", path, w.Code, tt.wantStatus)
+				}
+				if tt.wantStatus == http.StatusNotAcceptable {
+					body := w.Body.String()
+					for _, want := range []string{"version=2", api.MediaTypeFormatAndVersion} {
+						if !strings.Contains(body, want) {
+							t.Errorf("406 body = %q, want it to mention %q", body, want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// applyErrProvider is a mockProvider whose ApplyChanges returns err
+type applyErrProvider struct {
+	mockProvider
+	err error
+}
+
+func (a *applyErrProvider) ApplyChanges(_ context.Context, _ *plan.Changes) error {
+	return a.err
+}
+
+func TestRecordsHandler_ApplyStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		applyErr   error
+		wantStatus int
+	}{
+		{name: "applied", body: `{}`, wantStatus: http.StatusNoContent},
+		{name: "provider not ready", body: `{}`, applyErr: fmt.Errorf("wrapped: %w", nextdns.ErrProviderNotReady), wantStatus: http.StatusServiceUnavailable},
+		{name: "apply failure", body: `{}`, applyErr: errors.New("boom"), wantStatus: http.StatusInternalServerError},
+		{name: "invalid body", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &nextdns.Config{
+				APIKey:     "test-key",
+				ProfileID:  "test-profile",
+				ServerPort: 8888,
+				HealthPort: 8080,
+			}
+			server, err := NewServer(config, &applyErrProvider{err: tt.applyErr})
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.newAPIMux().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("POST /records status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("503 response is missing Retry-After")
+			}
+		})
+	}
+}
+
+func TestAPIServer_KeepAlives(t *testing.T) {
+	tests := []struct {
+		name      string
+		disable   bool
+		wantClose bool
+	}{
+		{name: "keep-alives enabled by default", disable: false, wantClose: false},
+		{name: "keep-alives disabled", disable: true, wantClose: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &nextdns.Config{
+				APIKey:                "test-key",
+				ProfileID:             "test-profile",
+				ServerPort:            8888,
+				HealthPort:            8080,
+				DisableHTTPKeepAlives: tt.disable,
+			}
+			server, err := NewServer(config, &mockProvider{})
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			apiServer := server.newAPIServer()
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			go func() { _ = apiServer.Serve(listener) }()
+			t.Cleanup(func() { _ = apiServer.Close() })
+
+			resp, err := http.Get("http://" + listener.Addr().String() + "/")
+			if err != nil {
+				t.Fatalf("GET / failed: %v", err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+
+			if resp.Close != tt.wantClose {
+				t.Errorf("response Close = %v, want %v", resp.Close, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestAPIServer_Timeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		read      time.Duration
+		write     time.Duration
+		wantRead  time.Duration
+		wantWrite time.Duration
+	}{
+		{name: "configured", read: 5 * time.Second, write: 2 * time.Minute, wantRead: 5 * time.Second, wantWrite: 2 * time.Minute},
+		{name: "unset falls back to default", wantRead: defaultTimeout, wantWrite: defaultTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &nextdns.Config{
+				APIKey:          "test-key",
+				ProfileID:       "test-profile",
+				ServerPort:      8888,
+				HealthPort:      8080,
+				APIReadTimeout:  tt.read,
+				APIWriteTimeout: tt.write,
+			}
+			server, err := NewServer(config, &mockProvider{})
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			apiServer := server.newAPIServer()
+			if apiServer.ReadTimeout != tt.wantRead {
+				t.Errorf("ReadTimeout = %v, want %v", apiServer.ReadTimeout, tt.wantRead)
+			}
+			if apiServer.WriteTimeout != tt.wantWrite {
+				t.Errorf("WriteTimeout = %v, want %v", apiServer.WriteTimeout, tt.wantWrite)
+			}
+		})
+	}
+}
+
+// historyProviderMock is a mockProvider with a fixed change history
+type historyProviderMock struct {
+	mockProvider
+	history []nextdns.HistoryEntry
+}
+
+func (h *historyProviderMock) History() []nextdns.HistoryEntry {
+	return h.history
+}
+
+func TestDebugHistoryEndpoint(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:                "test-key",
+		ProfileID:             "test-profile",
+		DebugEndpointsEnabled: true,
+		DebugToken:            "secret",
+	}
+	provider := &historyProviderMock{
+		history: []nextdns.HistoryEntry{
+			{DNSName: "web.example.com", RecordType: "A", Action: "create", Timestamp: time.Unix(0, 0).UTC(), Outcome: nextdns.OutcomeSuccess},
+			{DNSName: "old.example.com", RecordType: "CNAME", Action: "delete", Timestamp: time.Unix(60, 0).UTC(), Outcome: nextdns.OutcomeError, Error: "boom"},
+		},
+	}
+
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newHealthMux()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/history", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status without token = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/history", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var got []nextdns.HistoryEntry
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(got, provider.history) {
+		t.Errorf("history = %+v, want %+v", got, provider.history)
+	}
+}
+
+func TestAPIServer_Addr(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "default binds loopback", host: "", want: "127.0.0.1:8888"},
+		{name: "all interfaces", host: "0.0.0.0", want: "0.0.0.0:8888"},
+		{name: "IPv6", host: "::1", want: "[::1]:8888"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &nextdns.Config{
+				APIKey:     "test-key",
+				ProfileID:  "test-profile",
+				ServerPort: 8888,
+				ServerHost: tt.host,
+			}
+			server, err := NewServer(config, &mockProvider{})
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			if got := server.newAPIServer().Addr; got != tt.want {
+				t.Errorf("API server Addr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthServer_Addr(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "default binds all interfaces", host: "", want: "0.0.0.0:8080"},
+		{name: "loopback", host: "127.0.0.1", want: "127.0.0.1:8080"},
+		{name: "IPv6", host: "::1", want: "[::1]:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &nextdns.Config{
+				APIKey:     "test-key",
+				ProfileID:  "test-profile",
+				HealthPort: 8080,
+				HealthHost: tt.host,
+			}
+			server, err := NewServer(config, &mockProvider{})
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			if got := server.newHealthServer().Addr; got != tt.want {
+				t.Errorf("health server Addr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// applyErrorsProviderMock is a mockProvider with fixed apply errors
+type applyErrorsProviderMock struct {
+	mockProvider
+	errors []nextdns.ApplyError
+}
+
+func (a *applyErrorsProviderMock) ApplyErrors() []nextdns.ApplyError {
+	return a.errors
+}
+
+func TestDebugErrorsEndpoint(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:                "test-key",
+		ProfileID:             "test-profile",
+		DebugEndpointsEnabled: true,
+		DebugToken:            "secret",
+	}
+	provider := &applyErrorsProviderMock{
+		errors: []nextdns.ApplyError{
+			{DNSName: "web.example.com", RecordType: "A", Action: "create", Timestamp: time.Unix(0, 0).UTC(), Error: "boom"},
+		},
+	}
+
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newHealthMux()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/errors", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status without token = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/errors", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var got []nextdns.ApplyError
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(got, provider.errors) {
+		t.Errorf("errors = %+v, want %+v", got, provider.errors)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:    "test-key",
+		ProfileID: "test-profile",
+	}
+	server, err := NewServer(config, &mockProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	w := httptest.NewRecorder()
+	server.newHealthMux().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var got versionResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.MediaType != api.MediaTypeFormatAndVersion {
+		t.Errorf("media_type = %q, want %q", got.MediaType, api.MediaTypeFormatAndVersion)
+	}
+	if !reflect.DeepEqual(got.WebhookAPIVersions, []string{"1"}) || !strings.HasSuffix(api.MediaTypeFormatAndVersion, "version="+got.WebhookAPIVersions[0]) {
+		t.Errorf("webhook_api_versions = %v, want the version from %q", got.WebhookAPIVersions, api.MediaTypeFormatAndVersion)
+	}
+}
+
+// loggingProvider is a recordsProvider that logs each Records call with the
+// request context
+type loggingProvider struct {
+	recordsProvider
+}
+
+func (l *loggingProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	slog.InfoContext(ctx, "Listing records")
+	return l.records, nil
+}
+
+func TestAPIServer_RequestID(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(requestid.NewHandler(slog.NewTextHandler(&logs, nil))))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	config := &nextdns.Config{
+		APIKey:          "test-key",
+		ProfileID:       "test-profile",
+		ServerPort:      8888,
+		HealthPort:      8080,
+		RequestIDHeader: "X-Correlation-ID",
+	}
+	server, err := NewServer(config, &loggingProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newAPIMux()
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantID   string
+	}{
+		{name: "echoes incoming ID", incoming: "abc-123", wantID: "abc-123"},
+		{name: "generates missing ID"},
+		{name: "replaces unprintable ID", incoming: "bad id\x01"},
+		{name: "replaces oversized ID", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/records", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Correlation-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /records status = %v, want %v", w.Code, http.StatusOK)
+			}
+			id := w.Header().Get("X-Correlation-ID")
+			if id == "" {
+				t.Fatal("response has no request ID header")
+			}
+			if tt.wantID != "" && id != tt.wantID {
+				t.Errorf("request ID = %q, want %q", id, tt.wantID)
+			}
+			if tt.wantID == "" && id == tt.incoming {
+				t.Errorf("request ID %q should have been replaced", id)
+			}
+			if !strings.Contains(logs.String(), "request_id="+id) {
+				t.Errorf("provider logs should carry request_id=%s, got:\n%s", id, logs.String())
+			}
+		})
+	}
+}
+
+// blockingProvider is a mockProvider whose Records calls signal started and
+// then wait for release
+type blockingProvider struct {
+	mockProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingProvider) Records(_ context.Context) ([]*endpoint.Endpoint, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return nil, nil
+}
+
+func TestAPIServer_MaxConcurrentRequests(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:                "test-key",
+		ProfileID:             "test-profile",
+		ServerPort:            8888,
+		HealthPort:            8080,
+		MaxConcurrentRequests: 2,
+	}
+	provider := &blockingProvider{started: make(chan struct{}), release: make(chan struct{})}
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newAPIMux()
+
+	get := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/records", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Fill the limit with requests that block inside the provider
+	results := make(chan int, config.MaxConcurrentRequests)
+	for range config.MaxConcurrentRequests {
+		go func() { results <- get() }()
+		<-provider.started
+	}
+
+	if code := get(); code != http.StatusServiceUnavailable {
+		t.Errorf("request beyond the limit status = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+
+	// The health server is exempt from the limit
+	w := httptest.NewRecorder()
+	server.newHealthMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /healthz status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	close(provider.release)
+	for range config.MaxConcurrentRequests {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("request within the limit status = %v, want %v", code, http.StatusOK)
+		}
+	}
+
+	// Slots are released once requests finish
+	go func() { <-provider.started }()
+	if code := get(); code != http.StatusOK {
+		t.Errorf("request after release status = %v, want %v", code, http.StatusOK)
+	}
+}
+
+// previewingProvider is a mockProvider that previews changes and records
+// whether any were applied
+type previewingProvider struct {
+	mockProvider
+	applied bool
+}
+
+func (p *previewingProvider) ApplyChanges(_ context.Context, _ *plan.Changes) error {
+	p.applied = true
+	return nil
+}
+
+func (p *previewingProvider) PreviewChanges(_ context.Context, changes *plan.Changes) nextdns.ChangeSummary {
+	summary := nextdns.ChangeSummary{ProfileID: "test-profile"}
+	for _, ep := range changes.Create {
+		summary.Create = append(summary.Create, nextdns.ChangeEntry{DNSName: ep.DNSName, RecordType: ep.RecordType, Targets: ep.Targets})
+	}
+	return summary
+}
+
+func TestAPIServer_DryRun(t *testing.T) {
+	config := &nextdns.Config{ProfileID: "test-profile"}
+	provider := &previewingProvider{}
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	mux := server.newAPIMux()
+
+	body := `{"Create":[{"dnsName":"new.example.com","recordType":"A","targets":["10.0.0.1"]}]}`
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dryrun", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /dryrun status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if provider.applied {
+		t.Error("POST /dryrun applied the changes")
+	}
+
+	var got nextdns.ChangeSummary
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(got.Create) != 1 || got.Create[0].DNSName != "new.example.com" {
+		t.Errorf("summary creates = %+v, want new.example.com", got.Create)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dryrun", strings.NewReader("not json")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST /dryrun with a bad payload status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCapabilitiesEndpoint(t *testing.T) {
+	config := &nextdns.Config{
+		APIKey:             "test-key",
+		ProfileID:          "test-profile",
+		DryRun:             true,
+		SupportedRecords:   []string{"A", "AAAA", "cname"},
+		TXTRegistryEnabled: true,
+	}
+	provider, err := nextdns.NewProvider(config)
+	if err != nil {
+		t.Fatalf("NewProvider() failed: %v", err)
+	}
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+	w := httptest.NewRecorder()
+	server.newHealthMux().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var got nextdns.Capabilities
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := nextdns.Capabilities{
+		RecordTypes:   []string{"A", "AAAA", "CNAME"},
+		NativeUpdates: false,
+		TTLHonored:    false,
+		DefaultTTL:    int64(nextdns.DefaultTTL),
+		TXTRegistry:   true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("capabilities = %+v, want %+v", got, want)
+	}
+
+	// Providers that don't describe themselves get no endpoint
+	server, err = NewServer(config, &mockProvider{})
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	server.newHealthMux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status without capabilities = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
+
+// readyProvider is a mockProvider that reports whether its first sync is done
+type readyProvider struct {
+	mockProvider
+	ready bool
+}
+
+func (r *readyProvider) Ready() bool { return r.ready }
+
+func TestHandleReady_InitialDelay(t *testing.T) {
+	config := &nextdns.Config{ReadinessInitialDelay: 30 * time.Second}
+	provider := &readyProvider{}
+	server, err := NewServer(config, provider)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	server.listening.Store(true)
+	now := server.started
+	server.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		synced  bool
+		want    int
+	}{
+		{name: "at startup", elapsed: 0, want: http.StatusServiceUnavailable},
+		{name: "synced during the delay", elapsed: 10 * time.Second, synced: true, want: http.StatusServiceUnavailable},
+		{name: "delay elapsed before the first sync", elapsed: 30 * time.Second, want: http.StatusServiceUnavailable},
+		{name: "delay elapsed and synced", elapsed: 30 * time.Second, synced: true, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = server.started.Add(tt.elapsed)
+			provider.ready = tt.synced
+
+			w := httptest.NewRecorder()
+			server.handleReady(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.want {
+				t.Errorf("handleReady() status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// deadlineFlusher is a mockProvider that records the deadline of the
+// context it is flushed with
+type deadlineFlusher struct {
+	mockProvider
+	deadline time.Time
+}
+
+func (d *deadlineFlusher) Flush(ctx context.Context) error {
+	d.deadline, _ = ctx.Deadline()
+	return nil
+}
+
+func TestShutdown_Timeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{name: "configured", timeout: 2 * time.Minute, want: 2 * time.Minute},
+		{name: "unset falls back to default", want: defaultTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &deadlineFlusher{}
+			server, err := NewServer(&nextdns.Config{ShutdownTimeout: tt.timeout}, provider)
+			if err != nil {
+				t.Fatalf("NewServer() failed: %v", err)
+			}
+
+			start := time.Now()
+			if err := server.shutdown(); err != nil {
+				t.Fatalf("shutdown() error = %v", err)
+			}
+			if got := provider.deadline.Sub(start); got < tt.want || got > tt.want+5*time.Second {
+				t.Errorf("shutdown deadline = %v after start, want %v", got, tt.want)
+			}
+		})
+	}
+}